@@ -1,25 +1,42 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Database DatabaseConfig `mapstructure:"database"`
-	Server   ServerConfig   `mapstructure:"server"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Stripe   StripeConfig   `mapstructure:"stripe"`
-	Admin    AdminConfig    `mapstructure:"admin"`
-	CORS     CORSConfig     `mapstructure:"cors"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Server    ServerConfig    `mapstructure:"server"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Stripe    StripeConfig    `mapstructure:"stripe"`
+	Admin     AdminConfig     `mapstructure:"admin"`
+	CORS      CORSConfig      `mapstructure:"cors"`
+	Storage   StorageConfig   `mapstructure:"storage"`
+	MinIO     MinIOConfig     `mapstructure:"minio"`
+	Site      SiteConfig      `mapstructure:"site"`
+	Jobs      JobsConfig      `mapstructure:"jobs"`
+	Orders    OrdersConfig    `mapstructure:"orders"`
+	Mail      MailConfig      `mapstructure:"mail"`
+	GiftCards GiftCardsConfig `mapstructure:"gift_cards"`
+	Login     LoginConfig     `mapstructure:"login"`
 }
 
 type AdminConfig struct {
-	DefaultEmail    string `mapstructure:"default_email"`
-	DefaultPassword string `mapstructure:"default_password"`
+	DefaultEmail          string        `mapstructure:"default_email"`
+	DefaultPassword       string        `mapstructure:"default_password"`
+	PermissionCacheTTL    time.Duration `mapstructure:"permission_cache_ttl"` // how long role permissions are cached
+	PanelURL              string        `mapstructure:"panel_url"`            // admin panel URL used in emailed links
+	InviteTTL             time.Duration `mapstructure:"invite_ttl"`
+	PasswordResetTTL      time.Duration `mapstructure:"password_reset_ttl"`
+	PasswordMinLength     int           `mapstructure:"password_min_length"`
+	TwoFactorChallengeTTL time.Duration `mapstructure:"two_factor_challenge_ttl"` // time between the password and code login steps
+	APIKeyTTL             time.Duration `mapstructure:"api_key_ttl"`              // lifetime of API keys created without an expiry
 }
 
 type DatabaseConfig struct {
@@ -37,7 +54,13 @@ type ServerConfig struct {
 }
 
 type JWTConfig struct {
-	Secret string `mapstructure:"secret"`
+	Secret               string        `mapstructure:"secret"`
+	Algorithm            string        `mapstructure:"algorithm"`              // HS256 (shared secret), RS256 or EdDSA
+	SigningKeyFile       string        `mapstructure:"signing_key_file"`       // PEM private key for RS256/EdDSA
+	VerificationKeyFiles []string      `mapstructure:"verification_key_files"` // retired keys still accepted during rotation
+	AccessTokenTTL       time.Duration `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL      time.Duration `mapstructure:"refresh_token_ttl"` // sign-out after this long without a refresh
+	SessionMaxAge        time.Duration `mapstructure:"session_max_age"`   // sign-out this long after the password login, however active
 }
 
 type StripeConfig struct {
@@ -49,6 +72,75 @@ type CORSConfig struct {
 	AllowedOrigins []string `mapstructure:"allowed_origins"`
 }
 
+type StorageConfig struct {
+	Driver        string `mapstructure:"driver"` // "local" or "s3"
+	LocalDir      string `mapstructure:"local_dir"`
+	PublicURL     string `mapstructure:"public_url"`
+	MaxUploadSize int64  `mapstructure:"max_upload_size"` // bytes
+	ThumbnailSize int    `mapstructure:"thumbnail_size"`  // longest edge in pixels
+}
+
+type SiteConfig struct {
+	BaseURL  string `mapstructure:"base_url"` // public storefront URL used in sitemaps and feeds
+	Brand    string `mapstructure:"brand"`
+	Currency string `mapstructure:"currency"`
+}
+
+type JobsConfig struct {
+	RecommendationsInterval time.Duration `mapstructure:"recommendations_interval"`
+	LowStockInterval        time.Duration `mapstructure:"low_stock_interval"`
+	BackInStockInterval     time.Duration `mapstructure:"back_in_stock_interval"`
+	SessionPurgeInterval    time.Duration `mapstructure:"session_purge_interval"`
+}
+
+type GiftCardsConfig struct {
+	Expiry            time.Duration `mapstructure:"expiry"`              // purchased gift cards; 0 means never
+	StoreCreditExpiry time.Duration `mapstructure:"store_credit_expiry"` // 0 means never
+	MinAmount         float64       `mapstructure:"min_amount"`
+	MaxAmount         float64       `mapstructure:"max_amount"`
+}
+
+type MailConfig struct {
+	Driver       string `mapstructure:"driver"` // "log" or "smtp"
+	From         string `mapstructure:"from"`
+	SMTPHost     string `mapstructure:"smtp_host"`
+	SMTPPort     int    `mapstructure:"smtp_port"`
+	SMTPUsername string `mapstructure:"smtp_username"`
+	SMTPPassword string `mapstructure:"smtp_password"`
+}
+
+// OrdersConfig controls when payment is captured for orders containing items
+// sold ahead of stock: "immediate" or "on_ship" (authorize now, capture when
+// the order ships).
+type OrdersConfig struct {
+	PreorderCapture  string `mapstructure:"preorder_capture"`
+	BackorderCapture string `mapstructure:"backorder_capture"`
+	// How long after delivery customers can request a return
+	ReturnWindow time.Duration `mapstructure:"return_window"`
+}
+
+// LoginConfig controls how failed admin logins slow down and lock out
+// further attempts, per account and per IP address.
+type LoginConfig struct {
+	Store           string        `mapstructure:"store"`         // "database" or "memory"
+	BackoffAfter    int           `mapstructure:"backoff_after"` // failures before attempts have to wait
+	BackoffBase     time.Duration `mapstructure:"backoff_base"`  // first wait, doubled for each further failure
+	BackoffMax      time.Duration `mapstructure:"backoff_max"`
+	LockoutAfter    int           `mapstructure:"lockout_after"` // failures before an account is locked
+	LockoutDuration time.Duration `mapstructure:"lockout_duration"`
+	IPLockoutAfter  int           `mapstructure:"ip_lockout_after"` // failures before an IP address is locked
+	FailureWindow   time.Duration `mapstructure:"failure_window"`   // failures older than this are forgotten
+}
+
+type MinIOConfig struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	BucketName      string `mapstructure:"bucket_name"`
+	UseSSL          bool   `mapstructure:"use_ssl"`
+	Region          string `mapstructure:"region"`
+}
+
 
 var AppConfig *Config
 
@@ -99,6 +191,10 @@ func LoadConfig() {
 
 	// Override with Railway environment variables if they exist
 	overrideWithEnvVars(&config)
+
+	if err := checkJWTConfig(&config); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
 	
 	AppConfig = &config
 	log.Printf("Configuration loaded successfully")
@@ -107,6 +203,34 @@ func LoadConfig() {
 	log.Printf("Admin: %s", config.Admin.DefaultEmail)
 }
 
+// defaultJWTSecrets are the placeholder secrets shipped with the code and
+// sample config files.
+var defaultJWTSecrets = []string{
+	"change-this-in-production-bjj-store-2024",
+	"bjj-store-jwt-secret-change-in-production-2024",
+	"your-super-secret-jwt-key-change-this-in-production",
+}
+
+// checkJWTConfig stops production from signing admin tokens with a secret
+// anyone could read from the repository.
+func checkJWTConfig(config *Config) error {
+	if config.Server.Environment != "production" {
+		return nil
+	}
+	if algorithm := strings.ToUpper(config.JWT.Algorithm); algorithm != "" && algorithm != "HS256" {
+		return nil
+	}
+	for _, secret := range defaultJWTSecrets {
+		if config.JWT.Secret == secret {
+			return errors.New("jwt.secret is still the default; set JWT_SECRET or use RS256/EdDSA signing keys")
+		}
+	}
+	if len(config.JWT.Secret) < 32 {
+		return errors.New("jwt.secret must be at least 32 characters in production")
+	}
+	return nil
+}
+
 func setDefaults() {
 	// Database defaults
 	viper.SetDefault("database.host", "localhost")
@@ -121,11 +245,24 @@ func setDefaults() {
 	viper.SetDefault("server.environment", "development")
 
 	// JWT defaults
-	viper.SetDefault("jwt.secret", "change-this-in-production-bjj-store-2024")
+	viper.SetDefault("jwt.secret", defaultJWTSecrets[0])
+	viper.SetDefault("jwt.algorithm", "HS256")
+	viper.SetDefault("jwt.signing_key_file", "")
+	viper.SetDefault("jwt.verification_key_files", []string{})
+	viper.SetDefault("jwt.access_token_ttl", 15*time.Minute)
+	viper.SetDefault("jwt.refresh_token_ttl", 24*time.Hour)
+	viper.SetDefault("jwt.session_max_age", 7*24*time.Hour)
 
 	// Admin defaults
 	viper.SetDefault("admin.default_email", "admin@bjjstore.com")
 	viper.SetDefault("admin.default_password", "admin123")
+	viper.SetDefault("admin.permission_cache_ttl", time.Minute)
+	viper.SetDefault("admin.panel_url", "http://localhost:3000/admin")
+	viper.SetDefault("admin.invite_ttl", 72*time.Hour)
+	viper.SetDefault("admin.password_reset_ttl", time.Hour)
+	viper.SetDefault("admin.password_min_length", 10)
+	viper.SetDefault("admin.two_factor_challenge_ttl", 5*time.Minute)
+	viper.SetDefault("admin.api_key_ttl", 90*24*time.Hour)
 
 	viper.SetDefault("stripe.secret_key", "")
 	viper.SetDefault("stripe.webhook_secret", "")
@@ -133,6 +270,60 @@ func setDefaults() {
 	// CORS defaults
 	viper.SetDefault("cors.allowed_origins", []string{"http://localhost:5173"})
 
+	// Storage defaults
+	viper.SetDefault("storage.driver", "local")
+	viper.SetDefault("storage.local_dir", "uploads")
+	viper.SetDefault("storage.public_url", "")
+	viper.SetDefault("storage.max_upload_size", 5<<20)
+	viper.SetDefault("storage.thumbnail_size", 300)
+
+	viper.SetDefault("minio.endpoint", "localhost:9000")
+	viper.SetDefault("minio.access_key_id", "")
+	viper.SetDefault("minio.secret_access_key", "")
+	viper.SetDefault("minio.bucket_name", "bjj-store-images")
+	viper.SetDefault("minio.use_ssl", false)
+	viper.SetDefault("minio.region", "us-east-1")
+
+	// Storefront defaults
+	viper.SetDefault("site.base_url", "http://localhost:5173")
+	viper.SetDefault("site.brand", "BJJ Store")
+	viper.SetDefault("site.currency", "USD")
+
+	// Order defaults
+	viper.SetDefault("orders.preorder_capture", "on_ship")
+	viper.SetDefault("orders.backorder_capture", "immediate")
+	viper.SetDefault("orders.return_window", 30*24*time.Hour)
+
+	// Background job defaults
+	viper.SetDefault("jobs.recommendations_interval", 6*time.Hour)
+	viper.SetDefault("jobs.low_stock_interval", 15*time.Minute)
+	viper.SetDefault("jobs.back_in_stock_interval", 10*time.Minute)
+	viper.SetDefault("jobs.session_purge_interval", time.Hour)
+
+	// Gift card defaults
+	viper.SetDefault("gift_cards.expiry", 5*365*24*time.Hour)
+	viper.SetDefault("gift_cards.store_credit_expiry", 365*24*time.Hour)
+	viper.SetDefault("gift_cards.min_amount", 10.0)
+	viper.SetDefault("gift_cards.max_amount", 500.0)
+
+	// Login protection defaults
+	viper.SetDefault("login.store", "database")
+	viper.SetDefault("login.backoff_after", 3)
+	viper.SetDefault("login.backoff_base", time.Second)
+	viper.SetDefault("login.backoff_max", 5*time.Minute)
+	viper.SetDefault("login.lockout_after", 10)
+	viper.SetDefault("login.lockout_duration", 15*time.Minute)
+	viper.SetDefault("login.ip_lockout_after", 50)
+	viper.SetDefault("login.failure_window", time.Hour)
+
+	// Mail defaults
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("mail.from", "BJJ Store <no-reply@bjjstore.com>")
+	viper.SetDefault("mail.smtp_host", "")
+	viper.SetDefault("mail.smtp_port", 587)
+	viper.SetDefault("mail.smtp_username", "")
+	viper.SetDefault("mail.smtp_password", "")
+
 }
 
 // overrideWithEnvVars directly reads Railway environment variables
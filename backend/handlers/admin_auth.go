@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -17,23 +19,43 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Success bool              `json:"success"`
-	Token   string            `json:"token"`
-	Admin   AdminUserResponse `json:"admin"`
-	Message string            `json:"message"`
+	Success          bool              `json:"success"`
+	Token            string            `json:"token"`
+	ExpiresIn        int               `json:"expires_in"` // seconds until the token expires
+	RefreshToken     string            `json:"refresh_token"`
+	RefreshExpiresAt time.Time         `json:"refresh_expires_at"`
+	Admin            AdminUserResponse `json:"admin"`
+	Message          string            `json:"message"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TwoFactorChallengeResponse is returned by the first login step for admins
+// with two-factor authentication. The challenge token and a code are then
+// exchanged for a session at /admin/auth/2fa.
+type TwoFactorChallengeResponse struct {
+	Success           bool   `json:"success"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"` // seconds
+	Message           string `json:"message"`
 }
 
 type AdminUserResponse struct {
-	ID        uint             `json:"id"`
-	Email     string           `json:"email"`
-	Role      models.AdminRole `json:"role"`
-	IsActive  bool             `json:"is_active"`
-	LastLogin *time.Time       `json:"last_login"`
+	ID                 uint             `json:"id"`
+	Email              string           `json:"email"`
+	Role               models.AdminRole `json:"role"`
+	IsActive           bool             `json:"is_active"`
+	MustChangePassword bool             `json:"must_change_password"`
+	TwoFactorEnabled   bool             `json:"two_factor_enabled"`
+	LastLogin          *time.Time       `json:"last_login"`
 }
 
 // AdminLogin godoc
 // @Summary Admin login
-// @Description Authenticate admin user and get JWT token
+// @Description Authenticate admin user and get JWT token. Admins with two-factor authentication get a TwoFactorChallengeResponse instead and finish signing in at /admin/auth/2fa
 // @Tags admin,auth
 // @Accept json
 // @Produce json
@@ -41,6 +63,7 @@ type AdminUserResponse struct {
 // @Success 200 {object} LoginResponse
 // @Failure 400 {object} map[string]interface{} "Invalid request"
 // @Failure 401 {object} map[string]interface{} "Invalid credentials"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /admin/auth/login [post]
 func AdminLogin(c *gin.Context) {
@@ -55,9 +78,15 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
+	// Slow down and lock out repeated guessing
+	if loginThrottled(c, req.Email, nil) {
+		return
+	}
+
 	// Find admin user
 	var admin models.AdminUser
 	if err := models.DB.Where("email = ? AND is_active = true", req.Email).First(&admin).Error; err != nil {
+		recordFailedLogin(c, req.Email, nil, models.LoginUnknownAccount)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"error":   "Invalid credentials",
@@ -67,6 +96,7 @@ func AdminLogin(c *gin.Context) {
 
 	// Check password
 	if !admin.CheckPassword(req.Password) {
+		recordFailedLogin(c, req.Email, &admin.ID, models.LoginBadPassword)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"error":   "Invalid credentials",
@@ -74,21 +104,37 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
-	// Create JWT service with config
-	jwtService := services.NewJWTService(config.AppConfig.JWT.Secret)
-
-	// Generate JWT token
-	token, err := jwtService.GenerateToken(&admin)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to generate token",
+	// Admins with two-factor authentication finish signing in with a code,
+	// which is throttled on its own
+	if admin.TOTPEnabled {
+		releaseLoginAttempt(req.Email)
+		challenge, err := models.IssueAdminToken(models.DB, admin.ID, models.TokenTwoFactor, config.AppConfig.Admin.TwoFactorChallengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to start two-factor login",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+			Success:           true,
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(config.AppConfig.Admin.TwoFactorChallengeTTL.Seconds()),
+			Message:           "Enter the code from your authenticator app or a recovery code",
 		})
 		return
 	}
 
-	// Store session
-	if err := jwtService.StoreSession(admin.ID, token); err != nil {
+	recordSuccessfulLogin(req.Email)
+	completeAdminLogin(c, &admin)
+}
+
+// completeAdminLogin starts a session for an admin who has proven who they
+// are and sends the login response.
+func completeAdminLogin(c *gin.Context, admin *models.AdminUser) {
+	pair, err := newAdminSession(c, admin)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Failed to create session",
@@ -99,26 +145,124 @@ func AdminLogin(c *gin.Context) {
 	// Update last login
 	now := time.Now()
 	admin.LastLogin = &now
-	models.DB.Save(&admin)
+	models.DB.Model(admin).Update("last_login", now)
+
+	message := "Login successful"
+	if admin.MustChangePassword {
+		message = "Login successful, please change your password to continue"
+	} else if admin.NeedsTwoFactorSetup() {
+		message = "Login successful, please set up two-factor authentication to continue"
+	}
 
 	// Return response
-	c.JSON(http.StatusOK, LoginResponse{
-		Success: true,
-		Token:   token,
-		Admin: AdminUserResponse{
-			ID:        admin.ID,
-			Email:     admin.Email,
-			Role:      admin.Role,
-			IsActive:  admin.IsActive,
-			LastLogin: admin.LastLogin,
-		},
-		Message: "Login successful",
-	})
+	c.JSON(http.StatusOK, loginResponse(pair, admin, message))
+}
+
+// newJWTService returns the JWT service with session lifetimes from config.
+func newJWTService() *services.JWTService {
+	cfg := config.AppConfig.JWT
+	return services.NewJWTService(services.JWTKeys()).
+		WithSessionTTLs(cfg.AccessTokenTTL, cfg.RefreshTokenTTL, cfg.SessionMaxAge)
+}
+
+// newAdminSession signs admin in with a new access and refresh token.
+func newAdminSession(c *gin.Context, admin *models.AdminUser) (*services.TokenPair, error) {
+	return newJWTService().StartSession(admin, sessionClient(c))
+}
+
+func sessionClient(c *gin.Context) services.SessionClient {
+	return services.SessionClient{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+func loginResponse(pair *services.TokenPair, admin *models.AdminUser, message string) LoginResponse {
+	return LoginResponse{
+		Success:          true,
+		Token:            pair.AccessToken,
+		ExpiresIn:        int(time.Until(pair.ExpiresAt).Seconds()),
+		RefreshToken:     pair.RefreshToken,
+		RefreshExpiresAt: pair.RefreshExpiresAt,
+		Admin:            adminUserResponse(admin),
+		Message:          message,
+	}
+}
+
+// RefreshAdminToken godoc
+// @Summary Refresh admin token
+// @Description Exchange a refresh token for a new access and refresh token. Each refresh token works once; reusing one signs out the whole session
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "Refresh token"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Invalid, expired or reused refresh token"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/auth/refresh [post]
+func RefreshAdminToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	pair, admin, err := newJWTService().RefreshSession(req.RefreshToken, sessionClient(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			log.Printf("Refresh token reuse detected, session revoked")
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Refresh token was already used, please sign in again",
+			})
+		case errors.Is(err, services.ErrRefreshTokenInvalid):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Refresh token is invalid or expired, please sign in again",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to refresh session",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse(pair, admin, "Token refreshed"))
+}
+
+func adminUserResponse(admin *models.AdminUser) AdminUserResponse {
+	return AdminUserResponse{
+		ID:                 admin.ID,
+		Email:              admin.Email,
+		Role:               admin.Role,
+		IsActive:           admin.IsActive,
+		MustChangePassword: admin.MustChangePassword,
+		TwoFactorEnabled:   admin.TOTPEnabled,
+		LastLogin:          admin.LastLogin,
+	}
+}
+
+// GetJWKS godoc
+// @Summary Admin token public keys
+// @Description JSON Web Key Set of the public keys admin tokens are signed with, for verifying them elsewhere. Empty when tokens are signed with a shared secret (HS256)
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{} "JSON Web Key Set"
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	// Short cache so rotated keys are picked up quickly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": services.JWTKeys().JWKS()})
 }
 
 // AdminLogout godoc
 // @Summary Admin logout
-// @Description Logout admin user and revoke JWT token
+// @Description Logout admin user and revoke the JWT and its refresh token
 // @Tags admin,auth
 // @Accept json
 // @Produce json
@@ -142,11 +286,8 @@ func AdminLogout(c *gin.Context) {
 	// Extract token
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-	// Create JWT service
-	jwtService := services.NewJWTService(config.AppConfig.JWT.Secret)
-
-	// Revoke token
-	if err := jwtService.RevokeToken(tokenString); err != nil {
+	// Revoke the session and its refresh token
+	if err := newJWTService().RevokeToken(tokenString); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Failed to logout",
@@ -183,15 +324,13 @@ func GetAdminProfile(c *gin.Context) {
 		return
 	}
 
+	permissions, _ := models.RolePermissions(admin.Role)
+
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"admin": AdminUserResponse{
-			ID:        admin.ID,
-			Email:     admin.Email,
-			Role:      admin.Role,
-			IsActive:  admin.IsActive,
-			LastLogin: admin.LastLogin,
-		},
+		"success":     true,
+		"admin":       adminUserResponse(&admin),
+		"permissions": permissions,
+		"two_factor":  twoFactorStatus(&admin),
 	})
 }
 
@@ -213,6 +352,7 @@ func GetAdminStats(c *gin.Context) {
 		TotalOrders   int64          `json:"total_orders"`
 		TotalRevenue  float64        `json:"total_revenue"`
 		PendingOrders int64          `json:"pending_orders"`
+		LowStock      int64          `json:"low_stock_products"`
 		RecentOrders  []models.Order `json:"recent_orders"`
 	}
 
@@ -237,6 +377,11 @@ func GetAdminStats(c *gin.Context) {
 		Where("status = ?", models.OrderStatusPending).
 		Count(&stats.PendingOrders)
 
+	// Count products at or below their reorder threshold
+	models.DB.Model(&models.Product{}).
+		Where("stock <= reorder_threshold").
+		Count(&stats.LowStock)
+
 	// Get recent orders
 	models.DB.Preload("Items.Product").
 		Order("created_at desc").
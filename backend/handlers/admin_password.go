@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"admin@bjjstore.com"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// setAdminPassword stores a new password for admin, clears any pending
+// invite or forced rotation, and signs the admin out everywhere.
+func setAdminPassword(tx *gorm.DB, admin *models.AdminUser, password string) error {
+	if err := admin.HashPassword(password); err != nil {
+		return err
+	}
+	admin.InvitePending = false
+	admin.MustChangePassword = false
+	if err := tx.Model(admin).Updates(map[string]interface{}{
+		"password_hash":        admin.PasswordHash,
+		"invite_pending":       false,
+		"must_change_password": false,
+	}).Error; err != nil {
+		return err
+	}
+	return models.RevokeAdminSessions(tx, admin.ID)
+}
+
+// sendPasswordResetEmail emails an admin the link to reset their password.
+func sendPasswordResetEmail(admin *models.AdminUser, token string) {
+	site := config.AppConfig.Site
+	body := fmt.Sprintf("Someone asked to reset the password for your %s admin account.\n\n"+
+		"Choose a new password here:\n%s\n\nThe link expires in %s. If you did not ask for this, you can ignore this email.",
+		site.Brand, adminLink("/reset-password", token), config.AppConfig.Admin.PasswordResetTTL)
+
+	err := newMailer().Send(context.Background(), services.Email{
+		To:      admin.Email,
+		Subject: "Reset your " + site.Brand + " admin password",
+		Body:    body,
+	})
+	if err != nil {
+		log.Printf("Failed to email password reset to admin %d: %v", admin.ID, err)
+	}
+}
+
+// ChangeAdminPassword godoc
+// @Summary Change password
+// @Description Change the signed-in admin's password. Every existing session is revoked and a new token is returned
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param password body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]interface{} "Invalid request or weak password"
+// @Failure 401 {object} map[string]interface{} "Unauthorized or wrong current password"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/password [put]
+func ChangeAdminPassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var admin models.AdminUser
+	if err := models.DB.First(&admin, c.GetUint("admin_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Admin not found",
+		})
+		return
+	}
+	if !admin.CheckPassword(req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Current password is incorrect",
+		})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "New password must be different from the current one",
+		})
+		return
+	}
+	if err := models.ValidatePassword(req.NewPassword, admin.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Password is too weak",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		return setAdminPassword(tx, &admin, req.NewPassword)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to change password",
+		})
+		return
+	}
+
+	// The old sessions are gone, so keep this client signed in with a new one
+	pair, err := newAdminSession(c, &admin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Password changed but failed to create a new session, please sign in again",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse(pair, &admin, "Password changed, other sessions have been signed out"))
+}
+
+// ForgotAdminPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use password reset link to an admin. The response is the same whether or not the email belongs to an admin
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Admin email"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Router /admin/auth/forgot-password [post]
+func ForgotAdminPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Do not reveal which emails belong to admins
+	response := gin.H{
+		"success": true,
+		"message": "If that email belongs to an admin, a reset link has been sent",
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	var admin models.AdminUser
+	if err := models.DB.Where("LOWER(email) = ? AND is_active = ? AND invite_pending = ?", email, true, false).
+		First(&admin).Error; err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := models.IssueAdminToken(models.DB, admin.ID, models.TokenPasswordReset, config.AppConfig.Admin.PasswordResetTTL)
+	if err != nil {
+		log.Printf("Failed to create password reset token for admin %d: %v", admin.ID, err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	sendPasswordResetEmail(&admin, token)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetAdminPassword godoc
+// @Summary Reset password
+// @Description Set a new password using the token from a reset email. The token can only be used once and every existing session is revoked
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid request, token or weak password"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/auth/reset-password [post]
+func ResetAdminPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var admin models.AdminUser
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := models.ConsumeAdminToken(tx, req.Token, models.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("is_active = ?", true).First(&admin, token.AdminID).Error; err != nil {
+			return models.ErrTokenInvalid
+		}
+		if err := models.ValidatePassword(req.Password, admin.Email); err != nil {
+			return err
+		}
+		return setAdminPassword(tx, &admin, req.Password)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTokenInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Reset link is invalid or has expired",
+			})
+		case errors.Is(err, models.ErrWeakPassword):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Password is too weak",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to reset password",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password reset, you can now sign in as " + admin.Email,
+	})
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionResponse is one place an admin is signed in.
+type SessionResponse struct {
+	ID         string     `json:"id" example:"9f86d081884c7d659a2feaa0c55ad015"`
+	IPAddress  string     `json:"ip_address" example:"203.0.113.7"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"` // when the admin signed in
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"` // when the session ends unless refreshed
+	Current    bool       `json:"current"`
+}
+
+func sessionResponses(sessions []models.AdminSession, current string) []SessionResponse {
+	responses := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		expires := s.RefreshExpiresAt
+		if s.ExpiresAt.After(expires) {
+			expires = s.ExpiresAt
+		}
+		responses = append(responses, SessionResponse{
+			ID:         s.FamilyID,
+			IPAddress:  s.IPAddress,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.AuthenticatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  expires,
+			Current:    current != "" && s.FamilyID == current,
+		})
+	}
+	return responses
+}
+
+// revokeAdminSession revokes one of an admin's sessions, reporting false if
+// it is not one of theirs.
+func revokeAdminSession(adminID uint, familyID string) (bool, error) {
+	result := models.DB.Model(&models.AdminSession{}).
+		Where("admin_id = ? AND family_id = ? AND is_revoked = ?", adminID, familyID, false).
+		Update("is_revoked", true)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetAdminSessions godoc
+// @Summary List my sessions
+// @Description List the devices the signed-in admin is signed in on
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Sessions"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/sessions [get]
+func GetAdminSessions(c *gin.Context) {
+	sessions, err := models.ActiveAdminSessions(models.DB, c.GetUint("admin_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"sessions": sessionResponses(sessions, c.GetString("session_family")),
+	})
+}
+
+// RevokeMySession godoc
+// @Summary Sign out a session
+// @Description Sign out one of the signed-in admin's sessions
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "Session not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/sessions/{id} [delete]
+func RevokeMySession(c *gin.Context) {
+	found, err := revokeAdminSession(c.GetUint("admin_id"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session signed out"})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Sign out everywhere else
+// @Description Sign out every session of the signed-in admin except the current one
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Number of sessions signed out"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/sessions [delete]
+func RevokeOtherSessions(c *gin.Context) {
+	result := models.DB.Model(&models.AdminSession{}).
+		Where("admin_id = ? AND family_id <> ? AND is_revoked = ?", c.GetUint("admin_id"), c.GetString("session_family"), false).
+		Update("is_revoked", true)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Signed out of all other sessions",
+		"revoked": result.RowsAffected,
+	})
+}
+
+// GetAdminUserSessions godoc
+// @Summary List an admin's sessions (Super admin only)
+// @Description List the devices an admin is signed in on
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} map[string]interface{} "Sessions"
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/sessions [get]
+func GetAdminUserSessions(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := models.ActiveAdminSessions(models.DB, admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"sessions": sessionResponses(sessions, ""),
+	})
+}
+
+// RevokeAdminUserSession godoc
+// @Summary Sign out one of an admin's sessions (Super admin only)
+// @Description Sign out a single session of another admin
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param sessionId path string true "Session ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin or session not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/sessions/{sessionId} [delete]
+func RevokeAdminUserSession(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	found, err := revokeAdminSession(admin.ID, c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session signed out"})
+}
+
+// RevokeAdminUserSessions godoc
+// @Summary Sign out an admin everywhere (Super admin only)
+// @Description Sign out every session of another admin
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/sessions [delete]
+func RevokeAdminUserSessions(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	if err := models.RevokeAdminSessions(models.DB, admin.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signed " + admin.Email + " out of all sessions"})
+}
@@ -0,0 +1,571 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type InviteAdminRequest struct {
+	Email string           `json:"email" binding:"required,email" example:"coach@bjjstore.com"`
+	Role  models.AdminRole `json:"role" binding:"required" example:"order_manager"`
+}
+
+type UpdateAdminRoleRequest struct {
+	Role models.AdminRole `json:"role" binding:"required" example:"inventory"`
+}
+
+type AcceptInviteRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+var errLastSuperAdmin = errors.New("cannot remove the last active super admin")
+
+// adminLink builds a link into the admin panel carrying a token.
+func adminLink(path, token string) string {
+	return strings.TrimRight(config.AppConfig.Admin.PanelURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendInviteEmail emails an invited admin the link to set their password.
+func sendInviteEmail(admin *models.AdminUser, token string) {
+	site := config.AppConfig.Site
+	body := fmt.Sprintf("You have been invited to the %s admin panel as %s.\n\n"+
+		"Set your password here to get started:\n%s\n\nThe link expires in %s.",
+		site.Brand, admin.Role, adminLink("/accept-invite", token), config.AppConfig.Admin.InviteTTL)
+
+	err := newMailer().Send(context.Background(), services.Email{
+		To:      admin.Email,
+		Subject: "You're invited to the " + site.Brand + " admin panel",
+		Body:    body,
+	})
+	if err != nil {
+		log.Printf("Failed to email invite to admin %d: %v", admin.ID, err)
+	}
+}
+
+// loadManagedAdmin loads the admin in the :id parameter for a management
+// action, refusing actions on the caller's own account and on admins whose
+// role the caller's own role does not cover.
+func loadManagedAdmin(c *gin.Context) (*models.AdminUser, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid admin ID"})
+		return nil, false
+	}
+	if uint(id) == c.GetUint("admin_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own account here"})
+		return nil, false
+	}
+
+	var admin models.AdminUser
+	if err := models.DB.First(&admin, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+		return nil, false
+	}
+	if !roleAssignable(c, admin.Role) {
+		return nil, false
+	}
+	return &admin, true
+}
+
+// roleAssignable checks that the signed-in admin's own role covers role,
+// so nobody can hand out more access than they have.
+func roleAssignable(c *gin.Context, role models.AdminRole) bool {
+	covered, err := models.RoleCovers(c.MustGet("admin_role").(models.AdminRole), role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !covered {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You cannot manage admins with permissions your own role does not have",
+			"role":  role,
+		})
+		return false
+	}
+	return true
+}
+
+// ensureOtherSuperAdmin fails with errLastSuperAdmin if admin is the only
+// active super admin left.
+func ensureOtherSuperAdmin(tx *gorm.DB, admin *models.AdminUser) error {
+	if admin.Role != models.RoleSuperAdmin || !admin.IsActive {
+		return nil
+	}
+	var others int64
+	if err := tx.Model(&models.AdminUser{}).
+		Where("role = ? AND is_active = ? AND id <> ?", models.RoleSuperAdmin, true, admin.ID).
+		Count(&others).Error; err != nil {
+		return err
+	}
+	if others == 0 {
+		return errLastSuperAdmin
+	}
+	return nil
+}
+
+// GetAdminUsers godoc
+// @Summary List admin users (Super admin only)
+// @Description List all admin users with their role and status
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param role query string false "Filter by role"
+// @Success 200 {object} map[string]interface{} "Admin users"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins [get]
+func GetAdminUsers(c *gin.Context) {
+	query := models.DB.Model(&models.AdminUser{})
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	var admins []models.AdminUser
+	if err := query.Order("id asc").Find(&admins).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch admins"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"admins":  admins,
+	})
+}
+
+// InviteAdminUser godoc
+// @Summary Invite an admin user (Super admin only)
+// @Description Create an admin account with the given role and email an invite link to set a password. The role cannot grant more than the caller's own
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param invite body InviteAdminRequest true "Invite"
+// @Success 201 {object} models.AdminUser
+// @Failure 400 {object} map[string]interface{} "Invalid request or unknown role"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 409 {object} map[string]interface{} "Email already in use"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins [post]
+func InviteAdminUser(c *gin.Context) {
+	var req InviteAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid invite",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !models.RoleExists(models.DB, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if !roleAssignable(c, req.Role) {
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	var existing models.AdminUser
+	err := models.DB.Unscoped().Where("LOWER(email) = ?", email).First(&existing).Error
+	if err == nil && !existing.DeletedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "An admin with this email already exists"})
+		return
+	}
+
+	admin := models.AdminUser{
+		Email:         email,
+		Role:          req.Role,
+		IsActive:      true,
+		InvitePending: true,
+	}
+	if adminID := c.GetUint("admin_id"); adminID != 0 {
+		admin.InvitedBy = &adminID
+	}
+
+	var token string
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if existing.ID != 0 {
+			// Re-inviting someone whose account was deleted brings it back
+			admin.ID = existing.ID
+			admin.CreatedAt = existing.CreatedAt
+			if err := tx.Unscoped().Model(&existing).Updates(map[string]interface{}{
+				"deleted_at":           nil,
+				"password_hash":        "",
+				"role":                 admin.Role,
+				"is_active":            true,
+				"invite_pending":       true,
+				"must_change_password": false,
+				"invited_by":           admin.InvitedBy,
+				"last_login":           nil,
+			}).Error; err != nil {
+				return err
+			}
+			// Nothing from the old account may carry over to the new invitee
+			if err := clearTwoFactor(tx, existing.ID); err != nil {
+				return err
+			}
+			if err := models.RevokeAdminSessions(tx, existing.ID); err != nil {
+				return err
+			}
+			if err := models.RevokeAdminAPIKeys(tx, existing.ID); err != nil {
+				return err
+			}
+			if err := tx.Model(&models.AdminToken{}).
+				Where("admin_id = ? AND used_at IS NULL", existing.ID).
+				Update("used_at", time.Now()).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Create(&admin).Error; err != nil {
+			return err
+		}
+
+		var err error
+		token, err = models.IssueAdminToken(tx, admin.ID, models.TokenInvite, config.AppConfig.Admin.InviteTTL)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invite admin"})
+		return
+	}
+	sendInviteEmail(&admin, token)
+
+	models.DB.First(&admin, admin.ID)
+	c.JSON(http.StatusCreated, admin)
+}
+
+// ResendAdminInvite godoc
+// @Summary Resend an admin invite (Super admin only)
+// @Description Email a new invite link to an admin who has not accepted yet. Earlier links stop working
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 409 {object} map[string]interface{} "Invite already accepted"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/invite [post]
+func ResendAdminInvite(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+	if !admin.InvitePending {
+		c.JSON(http.StatusConflict, gin.H{"error": "This admin has already accepted their invite"})
+		return
+	}
+
+	token, err := models.IssueAdminToken(adminDB(c), admin.ID, models.TokenInvite, config.AppConfig.Admin.InviteTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+	sendInviteEmail(admin, token)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invite sent to " + admin.Email,
+	})
+}
+
+// UpdateAdminRole godoc
+// @Summary Change an admin's role (Super admin only)
+// @Description Assign a different role. The admin's sessions are revoked so they sign in again with the new role. Callers can only move admins between roles their own role covers
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param role body UpdateAdminRoleRequest true "Role"
+// @Success 200 {object} models.AdminUser
+// @Failure 400 {object} map[string]interface{} "Invalid request or unknown role"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 409 {object} map[string]interface{} "Last super admin"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/role [put]
+func UpdateAdminRole(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAdminRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid role",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !models.RoleExists(models.DB, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+	if req.Role == admin.Role {
+		c.JSON(http.StatusOK, admin)
+		return
+	}
+	if !roleAssignable(c, req.Role) {
+		return
+	}
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := ensureOtherSuperAdmin(tx, admin); err != nil {
+			return err
+		}
+		if err := tx.Model(admin).Update("role", req.Role).Error; err != nil {
+			return err
+		}
+		// Tokens carry the role, so make the admin sign in again
+		return models.RevokeAdminSessions(tx, admin.ID)
+	})
+	if err != nil {
+		if errors.Is(err, errLastSuperAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot change the role of the last active super admin"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, admin)
+}
+
+// DeactivateAdminUser godoc
+// @Summary Deactivate an admin user (Super admin only)
+// @Description Block an admin from signing in and revoke all their sessions immediately
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} models.AdminUser
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 409 {object} map[string]interface{} "Last super admin"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/deactivate [put]
+func DeactivateAdminUser(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := ensureOtherSuperAdmin(tx, admin); err != nil {
+			return err
+		}
+		if err := tx.Model(admin).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return models.RevokeAdminSessions(tx, admin.ID)
+	})
+	if err != nil {
+		if errors.Is(err, errLastSuperAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot deactivate the last active super admin"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate admin"})
+		return
+	}
+
+	c.JSON(http.StatusOK, admin)
+}
+
+// ActivateAdminUser godoc
+// @Summary Reactivate an admin user (Super admin only)
+// @Description Allow a deactivated admin to sign in again
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} models.AdminUser
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/activate [put]
+func ActivateAdminUser(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	if err := adminDB(c).Model(admin).Update("is_active", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate admin"})
+		return
+	}
+
+	c.JSON(http.StatusOK, admin)
+}
+
+// DeleteAdminUser godoc
+// @Summary Delete an admin user (Super admin only)
+// @Description Delete an admin account and revoke all their sessions and API keys. Their past actions stay attributed to them
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 409 {object} map[string]interface{} "Last super admin"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id} [delete]
+func DeleteAdminUser(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := ensureOtherSuperAdmin(tx, admin); err != nil {
+			return err
+		}
+		if err := models.RevokeAdminSessions(tx, admin.ID); err != nil {
+			return err
+		}
+		if err := models.RevokeAdminAPIKeys(tx, admin.ID); err != nil {
+			return err
+		}
+		return tx.Delete(admin).Error
+	})
+	if err != nil {
+		if errors.Is(err, errLastSuperAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the last active super admin"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete admin"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Admin deleted successfully"})
+}
+
+// ResetAdminTwoFactor godoc
+// @Summary Reset an admin's two-factor authentication (Super admin only)
+// @Description Remove an admin's authenticator and recovery codes, e.g. after a lost phone, and revoke their sessions. If their role requires two-factor authentication they set it up again on next sign in
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/2fa [delete]
+func ResetAdminTwoFactor(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := clearTwoFactor(tx, admin.ID); err != nil {
+			return err
+		}
+		return models.RevokeAdminSessions(tx, admin.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset for " + admin.Email})
+}
+
+// AcceptAdminInvite godoc
+// @Summary Accept an admin invite
+// @Description Set a password using the token from an invite email. The token can only be used once
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param invite body AcceptInviteRequest true "Invite token and new password"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid request, token or weak password"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/auth/accept-invite [post]
+func AcceptAdminInvite(c *gin.Context) {
+	var req AcceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var admin models.AdminUser
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := models.ConsumeAdminToken(tx, req.Token, models.TokenInvite)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&admin, token.AdminID).Error; err != nil {
+			return models.ErrTokenInvalid
+		}
+		if err := models.ValidatePassword(req.Password, admin.Email); err != nil {
+			return err
+		}
+		return setAdminPassword(tx, &admin, req.Password)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTokenInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invite link is invalid or has expired",
+			})
+		case errors.Is(err, models.ErrWeakPassword):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Password is too weak",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to accept invite",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password set, you can now sign in as " + admin.Email,
+	})
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=100" example:"Inventory sync"`
+	// Permissions the key may use, from the permission catalog
+	Scopes []string `json:"scopes" binding:"required,min=1" example:"view_inventory,manage_inventory"`
+	// Defaults to admin.api_key_ttl
+	ExpiresInDays int `json:"expires_in_days" binding:"omitempty,min=1,max=3650" example:"90"`
+}
+
+// GetAPIKeys godoc
+// @Summary List API keys (Admin only)
+// @Description List API keys with their scopes, expiry and last use. Keys themselves are never shown again after creation
+// @Tags admin,api-keys
+// @Accept json
+// @Produce json
+// @Param admin_id query int false "Filter by owning admin"
+// @Param include_revoked query bool false "Include revoked keys"
+// @Success 200 {object} map[string]interface{} "API keys"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/api-keys [get]
+func GetAPIKeys(c *gin.Context) {
+	query := models.DB.Model(&models.APIKey{})
+	if adminID := c.Query("admin_id"); adminID != "" {
+		query = query.Where("admin_id = ?", adminID)
+	}
+	if c.Query("include_revoked") != "true" {
+		query = query.Where("revoked_at IS NULL")
+	}
+
+	var keys []models.APIKey
+	if err := query.Order("id desc").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"api_keys": keys,
+	})
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key (Admin only)
+// @Description Create an API key for scripts to call the admin API as the signed-in admin, limited to the given scopes. Send it as "Authorization: Bearer <key>" or in the X-API-Key header. The key is only shown in this response
+// @Tags admin,api-keys
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "API key"
+// @Success 201 {object} map[string]interface{} "The key and its details"
+// @Failure 400 {object} map[string]interface{} "Invalid request or unknown scopes"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or scopes beyond your role"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid API key",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	scopes := make(models.APIKeyScopes, 0, len(req.Scopes))
+	seen := make(map[string]bool, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	_, unknown, err := lookupPermissions(scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":               "Unknown permissions",
+			"unknown_permissions": unknown,
+		})
+		return
+	}
+
+	// A key can never do more than the admin who creates it
+	role := c.MustGet("admin_role").(models.AdminRole)
+	var beyondRole []string
+	for _, scope := range scopes {
+		allowed, err := models.RoleHasPermission(role, scope)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !allowed {
+			beyondRole = append(beyondRole, scope)
+		}
+	}
+	if len(beyondRole) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":              "Scopes go beyond your role",
+			"scopes_not_allowed": beyondRole,
+		})
+		return
+	}
+
+	ttl := config.AppConfig.Admin.APIKeyTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+	key := models.APIKey{
+		Name:      req.Name,
+		Scopes:    scopes,
+		AdminID:   c.GetUint("admin_id"),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	plain, err := models.IssueAPIKey(adminDB(c), &key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	log.Printf("API key %s (%s) created by %s", key.Prefix, key.Name, c.GetString("admin_email"))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Store this key now, it will not be shown again",
+		"key":     plain,
+		"api_key": key,
+	})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key (Admin only)
+// @Description Revoke an API key straight away. Revoked keys stay listed with include_revoked for the record
+// @Tags admin,api-keys
+// @Accept json
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid API key ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "API key not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	var key models.APIKey
+	if err := models.DB.Where("revoked_at IS NULL").First(&key, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if err := adminDB(c).Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	log.Printf("API key %s (%s) revoked by %s", key.Prefix, key.Name, c.GetString("admin_email"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "API key revoked",
+	})
+}
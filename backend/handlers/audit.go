@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// adminDB returns the database handle for an admin request. Changes made
+// through it are recorded in the audit log against the signed-in admin.
+func adminDB(c *gin.Context) *gorm.DB {
+	return models.DB.WithContext(c.Request.Context())
+}
+
+// GetAuditLogs godoc
+// @Summary Audit log (Super admin only)
+// @Description Changes made by admins, newest first, with the values before and after each change
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param admin_id query int false "Filter by admin ID"
+// @Param action query string false "Filter by action (create, update, delete, request)"
+// @Param entity_type query string false "Filter by entity type, e.g. products or orders"
+// @Param entity_id query string false "Filter by entity ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Success 200 {object} map[string]interface{} "Audit entries with pagination"
+// @Failure 400 {object} map[string]interface{} "Invalid date"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/audit [get]
+func GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := models.DB.Model(&models.AuditLog{})
+	if adminID := c.Query("admin_id"); adminID != "" {
+		query = query.Where("admin_id = ?", adminID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, use YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, use YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at < ?", t.AddDate(0, 0, 1))
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var entries []models.AuditLog
+	if err := query.Order("id desc").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BundleItemRequest struct {
+	ProductID uint   `json:"product_id" binding:"required" example:"3"`
+	Quantity  int    `json:"quantity" binding:"required,min=1" example:"1"`
+	Size      string `json:"size" example:"A2"`
+}
+
+type SetBundleItemsRequest struct {
+	// Components of the bundle; an empty list turns the bundle back into a
+	// regular product
+	Items []BundleItemRequest `json:"items" binding:"dive"`
+}
+
+// SetBundleItems godoc
+// @Summary Set the components of a bundle (Admin only)
+// @Description Replace the component products of a bundle. The bundle's price is its own Price; its stock is the number of complete bundles the components in stock can make up, and paying for a bundle takes stock from the components
+// @Tags admin,products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param bundle body SetBundleItemsRequest true "Components"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Product not found"
+// @Failure 409 {object} map[string]interface{} "Product cannot be made a bundle"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/products/{id}/bundle-items [put]
+func SetBundleItems(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req SetBundleItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid bundle",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var product models.Product
+	if err := models.DB.First(&product, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if len(req.Items) > 0 && !product.IsBundle {
+		// A bundle's stock is derived, so it cannot also hold stock of its own
+		if product.Stock != 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Adjust the product's own stock to zero before making it a bundle",
+				"stock": product.Stock,
+			})
+			return
+		}
+		var usedIn int64
+		models.DB.Model(&models.BundleItem{}).Where("component_id = ?", product.ID).Count(&usedIn)
+		if usedIn > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Product is a component of another bundle; bundles cannot be nested"})
+			return
+		}
+	}
+
+	items := make([]models.BundleItem, 0, len(req.Items))
+	seen := make(map[string]bool)
+	for _, r := range req.Items {
+		if r.ProductID == product.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A bundle cannot contain itself"})
+			return
+		}
+
+		var component models.Product
+		if err := models.DB.First(&component, r.ProductID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product with ID %d not found", r.ProductID)})
+			return
+		}
+		if component.IsBundle {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is a bundle; bundles cannot be nested", component.Name)})
+			return
+		}
+
+		size := strings.TrimSpace(r.Size)
+		if size != "" {
+			valid := false
+			for _, option := range component.GetSizeOptionsArray() {
+				if strings.EqualFold(option, size) {
+					size = option
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":       fmt.Sprintf("Invalid size for %s", component.Name),
+					"valid_sizes": component.GetSizeOptionsArray(),
+				})
+				return
+			}
+		}
+
+		key := fmt.Sprintf("%d/%s", component.ID, size)
+		if seen[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is listed more than once", component.Name)})
+			return
+		}
+		seen[key] = true
+
+		items = append(items, models.BundleItem{
+			BundleID:    product.ID,
+			ComponentID: component.ID,
+			Quantity:    r.Quantity,
+			Size:        size,
+		})
+	}
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bundle_id = ?", product.ID).Delete(&models.BundleItem{}).Error; err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			if err := tx.Create(&items).Error; err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{"is_bundle": len(items) > 0}
+		if len(items) == 0 && product.IsBundle {
+			// Back to a regular product with no stock of its own
+			updates["stock"] = 0
+		}
+		if err := tx.Model(&product).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		return models.RefreshBundleStock(tx, product.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bundle"})
+		return
+	}
+	services.QueueBackInStockCheck(product.ID)
+
+	models.DB.Preload("BundleItems", orderBundleItems).Preload("BundleItems.Component").First(&product, product.ID)
+	c.JSON(http.StatusOK, product)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// catalogFeed caches the rendered sitemap and product feeds between requests
+var catalogFeed = services.NewCatalogFeed()
+
+func feedSettings() services.FeedSettings {
+	site := config.AppConfig.Site
+	return services.FeedSettings{
+		BaseURL:  site.BaseURL,
+		Brand:    site.Brand,
+		Currency: site.Currency,
+	}
+}
+
+// serveFeed writes doc with caching headers, answering 304 when the client
+// already has the current version.
+func serveFeed(c *gin.Context, doc *services.FeedDocument, err error, contentType string) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
+		return
+	}
+
+	c.Header("ETag", doc.ETag)
+	c.Header("Cache-Control", "public, max-age=300")
+	if !doc.LastModified.IsZero() {
+		c.Header("Last-Modified", doc.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	for _, tag := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		if strings.TrimSpace(tag) == doc.ETag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, contentType, doc.Body)
+}
+
+// GetSitemap godoc
+// @Summary Sitemap
+// @Description sitemap.xml listing the storefront home page, categories and active products
+// @Tags feeds
+// @Produce xml
+// @Success 200 {string} string "Sitemap XML"
+// @Success 304 {string} string "Not modified"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /sitemap.xml [get]
+func GetSitemap(c *gin.Context) {
+	doc, err := catalogFeed.Sitemap(feedSettings())
+	serveFeed(c, doc, err, "application/xml; charset=utf-8")
+}
+
+// GetProductFeedXML godoc
+// @Summary Product feed (XML)
+// @Description Google Merchant Center RSS 2.0 product feed
+// @Tags feeds
+// @Produce xml
+// @Success 200 {string} string "Product feed XML"
+// @Success 304 {string} string "Not modified"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /feeds/products.xml [get]
+func GetProductFeedXML(c *gin.Context) {
+	doc, err := catalogFeed.ProductsXML(feedSettings())
+	serveFeed(c, doc, err, "application/xml; charset=utf-8")
+}
+
+// GetProductFeedCSV godoc
+// @Summary Product feed (CSV)
+// @Description Google Merchant Center product feed as CSV
+// @Tags feeds
+// @Produce text/csv
+// @Success 200 {string} string "Product feed CSV"
+// @Success 304 {string} string "Not modified"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /feeds/products.csv [get]
+func GetProductFeedCSV(c *gin.Context) {
+	doc, err := catalogFeed.ProductsCSV(feedSettings())
+	serveFeed(c, doc, err, "text/csv; charset=utf-8")
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type GiftCardBalanceRequest struct {
+	Code string `json:"code" binding:"required" example:"7KQ2-M8XP-3HTR-ZW4N"`
+}
+
+type PurchaseGiftCardRequest struct {
+	Amount         float64 `json:"amount" binding:"required,gt=0" example:"100.00"`
+	PurchaserEmail string  `json:"purchaser_email" binding:"required,email" example:"customer@example.com"`
+	RecipientEmail string  `json:"recipient_email" binding:"required,email" example:"friend@example.com"`
+	Message        string  `json:"message" binding:"max=500" example:"Happy birthday, see you on the mats!"`
+	CardNumber     string  `json:"card_number" binding:"required"`
+	ExpiryDate     string  `json:"expiry_date" binding:"required"`
+	CVV            string  `json:"cvv" binding:"required"`
+	NameOnCard     string  `json:"name_on_card" binding:"required"`
+}
+
+type IssueGiftCardRequest struct {
+	Amount         float64             `json:"amount" binding:"required,gt=0" example:"25.00"`
+	Kind           models.GiftCardKind `json:"kind" example:"store_credit"`
+	RecipientEmail string              `json:"recipient_email" binding:"required,email" example:"customer@example.com"`
+	ExpiresAt      *time.Time          `json:"expires_at"` // defaults from gift_cards config
+	Message        string              `json:"message" example:"Sorry about the delayed shipment"`
+	Note           string              `json:"note" example:"Goodwill credit for order BJJ-1753519000"`
+	SendEmail      bool                `json:"send_email" example:"true"`
+}
+
+// giftCardExpiry returns the default expiry for a new card of kind
+func giftCardExpiry(kind models.GiftCardKind) *time.Time {
+	cfg := config.AppConfig.GiftCards
+	expiry := cfg.Expiry
+	if kind == models.GiftCardStoreCredit {
+		expiry = cfg.StoreCreditExpiry
+	}
+	if expiry <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(expiry)
+	return &expiresAt
+}
+
+// sendGiftCardEmail delivers a new card's code to its recipient. The code is
+// only ever shown here and in the issuing response.
+func sendGiftCardEmail(card *models.GiftCard, code string) {
+	site := config.AppConfig.Site
+
+	var body strings.Builder
+	if card.Kind == models.GiftCardStoreCredit {
+		fmt.Fprintf(&body, "You have %.2f %s of store credit at %s.\n\n", card.Balance, site.Currency, site.Brand)
+	} else {
+		from := card.PurchaserEmail
+		if from == "" {
+			from = site.Brand
+		}
+		fmt.Fprintf(&body, "%s sent you a %.2f %s gift card for %s.\n\n", from, card.Balance, site.Currency, site.Brand)
+	}
+	if card.Message != "" {
+		fmt.Fprintf(&body, "%s\n\n", card.Message)
+	}
+	fmt.Fprintf(&body, "Your code: %s\n", code)
+	if card.ExpiresAt != nil {
+		fmt.Fprintf(&body, "Valid until: %s\n", card.ExpiresAt.Format("January 2, 2006"))
+	}
+	fmt.Fprintf(&body, "\nEnter the code at checkout on %s to use it.", site.BaseURL)
+
+	subject := "Your " + site.Brand + " gift card"
+	if card.Kind == models.GiftCardStoreCredit {
+		subject = "Your " + site.Brand + " store credit"
+	}
+
+	err := newMailer().Send(context.Background(), services.Email{
+		To:      card.RecipientEmail,
+		Subject: subject,
+		Body:    body.String(),
+	})
+	if err != nil {
+		log.Printf("Failed to email gift card %d: %v", card.ID, err)
+	}
+}
+
+// CheckGiftCardBalance godoc
+// @Summary Check a gift card balance
+// @Description Look up the remaining balance and expiry of a gift card or store credit code
+// @Tags gift-cards
+// @Accept json
+// @Produce json
+// @Param code body GiftCardBalanceRequest true "Gift card code"
+// @Success 200 {object} map[string]interface{} "Balance"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "Gift card not found"
+// @Router /gift-cards/balance [post]
+func CheckGiftCardBalance(c *gin.Context) {
+	var req GiftCardBalanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	card, err := models.FindGiftCard(models.DB, req.Code)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	status := "active"
+	if err := card.Usable(); errors.Is(err, models.ErrGiftCardExpired) {
+		status = "expired"
+	} else if err != nil {
+		status = "disabled"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"last4":      card.Last4,
+		"kind":       card.Kind,
+		"balance":    card.Balance,
+		"expires_at": card.ExpiresAt,
+		"status":     status,
+	})
+}
+
+// PurchaseGiftCard godoc
+// @Summary Buy a digital gift card
+// @Description Pay for a gift card by card; the code is emailed to the recipient
+// @Tags gift-cards
+// @Accept json
+// @Produce json
+// @Param purchase body PurchaseGiftCardRequest true "Gift card purchase"
+// @Success 201 {object} map[string]interface{} "Gift card issued"
+// @Failure 400 {object} map[string]interface{} "Invalid request or payment declined"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /gift-cards [post]
+func PurchaseGiftCard(c *gin.Context) {
+	var req PurchaseGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid gift card purchase",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	cfg := config.AppConfig.GiftCards
+	amount := models.RoundMoney(req.Amount)
+	if amount < cfg.MinAmount || amount > cfg.MaxAmount {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("Gift cards are available from %.2f to %.2f", cfg.MinAmount, cfg.MaxAmount),
+		})
+		return
+	}
+
+	if !mockChargeCard(c, req.CardNumber) {
+		return
+	}
+
+	card, code, err := models.IssueGiftCard(models.DB, models.GiftCardIssue{
+		Kind:           models.GiftCardPurchased,
+		Amount:         amount,
+		ExpiresAt:      giftCardExpiry(models.GiftCardPurchased),
+		RecipientEmail: req.RecipientEmail,
+		PurchaserEmail: req.PurchaserEmail,
+		Message:        strings.TrimSpace(req.Message),
+		Actor:          strings.ToLower(req.PurchaserEmail),
+		Note:           "Purchased",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to issue gift card",
+		})
+		return
+	}
+	sendGiftCardEmail(card, code)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":        true,
+		"message":        "Gift card sent to " + card.RecipientEmail,
+		"transaction_id": fmt.Sprintf("TXN-%d-GC%d", time.Now().Unix(), card.ID),
+		"gift_card":      card,
+	})
+}
+
+// GetGiftCards godoc
+// @Summary List gift cards (Admin only)
+// @Description List gift cards and store credit, newest first
+// @Tags admin,gift-cards
+// @Accept json
+// @Produce json
+// @Param kind query string false "Filter by kind (gift_card, store_credit)"
+// @Param email query string false "Filter by recipient email"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Gift cards with pagination"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/gift-cards [get]
+func GetGiftCards(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := models.DB.Model(&models.GiftCard{})
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if email := c.Query("email"); email != "" {
+		query = query.Where("recipient_email = ?", strings.ToLower(email))
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var cards []models.GiftCard
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Find(&cards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift cards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"gift_cards": cards,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetGiftCard godoc
+// @Summary Get a gift card (Admin only)
+// @Description Get a gift card with its ledger of issuances and redemptions
+// @Tags admin,gift-cards
+// @Accept json
+// @Produce json
+// @Param id path int true "Gift card ID"
+// @Success 200 {object} map[string]interface{} "Gift card and transactions"
+// @Failure 400 {object} map[string]interface{} "Invalid gift card ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Gift card not found"
+// @Security BearerAuth
+// @Router /admin/gift-cards/{id} [get]
+func GetGiftCard(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift card ID"})
+		return
+	}
+
+	var card models.GiftCard
+	if err := models.DB.First(&card, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	var transactions []models.GiftCardTransaction
+	models.DB.Where("gift_card_id = ?", card.ID).Order("id asc").Find(&transactions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"gift_card":    card,
+		"transactions": transactions,
+	})
+}
+
+// IssueGiftCard godoc
+// @Summary Issue a gift card or store credit (Admin only)
+// @Description Issue a gift card or store credit without payment, e.g. as a goodwill gesture. The code is returned once and optionally emailed to the recipient
+// @Tags admin,gift-cards
+// @Accept json
+// @Produce json
+// @Param gift_card body IssueGiftCardRequest true "Gift card"
+// @Success 201 {object} map[string]interface{} "Issued gift card and code"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/gift-cards [post]
+func IssueGiftCard(c *gin.Context) {
+	var req IssueGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid gift card",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if req.Kind == "" {
+		req.Kind = models.GiftCardStoreCredit
+	}
+	if req.Kind != models.GiftCardStoreCredit && req.Kind != models.GiftCardPurchased {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":       "Invalid gift card kind",
+			"valid_kinds": []models.GiftCardKind{models.GiftCardPurchased, models.GiftCardStoreCredit},
+		})
+		return
+	}
+
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil {
+		expiresAt = giftCardExpiry(req.Kind)
+	} else if expiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	issue := models.GiftCardIssue{
+		Kind:           req.Kind,
+		Amount:         req.Amount,
+		ExpiresAt:      expiresAt,
+		RecipientEmail: req.RecipientEmail,
+		Message:        strings.TrimSpace(req.Message),
+		Actor:          c.GetString("admin_email"),
+		Note:           req.Note,
+	}
+	if adminID := c.GetUint("admin_id"); adminID != 0 {
+		issue.AdminID = &adminID
+	}
+
+	card, code, err := models.IssueGiftCard(adminDB(c), issue)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+	if req.SendEmail {
+		sendGiftCardEmail(card, code)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":   true,
+		"gift_card": card,
+		"code":      code,
+	})
+}
+
+// DisableGiftCard godoc
+// @Summary Disable a gift card (Admin only)
+// @Description Block a gift card from further use, e.g. if its code was leaked. The remaining balance is voided in the ledger
+// @Tags admin,gift-cards
+// @Accept json
+// @Produce json
+// @Param id path int true "Gift card ID"
+// @Success 200 {object} models.GiftCard
+// @Failure 400 {object} map[string]interface{} "Invalid gift card ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Gift card not found"
+// @Failure 409 {object} map[string]interface{} "Gift card already disabled"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/gift-cards/{id}/disable [put]
+func DisableGiftCard(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift card ID"})
+		return
+	}
+
+	var card models.GiftCard
+	if err := models.DB.First(&card, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+	if card.DisabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Gift card is already disabled"})
+		return
+	}
+
+	change := models.GiftCardChange{
+		Type:  models.GiftCardVoided,
+		Actor: c.GetString("admin_email"),
+		Note:  "Card disabled",
+	}
+	if adminID := c.GetUint("admin_id"); adminID != 0 {
+		change.AdminID = &adminID
+	}
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if _, err := models.ApplyGiftCardChange(tx, card.ID, -card.Balance, change); err != nil {
+			return err
+		}
+		return tx.Model(&card).Update("disabled_at", time.Now()).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable gift card"})
+		return
+	}
+
+	models.DB.First(&card, card.ID)
+	c.JSON(http.StatusOK, card)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+type InventoryAdjustmentRequest struct {
+	ProductID uint                  `json:"product_id" binding:"required" example:"1"`
+	Delta     int                   `json:"delta" binding:"required" example:"-2"`
+	Reason    models.MovementReason `json:"reason" binding:"required" example:"adjustment"`
+	Note      string                `json:"note" binding:"required" example:"Two gis water damaged"`
+	// Location to adjust; defaults to the default location when adding stock
+	// and, when removing it, the preferred location holding enough or else
+	// several locations in priority order
+	LocationID *uint `json:"location_id" example:"1"`
+}
+
+// adminStockChange attributes a stock change to the admin making the request
+func adminStockChange(c *gin.Context, reason models.MovementReason, note string) models.StockChange {
+	change := models.StockChange{
+		Reason: reason,
+		Actor:  c.GetString("admin_email"),
+		Note:   note,
+	}
+	if adminID := c.GetUint("admin_id"); adminID != 0 {
+		change.AdminID = &adminID
+	}
+	return change
+}
+
+// CreateInventoryAdjustment godoc
+// @Summary Post a manual stock adjustment (Admin only)
+// @Description Add or remove stock for a product with a reason. Sales and cancellations are recorded automatically and cannot be posted manually
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Param adjustment body InventoryAdjustmentRequest true "Adjustment"
+// @Success 201 {object} models.InventoryMovement
+// @Failure 400 {object} map[string]interface{} "Invalid request or bundle product"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Product not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/inventory/adjustments [post]
+func CreateInventoryAdjustment(c *gin.Context) {
+	var req InventoryAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid adjustment",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	validReasons := []models.MovementReason{
+		models.MovementRestock,
+		models.MovementAdjustment,
+		models.MovementReturn,
+	}
+	valid := false
+	for _, reason := range validReasons {
+		if req.Reason == reason {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         "Invalid adjustment reason",
+			"valid_reasons": validReasons,
+		})
+		return
+	}
+
+	var product models.Product
+	if err := models.DB.First(&product, req.ProductID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if product.IsBundle {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle stock follows its components and cannot be changed directly"})
+		return
+	}
+
+	change := adminStockChange(c, req.Reason, req.Note)
+	change.LocationID = req.LocationID
+
+	tx := adminDB(c).Begin()
+	movement, err := models.ApplyStockChange(tx, product.ID, req.Delta, change)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, models.ErrLocationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+		if errors.Is(err, models.ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Stock cannot go below zero",
+				"available": product.Stock,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+		return
+	}
+	services.QueueLowStockCheck(product.ID)
+
+	c.JSON(http.StatusCreated, movement)
+}
+
+// GetInventoryMovements godoc
+// @Summary List inventory movements (Admin only)
+// @Description List stock ledger entries, newest first
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Param product_id query int false "Filter by product"
+// @Param reason query string false "Filter by reason (sale, restock, adjustment, return, cancellation, transfer)"
+// @Param order_id query int false "Filter by order"
+// @Param location_id query int false "Filter by location"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Success 200 {object} map[string]interface{} "Movements with pagination"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/inventory/movements [get]
+func GetInventoryMovements(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset := (page - 1) * limit
+
+	query := models.DB.Model(&models.InventoryMovement{})
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Where("location_id = ?", locationID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var movements []models.InventoryMovement
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"movements": movements,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetInventoryReconciliation godoc
+// @Summary Reconcile inventory (Admin only)
+// @Description Compare each product's stock with the sum of its ledger entries and of its per-location quantities, and list any discrepancies
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Reconciliation result"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/inventory/reconciliation [get]
+func GetInventoryReconciliation(c *gin.Context) {
+	discrepancies, err := models.ReconcileInventory()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile inventory"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"balanced":      len(discrepancies) == 0,
+		"discrepancies": discrepancies,
+	})
+}
+
+// GetLowStockReport godoc
+// @Summary Low stock report (Admin only)
+// @Description List products at or below their reorder threshold, emptiest first
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Low stock products"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/inventory/low-stock [get]
+func GetLowStockReport(c *gin.Context) {
+	var products []models.Product
+	if err := models.DB.Where("stock <= reorder_threshold AND is_bundle = ?", false).
+		Order("stock asc, name asc").
+		Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch low stock report"})
+		return
+	}
+
+	type lowStockItem struct {
+		ProductID        uint       `json:"product_id"`
+		Name             string     `json:"name"`
+		Stock            int        `json:"stock"`
+		ReorderThreshold int        `json:"reorder_threshold"`
+		ReorderQuantity  int        `json:"reorder_quantity"`
+		OutOfStock       bool       `json:"out_of_stock"`
+		LowStockSince    *time.Time `json:"low_stock_since"`
+	}
+
+	items := make([]lowStockItem, len(products))
+	for i, p := range products {
+		items[i] = lowStockItem{
+			ProductID:        p.ID,
+			Name:             p.Name,
+			Stock:            p.Stock,
+			ReorderThreshold: p.ReorderThreshold,
+			ReorderQuantity:  p.ReorderQuantity,
+			OutOfStock:       !p.IsAvailable(),
+			LowStockSince:    p.LowStockSince,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"products": items,
+		"total":    len(items),
+	})
+}
+
+// GetBackorderReport godoc
+// @Summary Backorder report (Admin only)
+// @Description List products with paid backorders or pre-orders still waiting on stock
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Outstanding backorders"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/inventory/backorders [get]
+func GetBackorderReport(c *gin.Context) {
+	summaries, err := models.BackorderSummaries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backorder report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"products": summaries,
+		"total":    len(summaries),
+	})
+}
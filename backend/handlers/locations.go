@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LocationRequest struct {
+	Name      string `json:"name" binding:"required" example:"Academy shop"`
+	Code      string `json:"code" binding:"required,max=32" example:"academy"`
+	Address   string `json:"address" example:"450 Mat Street, San Diego, CA"`
+	Priority  int    `json:"priority" example:"10"`
+	IsDefault bool   `json:"is_default" example:"false"`
+}
+
+type StockTransferRequest struct {
+	ProductID      uint   `json:"product_id" binding:"required" example:"1"`
+	FromLocationID uint   `json:"from_location_id" binding:"required" example:"1"`
+	ToLocationID   uint   `json:"to_location_id" binding:"required" example:"2"`
+	Quantity       int    `json:"quantity" binding:"required,min=1" example:"5"`
+	Note           string `json:"note" example:"Stock for open mat weekend"`
+}
+
+// GetLocations godoc
+// @Summary List stock locations (Admin only)
+// @Description List all stock locations in allocation priority order
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Locations"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/locations [get]
+func GetLocations(c *gin.Context) {
+	var locations []models.Location
+	if err := models.DB.Order("priority asc, id asc").Find(&locations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"locations": locations,
+	})
+}
+
+// CreateLocation godoc
+// @Summary Create a stock location (Admin only)
+// @Description Create a new place stock is held. Orders are allocated to lower priority values first
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Param location body LocationRequest true "Location"
+// @Success 201 {object} models.Location
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 409 {object} map[string]interface{} "Location code already in use"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/locations [post]
+func CreateLocation(c *gin.Context) {
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	location := models.Location{
+		Name:      strings.TrimSpace(req.Name),
+		Code:      strings.ToLower(strings.TrimSpace(req.Code)),
+		Address:   req.Address,
+		Priority:  req.Priority,
+		IsDefault: req.IsDefault,
+	}
+
+	var count int64
+	models.DB.Model(&models.Location{}).Where("code = ?", location.Code).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Location code already in use"})
+		return
+	}
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if location.IsDefault {
+			if err := tx.Model(&models.Location{}).Where("is_default = ?", true).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&location).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create location",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, location)
+}
+
+// UpdateLocation godoc
+// @Summary Update a stock location (Admin only)
+// @Description Update a location's details, allocation priority or default flag
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Param id path int true "Location ID"
+// @Param location body LocationRequest true "Location"
+// @Success 200 {object} models.Location
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Location not found"
+// @Failure 409 {object} map[string]interface{} "Location code already in use"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/locations/{id} [put]
+func UpdateLocation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	var location models.Location
+	if err := models.DB.First(&location, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code := strings.ToLower(strings.TrimSpace(req.Code))
+	var count int64
+	models.DB.Model(&models.Location{}).Where("code = ? AND id <> ?", code, location.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Location code already in use"})
+		return
+	}
+	if location.IsDefault && !req.IsDefault {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Make another location the default instead"})
+		return
+	}
+
+	location.Name = strings.TrimSpace(req.Name)
+	location.Code = code
+	location.Address = req.Address
+	location.Priority = req.Priority
+	location.IsDefault = req.IsDefault
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if location.IsDefault {
+			if err := tx.Model(&models.Location{}).Where("is_default = ? AND id <> ?", true, location.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(&location).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	c.JSON(http.StatusOK, location)
+}
+
+// DeleteLocation godoc
+// @Summary Delete a stock location (Admin only)
+// @Description Delete an empty, non-default location. Transfer its stock elsewhere first
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Param id path int true "Location ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid location ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Location not found"
+// @Failure 409 {object} map[string]interface{} "Location still holds stock"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/locations/{id} [delete]
+func DeleteLocation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	var location models.Location
+	if err := models.DB.First(&location, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+	if location.IsDefault {
+		c.JSON(http.StatusConflict, gin.H{"error": "The default location cannot be deleted"})
+		return
+	}
+
+	var held int64
+	models.DB.Model(&models.LocationStock{}).Where("location_id = ? AND quantity > 0", location.ID).Count(&held)
+	if held > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Location still holds stock",
+			"products": held,
+		})
+		return
+	}
+
+	if err := adminDB(c).Delete(&location).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Location deleted successfully"})
+}
+
+// GetLocationStock godoc
+// @Summary Stock held at a location (Admin only)
+// @Description List the products held at a location and their quantities
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Param id path int true "Location ID"
+// @Success 200 {object} map[string]interface{} "Stock levels"
+// @Failure 400 {object} map[string]interface{} "Invalid location ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Location not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/locations/{id}/stock [get]
+func GetLocationStock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	var location models.Location
+	if err := models.DB.First(&location, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	var levels []models.LocationStock
+	if err := models.DB.Preload("Product").
+		Where("location_id = ? AND quantity > 0", location.ID).
+		Order("product_id asc").
+		Find(&levels).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"location": location,
+		"stock":    levels,
+	})
+}
+
+// CreateStockTransfer godoc
+// @Summary Transfer stock between locations (Admin only)
+// @Description Move units of a product from one location to another. Total product stock is unchanged; both sides are recorded in the inventory ledger
+// @Tags admin,inventory
+// @Accept json
+// @Produce json
+// @Param transfer body StockTransferRequest true "Transfer"
+// @Success 201 {object} map[string]interface{} "Transfer movements"
+// @Failure 400 {object} map[string]interface{} "Invalid request or bundle product"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Product or location not found"
+// @Failure 409 {object} map[string]interface{} "Not enough stock at the source location"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/inventory/transfers [post]
+func CreateStockTransfer(c *gin.Context) {
+	var req StockTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid transfer",
+			"details": err.Error(),
+		})
+		return
+	}
+	if req.FromLocationID == req.ToLocationID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and destination locations must differ"})
+		return
+	}
+
+	var product models.Product
+	if err := models.DB.First(&product, req.ProductID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if product.IsBundle {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle stock follows its components and cannot be changed directly"})
+		return
+	}
+
+	var movements []models.InventoryMovement
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		movements, err = models.TransferStock(tx, product.ID, req.FromLocationID, req.ToLocationID, req.Quantity,
+			adminStockChange(c, models.MovementTransfer, req.Note))
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrLocationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		case errors.Is(err, models.ErrInsufficientStock):
+			c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock at the source location"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer stock"})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"success":   true,
+		"movements": movements,
+	})
+}
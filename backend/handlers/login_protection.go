@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+type UnlockIPRequest struct {
+	IPAddress string `json:"ip_address" binding:"required" example:"203.0.113.7"`
+}
+
+var (
+	loginLimiterOnce sync.Once
+	loginLimiter     *services.LoginLimiter
+)
+
+// adminLoginLimiter returns the limiter for admin logins, set up from
+// config on first use. The in-memory store has to be shared, so there is
+// only one limiter.
+func adminLoginLimiter() *services.LoginLimiter {
+	loginLimiterOnce.Do(func() {
+		cfg := config.AppConfig.Login
+		var store services.LoginAttemptStore = services.NewDBLoginAttemptStore()
+		if cfg.Store == "memory" {
+			store = services.NewMemoryLoginAttemptStore()
+		}
+		loginLimiter = services.NewLoginLimiter(store, services.LoginPolicy{
+			BackoffAfter:    cfg.BackoffAfter,
+			BackoffBase:     cfg.BackoffBase,
+			BackoffMax:      cfg.BackoffMax,
+			LockoutAfter:    cfg.LockoutAfter,
+			LockoutDuration: cfg.LockoutDuration,
+			IPLockoutAfter:  cfg.IPLockoutAfter,
+			FailureWindow:   cfg.FailureWindow,
+		})
+	})
+	return loginLimiter
+}
+
+// loginThrottled reserves an attempt for email to sign in from the client's
+// IP. If it has to wait, it records the refusal and sends a 429 response.
+// The attempt counts as a failure until recordSuccessfulLogin or
+// releaseLoginAttempt.
+func loginThrottled(c *gin.Context, email string, adminID *uint) bool {
+	wait, err := adminLoginLimiter().Attempt(email, c.ClientIP())
+	if err != nil {
+		// Let the login go ahead rather than locking everyone out
+		log.Printf("Failed to check login throttle for %s: %v", email, err)
+		return false
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	models.RecordLoginFailure(models.LoginFailure{
+		Email:     email,
+		AdminID:   adminID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    models.LoginThrottled,
+	})
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"success":     false,
+		"error":       "Too many failed login attempts, please try again later",
+		"retry_after": seconds,
+	})
+	return true
+}
+
+// recordFailedLogin counts a failed login against the account and IP and
+// writes the audit record.
+func recordFailedLogin(c *gin.Context, email string, adminID *uint, reason models.LoginFailureReason) {
+	locked, err := adminLoginLimiter().Fail(email, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to record failed login for %s: %v", email, err)
+	}
+	if locked {
+		log.Printf("Admin login locked for %s from %s after repeated failures", email, c.ClientIP())
+	}
+
+	models.RecordLoginFailure(models.LoginFailure{
+		Email:     email,
+		AdminID:   adminID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+		Locked:    locked,
+	})
+}
+
+// releaseLoginAttempt takes back the attempt reserved by loginThrottled when
+// the step succeeded but the login is not finished yet.
+func releaseLoginAttempt(email string) {
+	if err := adminLoginLimiter().Release(email); err != nil {
+		log.Printf("Failed to release login attempt for %s: %v", email, err)
+	}
+}
+
+// recordSuccessfulLogin clears the account's failed login count.
+func recordSuccessfulLogin(email string) {
+	if err := adminLoginLimiter().Succeed(email); err != nil {
+		log.Printf("Failed to reset login throttle for %s: %v", email, err)
+	}
+}
+
+// GetLoginFailures godoc
+// @Summary Failed admin logins (Super admin only)
+// @Description Audit trail of failed and refused admin logins, newest first
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param email query string false "Filter by email"
+// @Param ip query string false "Filter by IP address"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Success 200 {object} map[string]interface{} "Failed logins with pagination"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/login-failures [get]
+func GetLoginFailures(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := models.DB.Model(&models.LoginFailure{})
+	if email := c.Query("email"); email != "" {
+		query = query.Where("LOWER(email) = LOWER(?)", email)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip_address = ?", ip)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var failures []models.LoginFailure
+	if err := query.Order("created_at desc").Offset((page - 1) * limit).Limit(limit).Find(&failures).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login failures"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"failures": failures,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetAdminLockout godoc
+// @Summary Login lockout status (Super admin only)
+// @Description Show an admin's recent failed logins and whether they are locked out
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} map[string]interface{} "Lockout status"
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/lockout [get]
+func GetAdminLockout(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	throttle, wait, err := adminLoginLimiter().AccountStatus(admin.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockout status"})
+		return
+	}
+
+	status := gin.H{
+		"failures":    throttle.Failures,
+		"locked":      throttle.LockedUntil != nil && throttle.LockedUntil.After(time.Now()),
+		"retry_after": int(math.Ceil(wait.Seconds())),
+	}
+	if !throttle.LastFailureAt.IsZero() {
+		status["last_failure_at"] = throttle.LastFailureAt
+	}
+	if throttle.LockedUntil != nil {
+		status["locked_until"] = throttle.LockedUntil
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// UnlockAdminUser godoc
+// @Summary Unlock an admin's login (Super admin only)
+// @Description Clear an admin's failed login count and lift any lockout
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid admin ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Admin not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/admins/{id}/unlock [post]
+func UnlockAdminUser(c *gin.Context) {
+	admin, ok := loadManagedAdmin(c)
+	if !ok {
+		return
+	}
+
+	if err := adminLoginLimiter().UnlockAccount(admin.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock admin"})
+		return
+	}
+	log.Printf("Admin login for %s unlocked by %s", admin.Email, c.GetString("admin_email"))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login unlocked for " + admin.Email})
+}
+
+// UnlockLoginIP godoc
+// @Summary Unlock an IP address (Super admin only)
+// @Description Clear an IP address's failed login count and lift any lockout
+// @Tags admin,admin-users
+// @Accept json
+// @Produce json
+// @Param request body UnlockIPRequest true "IP address"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid IP address"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/login-failures/unlock-ip [post]
+func UnlockLoginIP(c *gin.Context) {
+	var req UnlockIPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"details": err.Error(),
+		})
+		return
+	}
+	ip := net.ParseIP(req.IPAddress)
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address"})
+		return
+	}
+
+	if err := adminLoginLimiter().UnlockIP(ip.String()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock IP address"})
+		return
+	}
+	log.Printf("Admin login from %s unlocked by %s", ip, c.GetString("admin_email"))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login unlocked for " + ip.String()})
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/services"
+)
+
+// newMailer returns the mailer selected by mail.driver
+func newMailer() services.Mailer {
+	mail := config.AppConfig.Mail
+	return services.NewMailer(services.MailSettings{
+		Driver:   mail.Driver,
+		From:     mail.From,
+		Host:     mail.SMTPHost,
+		Port:     mail.SMTPPort,
+		Username: mail.SMTPUsername,
+		Password: mail.SMTPPassword,
+	})
+}
@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OrderItemEdit struct {
+	ItemID uint `json:"item_id" binding:"required" example:"7"`
+	// New quantity; 0 removes the item
+	Quantity *int    `json:"quantity" binding:"omitempty,min=0" example:"2"`
+	Size     *string `json:"size" example:"A1"`
+}
+
+type EditOrderRequest struct {
+	Items           []OrderItemEdit   `json:"items" binding:"dive"`
+	AddItems        []models.CartItem `json:"add_items"`
+	ShippingAddress *models.Address   `json:"shipping_address"`
+	Note            string            `json:"note" example:"Customer asked for an A1 instead"`
+}
+
+var (
+	errNotEditable  = errors.New("order cannot be edited")
+	errInvalidEdit  = errors.New("invalid edit")
+	errNothingToDo  = errors.New("nothing to change")
+	errEditNotFound = errors.New("order not found")
+)
+
+// resolveSize matches size against the product's size options. An empty
+// size is allowed for products without sizes.
+func resolveSize(product *models.Product, size string) (string, bool) {
+	size = strings.TrimSpace(size)
+	options := product.GetSizeOptionsArray()
+	if len(options) == 0 {
+		return size, size == ""
+	}
+	for _, option := range options {
+		if strings.EqualFold(option, size) {
+			return option, true
+		}
+	}
+	return "", false
+}
+
+// stockTaken works out how many units of each stocked product the in-stock
+// part of items takes, expanding bundles into their components.
+func stockTaken(items []models.OrderItem, products map[uint]*models.Product) map[uint]int {
+	taken := make(map[uint]int)
+	for _, item := range items {
+		quantity := item.Quantity - item.BackorderedQuantity
+		if quantity <= 0 {
+			continue
+		}
+		if product := products[item.ProductID]; product != nil && product.IsBundle {
+			for componentID, q := range product.ComponentQuantities(quantity) {
+				taken[componentID] += q
+			}
+		} else {
+			taken[item.ProductID] += quantity
+		}
+	}
+	return taken
+}
+
+// refundGiftCardShare puts up to amount back on the gift card that paid for
+// the order, recording it on the edit.
+func refundGiftCardShare(tx *gorm.DB, order *models.Order, edit *models.OrderEdit, amount float64) error {
+	if order.GiftCardID == nil || order.GiftCardAmount <= 0 {
+		return nil
+	}
+	edit.GiftCardRefund = models.RoundMoney(min(amount, order.GiftCardAmount))
+	change := models.GiftCardChange{
+		Type:    models.GiftCardRefunded,
+		OrderID: &order.ID,
+		Actor:   edit.Actor,
+		AdminID: edit.AdminID,
+		Note:    "Order " + order.OrderNumber + " edited",
+	}
+	if _, err := models.ApplyGiftCardChange(tx, *order.GiftCardID, edit.GiftCardRefund, change); err != nil {
+		return err
+	}
+	order.GiftCardAmount = models.RoundMoney(order.GiftCardAmount - edit.GiftCardRefund)
+	return nil
+}
+
+// EditOrder godoc
+// @Summary Edit an order before it ships (Admin only)
+// @Description Change item sizes and quantities, add or remove items, or change the shipping address of a pending or paid order that has not shipped. Stock taken for paid orders is adjusted, the total is recalculated and the difference is charged, refunded or re-authorized. Every edit is kept in the order's history
+// @Tags admin,orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param edit body EditOrderRequest true "Changes"
+// @Success 200 {object} map[string]interface{} "Updated order and edit record"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Failure 409 {object} map[string]interface{} "Order cannot be edited or not enough stock"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/orders/{id} [put]
+func EditOrder(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req EditOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid order edit",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var order models.Order
+	var edit models.OrderEdit
+	var taken, released []uint
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&order, uint(orderID)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errEditNotFound
+			}
+			return err
+		}
+		if order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaid {
+			return errNotEditable
+		}
+		paid := order.Status == models.OrderStatusPaid
+
+		// Products on the order and being added, with bundle components for
+		// working out stock
+		productIDs := make([]uint, 0, len(order.Items)+len(req.AddItems))
+		for _, item := range order.Items {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		for _, item := range req.AddItems {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		var productList []models.Product
+		if err := tx.Preload("BundleItems.Component").Where("id IN ?", productIDs).Find(&productList).Error; err != nil {
+			return err
+		}
+		products := make(map[uint]*models.Product, len(productList))
+		available := make(map[uint]int, len(productList))
+		for i := range productList {
+			products[productList[i].ID] = &productList[i]
+			available[productList[i].ID] = productList[i].Stock
+		}
+
+		before := stockTaken(order.Items, products)
+		previousTotal := order.TotalAmount
+		var changes models.EditChanges
+
+		// plan splits extra units of a product between stock and backorder,
+		// counting stock already planned for earlier lines of this edit
+		plan := func(product *models.Product, extra int) (int, models.ItemFulfillment, error) {
+			planning := *product
+			planning.Stock = available[product.ID]
+			fromStock, backordered, fulfillment, ok := planning.PlanFulfillment(extra)
+			if !ok {
+				return 0, "", fmt.Errorf("%w: insufficient stock for %s. Available: %d, Requested: %d",
+					errInvalidEdit, product.Name, planning.Stock, extra)
+			}
+			if err := models.CheckBackorderLimit(tx, product, backordered); err != nil {
+				return 0, "", fmt.Errorf("%w: %v", errInvalidEdit, err)
+			}
+			available[product.ID] -= fromStock
+			return backordered, fulfillment, nil
+		}
+
+		edited := make(map[uint]bool)
+		removed := make(map[uint]bool)
+		for _, e := range req.Items {
+			var item *models.OrderItem
+			for i := range order.Items {
+				if order.Items[i].ID == e.ItemID {
+					item = &order.Items[i]
+					break
+				}
+			}
+			if item == nil {
+				return fmt.Errorf("%w: item %d is not on this order", errInvalidEdit, e.ItemID)
+			}
+			product := products[item.ProductID]
+			if product == nil {
+				return fmt.Errorf("%w: product %d no longer exists", errInvalidEdit, item.ProductID)
+			}
+
+			if e.Size != nil {
+				size, ok := resolveSize(product, *e.Size)
+				if !ok {
+					return fmt.Errorf("%w: %s is not available in size %q", errInvalidEdit, product.Name, *e.Size)
+				}
+				if size != item.Size {
+					changes = append(changes, fmt.Sprintf("%s: size %s → %s", product.Name, item.Size, size))
+					item.Size = size
+					edited[item.ID] = true
+				}
+			}
+
+			if e.Quantity != nil && *e.Quantity != item.Quantity {
+				quantity := *e.Quantity
+				if quantity == 0 {
+					changes = append(changes, fmt.Sprintf("%s (%s): removed %d", product.Name, item.Size, item.Quantity))
+					removed[item.ID] = true
+				} else {
+					changes = append(changes, fmt.Sprintf("%s (%s): quantity %d → %d", product.Name, item.Size, item.Quantity, quantity))
+				}
+
+				if quantity > item.Quantity {
+					backordered, fulfillment, err := plan(product, quantity-item.Quantity)
+					if err != nil {
+						return err
+					}
+					item.BackorderedQuantity += backordered
+					if backordered > 0 {
+						item.Fulfillment = fulfillment
+					}
+				} else {
+					// Drop backordered units first; they were never taken from stock
+					item.BackorderedQuantity = max(0, item.BackorderedQuantity-(item.Quantity-quantity))
+					if item.BackorderedQuantity == 0 {
+						item.Fulfillment = models.FulfillFromStock
+					}
+				}
+				item.Quantity = quantity
+				edited[item.ID] = true
+			}
+		}
+
+		var added []models.OrderItem
+		for _, a := range req.AddItems {
+			product := products[a.ProductID]
+			if product == nil {
+				return fmt.Errorf("%w: product with ID %d not found", errInvalidEdit, a.ProductID)
+			}
+			if a.Quantity <= 0 {
+				return fmt.Errorf("%w: quantity for %s must be at least 1", errInvalidEdit, product.Name)
+			}
+			size, ok := resolveSize(product, a.Size)
+			if !ok {
+				return fmt.Errorf("%w: %s is not available in size %q", errInvalidEdit, product.Name, a.Size)
+			}
+
+			backordered, fulfillment, err := plan(product, a.Quantity)
+			if err != nil {
+				return err
+			}
+			item := models.OrderItem{
+				OrderID:             order.ID,
+				ProductID:           product.ID,
+				Quantity:            a.Quantity,
+				Price:               product.Price, // Use current product price
+				Size:                size,
+				BackorderedQuantity: backordered,
+				Fulfillment:         fulfillment,
+			}
+			if paid {
+				item.UnitCost = product.CostPrice
+				if product.IsBundle {
+					item.UnitCost = product.BundleCost()
+				}
+			}
+			added = append(added, item)
+			changes = append(changes, fmt.Sprintf("%s (%s): added %d", product.Name, size, a.Quantity))
+		}
+
+		if req.ShippingAddress != nil {
+			address := *req.ShippingAddress
+			if address.FirstName == "" || address.LastName == "" ||
+				address.Address1 == "" || address.City == "" || address.ZipCode == "" {
+				return fmt.Errorf("%w: incomplete shipping address", errInvalidEdit)
+			}
+			if address != order.ShippingAddress {
+				changes = append(changes, fmt.Sprintf("Shipping address: %s, %s → %s, %s",
+					order.ShippingAddress.Address1, order.ShippingAddress.City, address.Address1, address.City))
+				order.ShippingAddress = address
+			}
+		}
+
+		if len(changes) == 0 {
+			return errNothingToDo
+		}
+
+		// Write the item changes
+		remaining := make([]models.OrderItem, 0, len(order.Items)+len(added))
+		for _, item := range order.Items {
+			switch {
+			case removed[item.ID]:
+				if err := tx.Delete(&models.OrderItem{}, item.ID).Error; err != nil {
+					return err
+				}
+			case edited[item.ID]:
+				if err := tx.Model(&models.OrderItem{}).Where("id = ?", item.ID).
+					UpdateColumns(map[string]interface{}{
+						"quantity":             item.Quantity,
+						"size":                 item.Size,
+						"backordered_quantity": item.BackorderedQuantity,
+						"fulfillment":          item.Fulfillment,
+					}).Error; err != nil {
+					return err
+				}
+				remaining = append(remaining, item)
+			default:
+				remaining = append(remaining, item)
+			}
+		}
+		if len(added) > 0 {
+			if err := tx.Create(&added).Error; err != nil {
+				return err
+			}
+			remaining = append(remaining, added...)
+		}
+		if len(remaining) == 0 {
+			return fmt.Errorf("%w: an order needs at least one item, cancel it instead", errInvalidEdit)
+		}
+		order.Items = remaining
+
+		order.HasBackorder, order.HasPreorder, order.ExpectedShipAt = false, false, nil
+		for _, item := range order.Items {
+			if product := products[item.ProductID]; product != nil && item.BackorderedQuantity > 0 {
+				order.MarkFulfillment(item.Fulfillment, product.ExpectedShipDate)
+			}
+		}
+		order.CalculateTotal()
+		order.TotalAmount = models.RoundMoney(order.TotalAmount)
+
+		if paid {
+			// Take or give back the difference in stock held for the order
+			after := stockTaken(order.Items, products)
+			more := make(map[uint]int)
+			for productID, quantity := range after {
+				if quantity > before[productID] {
+					more[productID] = quantity - before[productID]
+				}
+			}
+			for productID, quantity := range before {
+				if quantity > after[productID] {
+					change := adminStockChange(c, models.MovementCancellation, "Order "+order.OrderNumber+" edited")
+					change.OrderID = &order.ID
+					if err := models.ReleaseOrderStock(tx, order.ID, productID, quantity-after[productID], change); err != nil {
+						return err
+					}
+					released = append(released, productID)
+				}
+			}
+
+			allocations, err := models.AllocateOrderStock(tx, more)
+			if err != nil {
+				return err
+			}
+			for _, allocation := range allocations {
+				change := adminStockChange(c, models.MovementSale, "Order "+order.OrderNumber+" edited")
+				change.OrderID = &order.ID
+				change.LocationID = allocation.LocationID
+				if _, err := models.ApplyStockChange(tx, allocation.ProductID, -allocation.Quantity, change); err != nil {
+					return err
+				}
+				taken = append(taken, allocation.ProductID)
+			}
+
+			held, err := models.OrderStockAllocations(tx, order.ID)
+			if err != nil {
+				return err
+			}
+			order.FulfillmentLocationID = models.SingleLocation(held)
+		}
+
+		edit = models.OrderEdit{
+			OrderID:       order.ID,
+			Actor:         c.GetString("admin_email"),
+			Changes:       changes,
+			PreviousTotal: previousTotal,
+			NewTotal:      order.TotalAmount,
+			PaymentDelta:  models.RoundMoney(order.TotalAmount - previousTotal),
+			Adjustment:    models.AdjustmentNone,
+			Note:          strings.TrimSpace(req.Note),
+		}
+		if adminID := c.GetUint("admin_id"); adminID != 0 {
+			edit.AdminID = &adminID
+		}
+
+		// Settle the difference with the customer
+		if paid && edit.PaymentDelta != 0 {
+			now := time.Now()
+			switch {
+			case order.PaymentCapture == models.PaymentAuthorized:
+				// Mock gateway: nothing was captured from the card yet. A
+				// gift card was redeemed at payment though, so a lower total
+				// goes back on it first, as for captured orders, and the
+				// authorized amount changes by the rest
+				edit.Adjustment = models.AdjustmentAuthorization
+				if refund := -edit.PaymentDelta; refund > 0 {
+					if err := refundGiftCardShare(tx, &order, &edit, refund); err != nil {
+						return err
+					}
+					if refund <= edit.GiftCardRefund {
+						edit.Adjustment = models.AdjustmentRefund
+					}
+				}
+			case edit.PaymentDelta > 0:
+				// Mock gateway: charge the difference to the card on file
+				edit.Adjustment = models.AdjustmentCharge
+				edit.PaymentReference = fmt.Sprintf("TXN-%d-%d", now.Unix(), order.ID)
+			default:
+				// Put the refund back on the gift card that paid for the order
+				// first, then refund the rest to the card
+				refund := -edit.PaymentDelta
+				edit.Adjustment = models.AdjustmentRefund
+				if err := refundGiftCardShare(tx, &order, &edit, refund); err != nil {
+					return err
+				}
+				if refund > edit.GiftCardRefund {
+					edit.PaymentReference = fmt.Sprintf("RFD-%d", now.UnixMilli())
+				}
+			}
+		}
+
+		order.UpdatedAt = time.Now()
+		if err := tx.Omit("Items").Save(&order).Error; err != nil {
+			return err
+		}
+		return tx.Create(&edit).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errEditNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		case errors.Is(err, errNotEditable):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "Only pending or paid orders that have not shipped can be edited",
+				"current_status": order.Status,
+			})
+		case errors.Is(err, errNothingToDo):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to change"})
+		case errors.Is(err, errInvalidEdit):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrInsufficientStock):
+			c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock for the edited order"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit order"})
+		}
+		return
+	}
+
+	services.QueueLowStockCheck(taken...)
+	services.QueueBackInStockCheck(released...)
+
+	models.DB.Preload("Items.Product").First(&order, order.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Order updated successfully",
+		"order":   order,
+		"edit":    edit,
+	})
+}
+
+// GetOrderEdits godoc
+// @Summary Order edit history (Admin only)
+// @Description List the edits made to an order, oldest first
+// @Tags admin,orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} map[string]interface{} "Edits"
+// @Failure 400 {object} map[string]interface{} "Invalid order ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Security BearerAuth
+// @Router /admin/orders/{id}/edits [get]
+func GetOrderEdits(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var order models.Order
+	if err := models.DB.First(&order, uint(orderID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var edits []models.OrderEdit
+	models.DB.Where("order_id = ?", order.ID).Order("id asc").Find(&edits)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"order_number": order.OrderNumber,
+		"edits":        edits,
+	})
+}
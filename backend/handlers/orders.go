@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type CreateOrderRequest struct {
@@ -92,8 +95,10 @@ func CreateOrder(c *gin.Context) {
 			return
 		}
 
-		// Check stock availability (but don't reduce yet - only on successful payment)
-		if !product.HasSufficientStock(item.Quantity) {
+		// Check stock availability (but don't reduce yet - only on successful payment).
+		// Backorder and pre-order products may be sold beyond stock up to their cap
+		_, backordered, fulfillment, ok := product.PlanFulfillment(item.Quantity)
+		if !ok {
 			tx.Rollback()
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": fmt.Sprintf("Insufficient stock for %s. Available: %d, Requested: %d",
@@ -101,16 +106,26 @@ func CreateOrder(c *gin.Context) {
 			})
 			return
 		}
+		if err := models.CheckBackorderLimit(tx, &product, backordered); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 
 		// Create order item
 		orderItem := models.OrderItem{
-			OrderID:   order.ID,
-			ProductID: product.ID,
-			Product:   product,
-			Quantity:  item.Quantity,
-			Price:     product.Price, // Use current product price
-			Size:      item.Size,
+			OrderID:             order.ID,
+			ProductID:           product.ID,
+			Product:             product,
+			Quantity:            item.Quantity,
+			Price:               product.Price, // Use current product price
+			Size:                item.Size,
+			BackorderedQuantity: backordered,
+			Fulfillment:         fulfillment,
 		}
+		order.MarkFulfillment(fulfillment, product.ExpectedShipDate)
 
 		orderItems = append(orderItems, orderItem)
 		totalAmount += product.Price * float64(item.Quantity)
@@ -270,6 +285,7 @@ func GetAllOrders(c *gin.Context) {
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 403 {object} map[string]interface{} "Insufficient permissions"
 // @Failure 404 {object} map[string]interface{} "Order not found"
+// @Failure 409 {object} map[string]interface{} "Not enough stock to ship backordered items"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Security BearerAuth
 // @Router /admin/orders/{id}/status [put]
@@ -320,22 +336,114 @@ func UpdateOrderStatus(c *gin.Context) {
 	}
 
 	var order models.Order
-	if err := models.DB.First(&order, uint(orderID)).Error; err != nil {
+	if err := models.DB.Preload("Items").First(&order, uint(orderID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Order not found",
 		})
 		return
 	}
 
+	// Stock is taken when an order is paid; give it back if the order is
+	// cancelled before it ships. Backordered units were never taken.
+	restock := order.Status == models.OrderStatusPaid && req.Status == models.OrderStatusCancelled
+	// Backordered units are taken from stock when the order ships, including
+	// when it goes straight from paid to delivered
+	fulfillBackorders := order.Status == models.OrderStatusPaid &&
+		(req.Status == models.OrderStatusShipped || req.Status == models.OrderStatusDelivered)
+
+	if req.Status == models.OrderStatusDelivered && order.Status != models.OrderStatusDelivered {
+		now := time.Now()
+		order.DeliveredAt = &now
+	}
 	order.Status = req.Status
 	order.UpdatedAt = time.Now()
 
-	if err := models.DB.Save(&order).Error; err != nil {
+	if fulfillBackorders && order.PaymentCapture == models.PaymentAuthorized {
+		// Mock gateway: capture the authorized amount on shipment
+		now := time.Now()
+		order.PaymentCapture = models.PaymentCaptured
+		order.CapturedAt = &now
+	}
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Items").Save(&order).Error; err != nil {
+			return err
+		}
+
+		if restock {
+			// Return units to the locations they were taken from
+			allocations, err := models.OrderStockAllocations(tx, order.ID)
+			if err != nil {
+				return err
+			}
+			if len(allocations) == 0 {
+				// Paid before sales were recorded per location
+				for _, item := range order.Items {
+					allocations = append(allocations, models.StockAllocation{
+						ProductID: item.ProductID,
+						Quantity:  item.Quantity - item.BackorderedQuantity,
+					})
+				}
+			}
+			for _, allocation := range allocations {
+				change := adminStockChange(c, models.MovementCancellation, "Order "+order.OrderNumber+" cancelled")
+				change.OrderID = &order.ID
+				change.LocationID = allocation.LocationID
+				if _, err := models.ApplyStockChange(tx, allocation.ProductID, allocation.Quantity, change); err != nil {
+					return err
+				}
+			}
+		}
+
+		if restock && order.GiftCardID != nil && order.GiftCardAmount > 0 {
+			// Put the gift card portion of the payment back on the card
+			change := models.GiftCardChange{
+				Type:    models.GiftCardRefunded,
+				OrderID: &order.ID,
+				Actor:   c.GetString("admin_email"),
+				Note:    "Order " + order.OrderNumber + " cancelled",
+			}
+			if adminID := c.GetUint("admin_id"); adminID != 0 {
+				change.AdminID = &adminID
+			}
+			if _, err := models.ApplyGiftCardChange(tx, *order.GiftCardID, order.GiftCardAmount, change); err != nil {
+				return err
+			}
+		}
+
+		for i := range order.Items {
+			item := &order.Items[i]
+			if fulfillBackorders && item.BackorderedQuantity > 0 {
+				change := adminStockChange(c, models.MovementSale, "Backorder for "+order.OrderNumber+" fulfilled")
+				change.OrderID = &order.ID
+				if _, err := models.ApplyStockChange(tx, item.ProductID, -item.BackorderedQuantity, change); err != nil {
+					return err
+				}
+				item.BackorderedQuantity = 0
+				if err := tx.Model(item).UpdateColumn("backordered_quantity", 0).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Not enough stock to ship backordered items",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to update order status",
 		})
 		return
 	}
+	if restock || fulfillBackorders {
+		for _, item := range order.Items {
+			services.QueueLowStockCheck(item.ProductID)
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -1,40 +1,48 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/calvinnle/bjj-store/backend/config"
 	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
 	"github.com/gin-gonic/gin"
 )
 
 type PaymentRequest struct {
-	OrderID    uint    `json:"order_id" binding:"required"`
-	Amount     float64 `json:"amount" binding:"required"`
-	CardNumber string  `json:"card_number" binding:"required"`
-	ExpiryDate string  `json:"expiry_date" binding:"required"`
-	CVV        string  `json:"cvv" binding:"required"`
-	NameOnCard string  `json:"name_on_card" binding:"required"`
+	OrderID uint    `json:"order_id" binding:"required"`
+	Amount  float64 `json:"amount" binding:"required"`
+	// Card details are required unless a gift card covers the whole amount
+	CardNumber   string `json:"card_number"`
+	ExpiryDate   string `json:"expiry_date"`
+	CVV          string `json:"cvv"`
+	NameOnCard   string `json:"name_on_card"`
+	GiftCardCode string `json:"gift_card_code" example:"7KQ2-M8XP-3HTR-ZW4N"`
 }
 
 type PaymentResponse struct {
-	Success       bool         `json:"success"`
-	TransactionID string       `json:"transaction_id,omitempty"`
-	Message       string       `json:"message"`
-	Order         models.Order `json:"order,omitempty"`
+	Success        bool         `json:"success"`
+	TransactionID  string       `json:"transaction_id,omitempty"`
+	Message        string       `json:"message"`
+	GiftCardAmount float64      `json:"gift_card_amount,omitempty"`
+	CardAmount     float64      `json:"card_amount"`
+	Order          models.Order `json:"order,omitempty"`
 }
 
 // ProcessPayment godoc
 // @Summary Process payment for an order
-// @Description Process payment for an order using mock payment gateway
+// @Description Process payment for an order using mock payment gateway. A gift card or store credit code pays as much of the total as its balance allows and the card pays the rest
 // @Tags payment
 // @Accept json
 // @Produce json
 // @Param payment body PaymentRequest true "Payment data"
 // @Success 200 {object} PaymentResponse "Payment successful"
-// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 400 {object} map[string]interface{} "Invalid request or order not pending"
 // @Failure 404 {object} map[string]interface{} "Order not found"
 // @Failure 500 {object} map[string]interface{} "Payment failed"
 // @Router /payment/process [post]
@@ -69,39 +77,54 @@ func ProcessPayment(c *gin.Context) {
 		return
 	}
 
-	// Check if order is already paid
-	if order.Status == models.OrderStatusPaid {
+	// Only pending orders can be paid; paying a shipped or cancelled order
+	// again would redeem gift cards and take stock a second time
+	if order.Status != models.OrderStatusPending {
+		message := "Order cannot be paid in its current status"
+		if order.Status == models.OrderStatusPaid {
+			message = "Order is already paid"
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Order is already paid",
+			"error":   message,
+			"status":  order.Status,
 		})
 		return
 	}
 
-	// Mock payment processing - simulate delay
-	time.Sleep(2 * time.Second)
-
-	// Mock different scenarios based on card number
-	cardNumber := strings.ReplaceAll(req.CardNumber, " ", "")
-	
-	// Test card for declined payment
-	if cardNumber == "4000000000000002" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Payment declined by bank",
-			"message": "Your card was declined. Please try a different payment method.",
-		})
-		return
+	// A gift card pays as much of the total as its balance allows; the card
+	// pays the rest
+	var giftCard *models.GiftCard
+	var giftCardAmount float64
+	if req.GiftCardCode != "" {
+		card, err := models.FindGiftCard(models.DB, req.GiftCardCode)
+		if err == nil {
+			err = card.Usable()
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Gift card cannot be used",
+				"details": err.Error(),
+			})
+			return
+		}
+		giftCard = card
+		giftCardAmount = models.RoundMoney(math.Min(card.Balance, order.TotalAmount))
 	}
+	cardAmount := models.RoundMoney(order.TotalAmount - giftCardAmount)
 
-	// Test card for processing error
-	if cardNumber == "4000000000000119" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Payment processing error",
-			"message": "There was an error processing your payment. Please try again.",
-		})
-		return
+	if cardAmount > 0 {
+		if req.CardNumber == "" || req.ExpiryDate == "" || req.CVV == "" || req.NameOnCard == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("Card details are required to pay the remaining %.2f", cardAmount),
+			})
+			return
+		}
+		if !mockChargeCard(c, req.CardNumber) {
+			return
+		}
 	}
 
 	// Successful payment - begin transaction to update order and reduce stock
@@ -112,11 +135,14 @@ func ProcessPayment(c *gin.Context) {
 		}
 	}()
 
-	// Update order status
+	// Update order status, only if no other payment got there first
 	order.Status = models.OrderStatusPaid
 	order.UpdatedAt = time.Now()
 
-	if err := tx.Save(&order).Error; err != nil {
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, models.OrderStatusPending).
+		Updates(map[string]interface{}{"status": order.Status, "updated_at": order.UpdatedAt})
+	if result.Error != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -124,11 +150,20 @@ func ProcessPayment(c *gin.Context) {
 		})
 		return
 	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Order is already paid",
+		})
+		return
+	}
 
 	// Now reduce stock for each item since payment was successful
-	for _, item := range order.Items {
+	shipNow := make(map[uint]int)
+	for i, item := range order.Items {
 		var product models.Product
-		if err := tx.First(&product, item.ProductID).Error; err != nil {
+		if err := tx.Preload("BundleItems.Component").First(&product, item.ProductID).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
@@ -137,8 +172,10 @@ func ProcessPayment(c *gin.Context) {
 			return
 		}
 
-		// Double-check stock availability (race condition protection)
-		if !product.HasSufficientStock(item.Quantity) {
+		// Double-check stock availability (race condition protection). Stock
+		// may have sold out since checkout, so re-plan backorders too
+		fromStock, backordered, fulfillment, ok := product.PlanFulfillment(item.Quantity)
+		if !ok {
 			tx.Rollback()
 			c.JSON(http.StatusBadRequest, gin.H{
 				"success": false,
@@ -147,26 +184,118 @@ func ProcessPayment(c *gin.Context) {
 			})
 			return
 		}
-
-		// Reduce stock
-		if err := product.ReduceStock(item.Quantity); err != nil {
+		if err := models.CheckBackorderLimit(tx, &product, backordered); err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
+			c.JSON(http.StatusBadRequest, gin.H{
 				"success": false,
 				"error":   err.Error(),
 			})
 			return
 		}
+		order.MarkFulfillment(fulfillment, product.ExpectedShipDate)
 
-		// Save updated product stock
-		if err := tx.Save(&product).Error; err != nil {
+		// Snapshot the cost price for margin reporting and record how the item ships
+		unitCost := product.CostPrice
+		if product.IsBundle {
+			unitCost = product.BundleCost()
+		}
+		if err := tx.Model(&models.OrderItem{}).Where("id = ?", item.ID).
+			UpdateColumns(map[string]interface{}{
+				"unit_cost":            unitCost,
+				"backordered_quantity": backordered,
+				"fulfillment":          fulfillment,
+			}).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
-				"error":   "Failed to update product stock",
+				"error":   "Failed to update order items",
 			})
 			return
 		}
+		order.Items[i].BackorderedQuantity = backordered
+		order.Items[i].Fulfillment = fulfillment
+
+		if product.IsBundle {
+			// Bundles ship as their components
+			for componentID, quantity := range product.ComponentQuantities(fromStock) {
+				shipNow[componentID] += quantity
+			}
+		} else {
+			shipNow[product.ID] += fromStock
+		}
+	}
+
+	// Choose the locations that ship the in-stock units, then reduce stock
+	// there and record the sale in the inventory ledger
+	stockFailed := func(err error) {
+		tx.Rollback()
+		if errors.Is(err, models.ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Insufficient stock to fulfill this order",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update product stock",
+		})
+	}
+
+	allocations, err := models.AllocateOrderStock(tx, shipNow)
+	if err != nil {
+		stockFailed(err)
+		return
+	}
+	for _, allocation := range allocations {
+		if _, err := models.ApplyStockChange(tx, allocation.ProductID, -allocation.Quantity, models.StockChange{
+			Reason:     models.MovementSale,
+			Actor:      order.GuestEmail,
+			OrderID:    &order.ID,
+			LocationID: allocation.LocationID,
+		}); err != nil {
+			stockFailed(err)
+			return
+		}
+	}
+	order.FulfillmentLocationID = models.SingleLocation(allocations)
+
+	if giftCard != nil && giftCardAmount > 0 {
+		if _, err := models.ApplyGiftCardChange(tx, giftCard.ID, -giftCardAmount, models.GiftCardChange{
+			Type:    models.GiftCardRedeemed,
+			OrderID: &order.ID,
+			Actor:   order.GuestEmail,
+			Note:    "Payment for order " + order.OrderNumber,
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Gift card could not be redeemed",
+				"details": err.Error(),
+			})
+			return
+		}
+		order.GiftCardID = &giftCard.ID
+		order.GiftCardAmount = giftCardAmount
+	}
+
+	// Orders with items sold ahead of stock may only be authorized now and
+	// captured when they ship
+	if order.CaptureOnShip(config.AppConfig.Orders.PreorderCapture, config.AppConfig.Orders.BackorderCapture) {
+		order.PaymentCapture = models.PaymentAuthorized
+	} else {
+		now := time.Now()
+		order.PaymentCapture = models.PaymentCaptured
+		order.CapturedAt = &now
+	}
+
+	if err := tx.Omit("Items").Save(&order).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update order",
+		})
+		return
 	}
 
 	// Commit the transaction
@@ -178,17 +307,61 @@ func ProcessPayment(c *gin.Context) {
 		return
 	}
 
+	// Alert staff about anything that just dropped below its reorder threshold
+	for productID := range shipNow {
+		services.QueueLowStockCheck(productID)
+	}
+
 	// Generate transaction ID
 	transactionID := fmt.Sprintf("TXN-%d-%d", time.Now().Unix(), order.ID)
 
+	message := "Payment processed successfully"
+	if order.PaymentCapture == models.PaymentAuthorized {
+		message = "Payment authorized; your card will be charged when the order ships"
+	}
+
 	// Log successful payment
 	fmt.Printf("Payment processed successfully - Order: %s, Amount: $%.2f, Transaction: %s\n", 
 		order.OrderNumber, order.TotalAmount, transactionID)
 
 	c.JSON(http.StatusOK, PaymentResponse{
-		Success:       true,
-		TransactionID: transactionID,
-		Message:       "Payment processed successfully",
-		Order:         order,
+		Success:        true,
+		TransactionID:  transactionID,
+		Message:        message,
+		GiftCardAmount: giftCardAmount,
+		CardAmount:     cardAmount,
+		Order:          order,
 	})
+}
+
+// mockChargeCard simulates charging a card through the payment gateway. It
+// writes the error response and returns false if the charge fails.
+func mockChargeCard(c *gin.Context, cardNumber string) bool {
+	// Mock payment processing - simulate delay
+	time.Sleep(2 * time.Second)
+
+	// Mock different scenarios based on card number
+	cardNumber = strings.ReplaceAll(cardNumber, " ", "")
+
+	// Test card for declined payment
+	if cardNumber == "4000000000000002" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Payment declined by bank",
+			"message": "Your card was declined. Please try a different payment method.",
+		})
+		return false
+	}
+
+	// Test card for processing error
+	if cardNumber == "4000000000000119" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Payment processing error",
+			"message": "There was an error processing your payment. Please try again.",
+		})
+		return false
+	}
+
+	return true
 }
\ No newline at end of file
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type UpdateProductImageRequest struct {
+	AltText   *string `json:"alt_text"`
+	SortOrder *int    `json:"sort_order"`
+}
+
+// newStorage builds the storage backend selected in config.
+func newStorage(c *gin.Context) services.Storage {
+	cfg := config.AppConfig.Storage
+	if cfg.Driver == "s3" {
+		minio := config.AppConfig.MinIO
+		return services.NewS3Storage(minio.Endpoint, minio.BucketName, minio.Region,
+			minio.AccessKeyID, minio.SecretAccessKey, minio.UseSSL, cfg.PublicURL)
+	}
+
+	baseURL := cfg.PublicURL
+	if baseURL == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		baseURL = fmt.Sprintf("%s://%s/uploads", scheme, c.Request.Host)
+	}
+	return services.NewLocalStorage(cfg.LocalDir, baseURL)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// UploadProductImage godoc
+// @Summary Upload a product image
+// @Description Upload an image for a product as multipart form data. The file type is detected from its contents and a thumbnail is generated (Admin only)
+// @Tags admin,products
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param image formData file true "Image file (JPEG, PNG or GIF)"
+// @Param alt_text formData string false "Alternative text"
+// @Param sort_order formData int false "Position in the gallery"
+// @Success 201 {object} models.ProductImage
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Product not found"
+// @Failure 413 {object} map[string]interface{} "File too large"
+// @Failure 415 {object} map[string]interface{} "Unsupported image type"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/products/{id}/images [post]
+func UploadProductImage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var product models.Product
+	if err := models.DB.First(&product, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	maxSize := config.AppConfig.Storage.MaxUploadSize
+	// Leave some headroom for the multipart envelope and the other fields
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+64<<10)
+
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":    "File too large",
+				"max_size": maxSize,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Image file is required",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if fileHeader.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large",
+			"max_size": maxSize,
+		})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	if int64(len(data)) > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large",
+			"max_size": maxSize,
+		})
+		return
+	}
+
+	processed, err := services.ProcessImage(data, config.AppConfig.Storage.ThumbnailSize)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedImageType) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error":         "Unsupported image type",
+				"allowed_types": []string{"image/jpeg", "image/png", "image/gif"},
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid image",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	name, err := randomHex(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate file name"})
+		return
+	}
+	key := fmt.Sprintf("products/%d/%s%s", product.ID, name, processed.Extension)
+	thumbKey := fmt.Sprintf("products/%d/%s_thumb.jpg", product.ID, name)
+
+	storage := newStorage(c)
+	if err := storage.Put(c.Request.Context(), key, data, processed.ContentType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to store image",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := storage.Put(c.Request.Context(), thumbKey, processed.Thumbnail, "image/jpeg"); err != nil {
+		storage.Delete(c.Request.Context(), key)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to store thumbnail",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	sortOrder := models.NextImageSortOrder(product.ID)
+	if v := c.PostForm("sort_order"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			sortOrder = n
+		}
+	}
+
+	image := models.ProductImage{
+		ProductID:    product.ID,
+		URL:          storage.URL(key),
+		ThumbnailURL: storage.URL(thumbKey),
+		StorageKey:   key,
+		ThumbnailKey: thumbKey,
+		AltText:      c.PostForm("alt_text"),
+		SortOrder:    sortOrder,
+		ContentType:  processed.ContentType,
+		Width:        processed.Width,
+		Height:       processed.Height,
+		Size:         int64(len(data)),
+	}
+
+	if err := adminDB(c).Create(&image).Error; err != nil {
+		storage.Delete(c.Request.Context(), key)
+		storage.Delete(c.Request.Context(), thumbKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+		return
+	}
+
+	// Keep the legacy single image field pointing at the first image
+	if product.ImageURL == "" {
+		adminDB(c).Model(&product).Update("image_url", image.URL)
+	}
+
+	c.JSON(http.StatusCreated, image)
+}
+
+// UpdateProductImage godoc
+// @Summary Update a product image
+// @Description Update the alt text or position of a product image (Admin only)
+// @Tags admin,products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param imageId path int true "Image ID"
+// @Param image body UpdateProductImageRequest true "Image fields to update"
+// @Success 200 {object} models.ProductImage
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Image not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/products/{id}/images/{imageId} [put]
+func UpdateProductImage(c *gin.Context) {
+	image, ok := findProductImage(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateProductImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.AltText != nil {
+		image.AltText = *req.AltText
+	}
+	if req.SortOrder != nil {
+		image.SortOrder = *req.SortOrder
+	}
+
+	if err := adminDB(c).Save(&image).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update image"})
+		return
+	}
+
+	c.JSON(http.StatusOK, image)
+}
+
+// DeleteProductImage godoc
+// @Summary Delete a product image
+// @Description Delete a product image and its thumbnail from storage (Admin only)
+// @Tags admin,products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param imageId path int true "Image ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Image not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/products/{id}/images/{imageId} [delete]
+func DeleteProductImage(c *gin.Context) {
+	image, ok := findProductImage(c)
+	if !ok {
+		return
+	}
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+
+		// Keep the legacy single image field off the deleted file, pointing
+		// at the first image left
+		var product models.Product
+		if err := tx.First(&product, image.ProductID).Error; err != nil {
+			return err
+		}
+		if product.ImageURL != image.URL {
+			return nil
+		}
+		var next []models.ProductImage
+		if err := tx.Where("product_id = ?", product.ID).Order("sort_order ASC, id ASC").Limit(1).Find(&next).Error; err != nil {
+			return err
+		}
+		url := ""
+		if len(next) > 0 {
+			url = next[0].URL
+		}
+		return tx.Model(&product).Update("image_url", url).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+		return
+	}
+
+	storage := newStorage(c)
+	for _, key := range []string{image.StorageKey, image.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := storage.Delete(c.Request.Context(), key); err != nil {
+			log.Printf("Failed to delete stored file %s: %v", key, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
+}
+
+func findProductImage(c *gin.Context) (models.ProductImage, bool) {
+	var image models.ProductImage
+
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return image, false
+	}
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image ID"})
+		return image, false
+	}
+
+	if err := models.DB.Where("product_id = ?", uint(productID)).First(&image, uint(imageID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return image, false
+	}
+	return image, true
+}
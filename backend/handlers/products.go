@@ -1,13 +1,26 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// orderImages sorts preloaded product images into gallery order
+func orderImages(db *gorm.DB) *gorm.DB {
+	return db.Order("sort_order ASC, id ASC")
+}
+
+// orderBundleItems sorts preloaded bundle components in the order they were added
+func orderBundleItems(db *gorm.DB) *gorm.DB {
+	return db.Order("id ASC")
+}
+
 // GetProducts godoc
 // @Summary Get all products
 // @Description Get a list of all products with optional filtering
@@ -36,11 +49,22 @@ func GetProducts(c *gin.Context) {
 		query = query.Where("name ILIKE ? OR description ILIKE ?", "%"+search+"%", "%"+search+"%")
 	}
 
-	if err := query.Find(&products).Error; err != nil {
+	if err := query.Preload("Images", orderImages).
+		Preload("BundleItems", orderBundleItems).Preload("BundleItems.Component").
+		Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
 
+	if err := models.AttachRatings(products); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product ratings"})
+		return
+	}
+	if err := models.AttachAvailabilities(products); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product availability"})
+		return
+	}
+
 	c.JSON(http.StatusOK, products)
 }
 
@@ -63,14 +87,115 @@ func GetProduct(c *gin.Context) {
 	}
 
 	var product models.Product
-	if err := models.DB.First(&product, uint(id)).Error; err != nil {
+	if err := models.DB.Preload("Images", orderImages).
+		Preload("BundleItems", orderBundleItems).Preload("BundleItems.Component").
+		First(&product, uint(id)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
+	if err := product.AttachRating(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product rating"})
+		return
+	}
+	if err := product.AttachAvailability(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product availability"})
+		return
+	}
+
 	c.JSON(http.StatusOK, product)
 }
 
+// GetProductBySlug godoc
+// @Summary Get a product by slug
+// @Description Get a single product by its URL slug. Slugs a product used to have answer with a 301 redirect to the current slug
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param slug path string true "Product slug"
+// @Success 200 {object} models.Product
+// @Success 301 {object} map[string]interface{} "Slug has changed"
+// @Failure 404 {object} map[string]interface{} "Product not found"
+// @Router /products/by-slug/{slug} [get]
+func GetProductBySlug(c *gin.Context) {
+	slug := c.Param("slug")
+
+	var product models.Product
+	err := models.DB.Preload("Images", orderImages).
+		Preload("BundleItems", orderBundleItems).Preload("BundleItems.Component").
+		Where("slug = ?", slug).First(&product).Error
+	if err == nil {
+		if err := product.AttachRating(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product rating"})
+			return
+		}
+		if err := product.AttachAvailability(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product availability"})
+			return
+		}
+		c.JSON(http.StatusOK, product)
+		return
+	}
+
+	// Fall back to slugs the product used to have
+	var redirect models.ProductSlugRedirect
+	if err := models.DB.Where("slug = ?", slug).First(&redirect).Error; err == nil {
+		if err := models.DB.First(&product, redirect.ProductID).Error; err == nil {
+			c.Header("Location", "/api/products/by-slug/"+product.Slug)
+			c.JSON(http.StatusMovedPermanently, gin.H{
+				"redirect": true,
+				"slug":     product.Slug,
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+}
+
+// GetRelatedProducts godoc
+// @Summary Get related products
+// @Description Get products from the same category or brand, and products frequently bought together with this one
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param limit query int false "Maximum products per list" default(6)
+// @Success 200 {object} map[string]interface{} "Related and frequently bought together products"
+// @Failure 400 {object} map[string]interface{} "Invalid product ID"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /products/{id}/related [get]
+func GetRelatedProducts(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "6"))
+	if err != nil || limit < 1 || limit > 12 {
+		limit = 6
+	}
+
+	similar, err := models.Recommendations(uint(id), models.RecommendationSimilar, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related products"})
+		return
+	}
+
+	boughtTogether, err := models.Recommendations(uint(id), models.RecommendationBoughtTogether, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":                    true,
+		"related":                    similar,
+		"frequently_bought_together": boughtTogether,
+	})
+}
+
 // CreateProduct godoc
 // @Summary Create a new product
 // @Description Create a new product (Admin only)
@@ -92,14 +217,33 @@ func CreateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	product.Images = nil // Images are managed through the upload endpoint
+	// Bundles are made by setting components through the bundle endpoint
+	product.IsBundle = false
+	product.BundleItems = nil
 
-	if err := models.DB.Create(&product).Error; err != nil {
+	// Initial stock goes through the inventory ledger like any other change
+	initialStock := product.Stock
+	product.Stock = 0
+	product.LowStockSince = nil
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		_, err := models.ApplyStockChange(tx, product.ID, initialStock,
+			adminStockChange(c, models.MovementRestock, "Initial stock"))
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to create product",
 			"details": err.Error(),
 		})
 		return
 	}
+	product.Stock = initialStock
+	services.QueueLowStockCheck(product.ID)
 
 	c.JSON(http.StatusCreated, product)
 }
@@ -132,16 +276,50 @@ func UpdateProduct(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
+	oldSlug := product.Slug
+	oldStock := product.Stock
+	wasBundle := product.IsBundle
 
 	if err := c.ShouldBindJSON(&product); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	product.Images = nil // Images are managed through the upload endpoint
+	product.IsBundle = wasBundle
+	product.BundleItems = nil
+
+	// Stock edits are applied as a relative ledger adjustment rather than
+	// overwriting the column, so concurrent sales are not lost. A bundle's
+	// stock follows its components and cannot be edited.
+	stockDelta := product.Stock - oldStock
+	if product.IsBundle {
+		stockDelta = 0
+	}
 
-	if err := models.DB.Save(&product).Error; err != nil {
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("stock", "low_stock_since", "cost_price").Save(&product).Error; err != nil {
+			return err
+		}
+		if _, err := models.ApplyStockChange(tx, product.ID, stockDelta,
+			adminStockChange(c, models.MovementAdjustment, "Edited via product update")); err != nil {
+			return err
+		}
+		// Keep the old slug resolving to this product
+		return models.RecordSlugChange(tx, product.ID, oldSlug, product.Slug)
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot go below zero"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
+	models.DB.Select("stock", "low_stock_since").First(&product, product.ID)
+	services.QueueLowStockCheck(product.ID)
+	if oldStock <= 0 && product.Stock > 0 {
+		services.QueueBackInStockCheck(product.ID)
+	}
 
 	c.JSON(http.StatusOK, product)
 }
@@ -167,7 +345,14 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := models.DB.Delete(&models.Product{}, uint(id)).Error; err != nil {
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Product{}, uint(id)).Error; err != nil {
+			return err
+		}
+		// Bundles containing the product can no longer be sold
+		return models.RefreshBundlesContaining(tx, uint(id))
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
 		return
 	}
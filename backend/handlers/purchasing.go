@@ -0,0 +1,625 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SupplierRequest struct {
+	Name        string `json:"name" binding:"required"`
+	ContactName string `json:"contact_name"`
+	Email       string `json:"email" binding:"omitempty,email"`
+	Phone       string `json:"phone"`
+	Notes       string `json:"notes"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+type PurchaseOrderLineRequest struct {
+	ProductID  uint       `json:"product_id" binding:"required" example:"1"`
+	Quantity   int        `json:"quantity" binding:"required,min=1" example:"20"`
+	UnitCost   float64    `json:"unit_cost" binding:"min=0" example:"60.00"`
+	ExpectedAt *time.Time `json:"expected_at"`
+}
+
+type CreatePurchaseOrderRequest struct {
+	SupplierID uint                       `json:"supplier_id" binding:"required" example:"1"`
+	ExpectedAt *time.Time                 `json:"expected_at"`
+	Notes      string                     `json:"notes"`
+	Submit     bool                       `json:"submit" example:"true"` // place the order immediately instead of saving a draft
+	Lines      []PurchaseOrderLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type ReceiveLineRequest struct {
+	LineID   uint `json:"line_id" binding:"required" example:"1"`
+	Quantity int  `json:"quantity" binding:"required,min=1" example:"12"`
+}
+
+type ReceivePurchaseOrderRequest struct {
+	// Lines to receive; leave empty to receive everything outstanding
+	Lines []ReceiveLineRequest `json:"lines" binding:"dive"`
+	Note  string               `json:"note"`
+	// Location the goods arrived at; defaults to the default location
+	LocationID *uint `json:"location_id" example:"1"`
+}
+
+var (
+	errNotReceivable  = errors.New("purchase order cannot be received")
+	errInvalidReceipt = errors.New("invalid receipt")
+)
+
+// GetSuppliers godoc
+// @Summary List suppliers (Admin only)
+// @Description List all suppliers
+// @Tags admin,purchasing
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Suppliers"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/suppliers [get]
+func GetSuppliers(c *gin.Context) {
+	var suppliers []models.Supplier
+	if err := models.DB.Order("name asc").Find(&suppliers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"suppliers": suppliers,
+	})
+}
+
+// CreateSupplier godoc
+// @Summary Create a supplier (Admin only)
+// @Description Create a new supplier
+// @Tags admin,purchasing
+// @Accept json
+// @Produce json
+// @Param supplier body SupplierRequest true "Supplier"
+// @Success 201 {object} models.Supplier
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/suppliers [post]
+func CreateSupplier(c *gin.Context) {
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	supplier := models.Supplier{
+		Name:        req.Name,
+		ContactName: req.ContactName,
+		Email:       req.Email,
+		Phone:       req.Phone,
+		Notes:       req.Notes,
+		IsActive:    req.IsActive == nil || *req.IsActive,
+	}
+
+	if err := adminDB(c).Create(&supplier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create supplier",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, supplier)
+}
+
+// UpdateSupplier godoc
+// @Summary Update a supplier (Admin only)
+// @Description Update an existing supplier
+// @Tags admin,purchasing
+// @Accept json
+// @Produce json
+// @Param id path int true "Supplier ID"
+// @Param supplier body SupplierRequest true "Supplier"
+// @Success 200 {object} models.Supplier
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Supplier not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/suppliers/{id} [put]
+func UpdateSupplier(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := models.DB.First(&supplier, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	supplier.Name = req.Name
+	supplier.ContactName = req.ContactName
+	supplier.Email = req.Email
+	supplier.Phone = req.Phone
+	supplier.Notes = req.Notes
+	if req.IsActive != nil {
+		supplier.IsActive = *req.IsActive
+	}
+
+	if err := adminDB(c).Save(&supplier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update supplier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, supplier)
+}
+
+// GetPurchaseOrders godoc
+// @Summary List purchase orders (Admin only)
+// @Description List purchase orders with optional status and supplier filters
+// @Tags admin,purchasing
+// @Accept json
+// @Produce json
+// @Param status query string false "Filter by status (draft, ordered, partially_received, received, cancelled)"
+// @Param supplier_id query int false "Filter by supplier"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Purchase orders with pagination"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/purchase-orders [get]
+func GetPurchaseOrders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := models.DB.Model(&models.PurchaseOrder{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var orders []models.PurchaseOrder
+	if err := query.Preload("Supplier").Preload("Lines.Product").
+		Order("created_at desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":         true,
+		"purchase_orders": orders,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetPurchaseOrder godoc
+// @Summary Get a purchase order (Admin only)
+// @Description Get a purchase order with its lines
+// @Tags admin,purchasing
+// @Accept json
+// @Produce json
+// @Param id path int true "Purchase order ID"
+// @Success 200 {object} models.PurchaseOrder
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Purchase order not found"
+// @Security BearerAuth
+// @Router /admin/purchase-orders/{id} [get]
+func GetPurchaseOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var po models.PurchaseOrder
+	if err := models.DB.Preload("Supplier").Preload("Lines.Product").First(&po, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, po)
+}
+
+// CreatePurchaseOrder godoc
+// @Summary Create a purchase order (Admin only)
+// @Description Create a purchase order for a supplier, as a draft or placed immediately
+// @Tags admin,purchasing
+// @Accept json
+// @Produce json
+// @Param purchase_order body CreatePurchaseOrderRequest true "Purchase order"
+// @Success 201 {object} models.PurchaseOrder
+// @Failure 400 {object} map[string]interface{} "Invalid request or bundle product"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/purchase-orders [post]
+func CreatePurchaseOrder(c *gin.Context) {
+	var req CreatePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid purchase order",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := models.DB.First(&supplier, req.SupplierID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Supplier with ID %d not found", req.SupplierID)})
+		return
+	}
+
+	adminID := c.GetUint("admin_id")
+	po := models.PurchaseOrder{
+		PONumber:   models.GeneratePONumber(),
+		SupplierID: supplier.ID,
+		Status:     models.PurchaseOrderDraft,
+		ExpectedAt: req.ExpectedAt,
+		Notes:      req.Notes,
+		CreatedBy:  &adminID,
+	}
+	if req.Submit {
+		now := time.Now()
+		po.Status = models.PurchaseOrderOrdered
+		po.OrderedAt = &now
+	}
+
+	for _, line := range req.Lines {
+		var product models.Product
+		if err := models.DB.First(&product, line.ProductID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product with ID %d not found", line.ProductID)})
+			return
+		}
+		if product.IsBundle {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product with ID %d is a bundle; order its components instead", line.ProductID)})
+			return
+		}
+
+		expectedAt := line.ExpectedAt
+		if expectedAt == nil {
+			expectedAt = req.ExpectedAt
+		}
+		po.Lines = append(po.Lines, models.PurchaseOrderLine{
+			ProductID:       product.ID,
+			QuantityOrdered: line.Quantity,
+			UnitCost:        line.UnitCost,
+			ExpectedAt:      expectedAt,
+		})
+	}
+	po.CalculateTotal()
+
+	if err := adminDB(c).Omit("Lines.Product").Create(&po).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create purchase order",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	models.DB.Preload("Supplier").Preload("Lines.Product").First(&po, po.ID)
+	c.JSON(http.StatusCreated, po)
+}
+
+// UpdatePurchaseOrderStatus godoc
+// @Summary Place or cancel a purchase order (Admin only)
+// @Description Move a draft purchase order to ordered, or cancel one that has not been received
+// @Tags admin,purchasing
+// @Accept json
+// @Produce json
+// @Param id path int true "Purchase order ID"
+// @Param status body map[string]string true "New status (ordered or cancelled)"
+// @Success 200 {object} map[string]interface{} "Updated purchase order"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Purchase order not found"
+// @Failure 409 {object} map[string]interface{} "Invalid status transition"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/purchase-orders/{id}/status [put]
+func UpdatePurchaseOrderStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var req struct {
+		Status models.PurchaseOrderStatus `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid status",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var po models.PurchaseOrder
+	if err := models.DB.First(&po, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	switch {
+	case req.Status == models.PurchaseOrderOrdered && po.Status == models.PurchaseOrderDraft:
+		now := time.Now()
+		po.OrderedAt = &now
+	case req.Status == models.PurchaseOrderCancelled &&
+		(po.Status == models.PurchaseOrderDraft || po.Status == models.PurchaseOrderOrdered):
+	default:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Invalid status transition",
+			"current_status": po.Status,
+		})
+		return
+	}
+
+	po.Status = req.Status
+	if err := adminDB(c).Save(&po).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"purchase_order": po,
+	})
+}
+
+// ReceivePurchaseOrder godoc
+// @Summary Receive goods against a purchase order (Admin only)
+// @Description Book received quantities into stock, fully or partially. Received units are added to product stock and the inventory ledger, and update the product's average cost
+// @Tags admin,purchasing
+// @Accept json
+// @Produce json
+// @Param id path int true "Purchase order ID"
+// @Param receipt body ReceivePurchaseOrderRequest false "Quantities received per line; empty receives everything outstanding"
+// @Success 200 {object} map[string]interface{} "Updated purchase order"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Purchase order not found"
+// @Failure 409 {object} map[string]interface{} "Purchase order cannot be received"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/purchase-orders/{id}/receive [post]
+func ReceivePurchaseOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var req ReceivePurchaseOrderRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid receipt",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	var po models.PurchaseOrder
+	var received []uint
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Lines").First(&po, uint(id)).Error; err != nil {
+			return err
+		}
+		if !po.CanReceive() {
+			return errNotReceivable
+		}
+
+		// Work out how much to book in per line
+		quantities := make(map[uint]int)
+		if len(req.Lines) == 0 {
+			for _, line := range po.Lines {
+				if line.Remaining() > 0 {
+					quantities[line.ID] = line.Remaining()
+				}
+			}
+		} else {
+			for _, r := range req.Lines {
+				quantities[r.LineID] += r.Quantity
+			}
+		}
+
+		for lineID := range quantities {
+			found := false
+			for _, line := range po.Lines {
+				if line.ID == lineID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%w: line %d is not on this purchase order", errInvalidReceipt, lineID)
+			}
+		}
+
+		for i := range po.Lines {
+			line := &po.Lines[i]
+			qty, ok := quantities[line.ID]
+			if !ok {
+				continue
+			}
+			if qty > line.Remaining() {
+				return fmt.Errorf("%w: line %d has %d outstanding, cannot receive %d",
+					errInvalidReceipt, line.ID, line.Remaining(), qty)
+			}
+
+			change := adminStockChange(c, models.MovementRestock, "Received on "+po.PONumber)
+			if req.Note != "" {
+				change.Note += ": " + req.Note
+			}
+			change.PurchaseOrderID = &po.ID
+			change.LocationID = req.LocationID
+			if _, err := models.ReceiveStock(tx, line.ProductID, qty, line.UnitCost, change); err != nil {
+				return err
+			}
+
+			line.QuantityReceived += qty
+			if err := tx.Model(line).UpdateColumn("quantity_received", line.QuantityReceived).Error; err != nil {
+				return err
+			}
+			received = append(received, line.ProductID)
+		}
+
+		po.RefreshReceiptStatus()
+		return tx.Omit("Lines").Save(&po).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		case errors.Is(err, errNotReceivable):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "Purchase order cannot be received",
+				"current_status": po.Status,
+			})
+		case errors.Is(err, errInvalidReceipt):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrLocationNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Location not found"})
+		case errors.Is(err, models.ErrBundleStock):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bundles cannot be received, receive their components instead"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to receive purchase order"})
+		}
+		return
+	}
+
+	services.QueueLowStockCheck(received...)
+	services.QueueBackInStockCheck(received...)
+
+	models.DB.Preload("Supplier").Preload("Lines.Product").First(&po, po.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"message":        "Stock received",
+		"purchase_order": po,
+	})
+}
+
+// GetMarginReport godoc
+// @Summary Product margin report (Admin only)
+// @Description Revenue, cost of goods sold and gross margin per product for paid orders, using the cost price recorded when each item was paid for
+// @Tags admin,reports
+// @Accept json
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} map[string]interface{} "Margin report"
+// @Failure 400 {object} map[string]interface{} "Invalid date"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/reports/margins [get]
+func GetMarginReport(c *gin.Context) {
+	query := models.DB.Table("order_items").
+		Select("order_items.product_id, products.name AS product_name, "+
+			"SUM(order_items.quantity) AS units_sold, "+
+			"SUM(order_items.price * order_items.quantity) AS revenue, "+
+			"SUM(order_items.unit_cost * order_items.quantity) AS cost").
+		Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+		Joins("JOIN products ON products.id = order_items.product_id").
+		Where("orders.status IN ?", []models.OrderStatus{models.OrderStatusPaid, models.OrderStatusShipped, models.OrderStatusDelivered}).
+		Group("order_items.product_id, products.name").
+		Order("revenue desc")
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, use YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("orders.created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, use YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("orders.created_at < ?", t.AddDate(0, 0, 1))
+	}
+
+	type marginRow struct {
+		ProductID   uint    `json:"product_id"`
+		ProductName string  `json:"product_name"`
+		UnitsSold   int     `json:"units_sold"`
+		Revenue     float64 `json:"revenue"`
+		Cost        float64 `json:"cost"`
+		Margin      float64 `json:"margin"`
+		MarginPct   float64 `json:"margin_percent"`
+	}
+
+	var rows []marginRow
+	if err := query.Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build margin report"})
+		return
+	}
+
+	var totalRevenue, totalCost float64
+	for i := range rows {
+		rows[i].Margin = rows[i].Revenue - rows[i].Cost
+		if rows[i].Revenue > 0 {
+			rows[i].MarginPct = rows[i].Margin / rows[i].Revenue * 100
+		}
+		totalRevenue += rows[i].Revenue
+		totalCost += rows[i].Cost
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"products": rows,
+		"totals": gin.H{
+			"revenue": totalRevenue,
+			"cost":    totalCost,
+			"margin":  totalRevenue - totalCost,
+		},
+	})
+}
@@ -0,0 +1,919 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReturnItemRequest struct {
+	OrderItemID  uint                `json:"order_item_id" binding:"required" example:"7"`
+	Quantity     int                 `json:"quantity" binding:"required,min=1" example:"1"`
+	Reason       models.ReturnReason `json:"reason" binding:"required" example:"wrong_size"`
+	Comment      string              `json:"comment" binding:"max=500" example:"Sleeves too long"`
+	ExchangeSize string              `json:"exchange_size" example:"A1"` // for exchanges; defaults to the size ordered
+}
+
+type CreateReturnRequest struct {
+	OrderNumber string                  `json:"order_number" binding:"required" example:"BJJ-1753519000"`
+	Email       string                  `json:"email" binding:"required,email" example:"customer@example.com"`
+	Resolution  models.ReturnResolution `json:"resolution" binding:"required" example:"exchange"`
+	Comment     string                  `json:"comment" binding:"max=2000"`
+	Items       []ReturnItemRequest     `json:"items" binding:"required,min=1,dive"`
+}
+
+type ReturnDecisionRequest struct {
+	Notes string `json:"notes" example:"Approved, please include the RMA number in the parcel"`
+}
+
+type InspectionRequest struct {
+	ReturnItemID uint                 `json:"return_item_id" binding:"required" example:"1"`
+	Condition    models.ItemCondition `json:"condition" binding:"required" example:"resaleable"`
+}
+
+type ReceiveReturnRequest struct {
+	// Condition of each returned item; resaleable items go back into stock
+	Items []InspectionRequest `json:"items" binding:"required,min=1,dive"`
+	// Location the goods arrived at; defaults to the default location
+	LocationID *uint  `json:"location_id" example:"1"`
+	Notes      string `json:"notes"`
+}
+
+type ResolveReturnRequest struct {
+	// Overrides the resolution the customer asked for
+	Resolution models.ReturnResolution `json:"resolution" example:"store_credit"`
+	// Refund or store credit amount; defaults to what was paid for the items
+	Amount *float64 `json:"amount" example:"110.00"`
+	Notes  string   `json:"notes"`
+}
+
+var (
+	errReturnState    = errors.New("return cannot move to that status")
+	errInvalidReturn  = errors.New("invalid return")
+	errExchangeStock  = errors.New("not enough stock for the exchange")
+	errReturnNotFound = errors.New("return not found")
+)
+
+// sendReturnEmail keeps the customer informed of their return's progress.
+func sendReturnEmail(ret *models.ReturnRequest, subject, body string) {
+	site := config.AppConfig.Site
+	err := newMailer().Send(context.Background(), services.Email{
+		To:      ret.Email,
+		Subject: fmt.Sprintf("%s: return %s", subject, ret.RMANumber),
+		Body:    body + "\n\nThank you for shopping at " + site.Brand + ".",
+	})
+	if err != nil {
+		log.Printf("Failed to email return %s: %v", ret.RMANumber, err)
+	}
+}
+
+// loadReturn fetches a return with its items and their order items.
+func loadReturn(tx *gorm.DB, id uint) (*models.ReturnRequest, error) {
+	var ret models.ReturnRequest
+	if err := tx.Preload("Items.OrderItem.Product").First(&ret, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errReturnNotFound
+		}
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// bundleComponentsSold works out the components quantity units of a bundle
+// order line were sold as, from the order's sale movements, so a bundle
+// changed since the sale does not put the wrong products back. The order's
+// other lines are taken out of its movements first, other bundles at their
+// current composition. Orders without sale movements fall back to the
+// bundle's current composition.
+func bundleComponentsSold(tx *gorm.DB, orderID uint, line models.OrderItem, bundle *models.Product, quantity int) (map[uint]int, error) {
+	allocations, err := models.OrderStockAllocations(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(allocations) == 0 || line.Quantity <= 0 {
+		return bundle.ComponentQuantities(quantity), nil
+	}
+	held := make(map[uint]int)
+	for _, allocation := range allocations {
+		held[allocation.ProductID] += allocation.Quantity
+	}
+
+	var others []models.OrderItem
+	if err := tx.Where("order_id = ? AND id <> ?", orderID, line.ID).Find(&others).Error; err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		taken := other.Quantity - other.BackorderedQuantity
+		var product models.Product
+		if err := tx.Unscoped().Preload("BundleItems").First(&product, other.ProductID).Error; err == nil && product.IsBundle {
+			for componentID, q := range product.ComponentQuantities(taken) {
+				held[componentID] -= q
+			}
+			continue
+		}
+		held[other.ProductID] -= taken
+	}
+
+	components := make(map[uint]int)
+	for productID, sold := range held {
+		if returned := sold * quantity / line.Quantity; returned > 0 {
+			components[productID] = returned
+		}
+	}
+	return components, nil
+}
+
+// CreateReturn godoc
+// @Summary Request a return
+// @Description Request a return of items from a delivered order within the return window. The order number and email must match the order
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param return body CreateReturnRequest true "Return request"
+// @Success 201 {object} models.ReturnRequest
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Failure 409 {object} map[string]interface{} "Order cannot be returned"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /returns [post]
+func CreateReturn(c *gin.Context) {
+	var req CreateReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid return request",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	validResolution := false
+	for _, resolution := range models.ReturnResolutions {
+		if req.Resolution == resolution {
+			validResolution = true
+			break
+		}
+	}
+	if !validResolution {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "Invalid resolution",
+			"valid_resolutions": models.ReturnResolutions,
+		})
+		return
+	}
+
+	var order models.Order
+	if err := models.DB.Preload("Items.Product").
+		Where("order_number = ? AND LOWER(guest_email) = ?", req.OrderNumber, strings.ToLower(req.Email)).
+		First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status != models.OrderStatusDelivered {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Only delivered orders can be returned",
+			"current_status": order.Status,
+		})
+		return
+	}
+	if deadline := order.ReturnableUntil(config.AppConfig.Orders.ReturnWindow); time.Now().After(deadline) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":            "The return window for this order has closed",
+			"returnable_until": deadline,
+		})
+		return
+	}
+
+	ret := models.ReturnRequest{
+		RMANumber:  models.GenerateRMANumber(),
+		OrderID:    order.ID,
+		Email:      strings.ToLower(order.GuestEmail),
+		Status:     models.ReturnRequested,
+		Resolution: req.Resolution,
+		Comment:    strings.TrimSpace(req.Comment),
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialize returns against the same order so units cannot be
+		// returned twice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Order{}, order.ID).Error; err != nil {
+			return err
+		}
+		returned, err := models.ReturnedQuantities(tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range req.Items {
+			var item *models.OrderItem
+			for i := range order.Items {
+				if order.Items[i].ID == r.OrderItemID {
+					item = &order.Items[i]
+					break
+				}
+			}
+			if item == nil {
+				return fmt.Errorf("%w: item %d is not on this order", errInvalidReturn, r.OrderItemID)
+			}
+
+			validReason := false
+			for _, reason := range models.ReturnReasons {
+				if r.Reason == reason {
+					validReason = true
+					break
+				}
+			}
+			if !validReason {
+				return fmt.Errorf("%w: unknown reason %q", errInvalidReturn, r.Reason)
+			}
+
+			returned[item.ID] += r.Quantity
+			if returned[item.ID] > item.Quantity {
+				return fmt.Errorf("%w: only %d of %s can be returned", errInvalidReturn,
+					item.Quantity-(returned[item.ID]-r.Quantity), item.Product.Name)
+			}
+
+			exchangeSize := ""
+			if req.Resolution == models.ResolutionExchange {
+				exchangeSize = item.Size
+				if size := strings.TrimSpace(r.ExchangeSize); size != "" {
+					exchangeSize = ""
+					for _, option := range item.Product.GetSizeOptionsArray() {
+						if strings.EqualFold(option, size) {
+							exchangeSize = option
+							break
+						}
+					}
+					if exchangeSize == "" {
+						return fmt.Errorf("%w: %s is not available in size %s", errInvalidReturn, item.Product.Name, size)
+					}
+				}
+			}
+
+			ret.Items = append(ret.Items, models.ReturnItem{
+				OrderItemID:  item.ID,
+				ProductID:    item.ProductID,
+				Quantity:     r.Quantity,
+				UnitPrice:    item.Price,
+				Reason:       r.Reason,
+				Comment:      strings.TrimSpace(r.Comment),
+				ExchangeSize: exchangeSize,
+			})
+		}
+
+		return tx.Create(&ret).Error
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidReturn) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":         err.Error(),
+				"valid_reasons": models.ReturnReasons,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create return request"})
+		return
+	}
+
+	sendReturnEmail(&ret, "We received your return request",
+		fmt.Sprintf("Your request to return items from order %s has been received as %s. "+
+			"We will let you know once it has been reviewed.", order.OrderNumber, ret.RMANumber))
+
+	c.JSON(http.StatusCreated, ret)
+}
+
+// TrackReturn godoc
+// @Summary Track a return
+// @Description Track a return by its RMA number
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param rmaNumber path string true "RMA number"
+// @Success 200 {object} map[string]interface{} "Return details"
+// @Failure 404 {object} map[string]interface{} "Return not found"
+// @Router /returns/track/{rmaNumber} [get]
+func TrackReturn(c *gin.Context) {
+	rmaNumber := c.Param("rmaNumber")
+
+	var ret models.ReturnRequest
+	if err := models.DB.Preload("Items.OrderItem.Product").Where("rma_number = ?", rmaNumber).First(&ret).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":      "Return not found",
+			"rma_number": rmaNumber,
+		})
+		return
+	}
+	ret.AdminNotes = ""
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"return":  ret,
+	})
+}
+
+// GetReturns godoc
+// @Summary List returns (Admin only)
+// @Description List return requests, newest first
+// @Tags admin,returns
+// @Accept json
+// @Produce json
+// @Param status query string false "Filter by status (requested, approved, rejected, received, completed)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Returns with pagination"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/returns [get]
+func GetReturns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := models.DB.Model(&models.ReturnRequest{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var returns []models.ReturnRequest
+	if err := query.Preload("Items").Order("id desc").Limit(limit).Offset(offset).Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"returns": returns,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetReturn godoc
+// @Summary Get a return (Admin only)
+// @Description Get a return request with its items and order
+// @Tags admin,returns
+// @Accept json
+// @Produce json
+// @Param id path int true "Return ID"
+// @Success 200 {object} models.ReturnRequest
+// @Failure 400 {object} map[string]interface{} "Invalid return ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Return not found"
+// @Security BearerAuth
+// @Router /admin/returns/{id} [get]
+func GetReturn(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return
+	}
+
+	var ret models.ReturnRequest
+	if err := models.DB.Preload("Order").Preload("Items.OrderItem.Product").First(&ret, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// ApproveReturn godoc
+// @Summary Approve a return (Admin only)
+// @Description Approve a requested return; the customer is emailed to send the items back
+// @Tags admin,returns
+// @Accept json
+// @Produce json
+// @Param id path int true "Return ID"
+// @Param decision body ReturnDecisionRequest false "Notes"
+// @Success 200 {object} models.ReturnRequest
+// @Failure 400 {object} map[string]interface{} "Invalid return ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Return not found"
+// @Failure 409 {object} map[string]interface{} "Return cannot be approved"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/returns/{id}/approve [put]
+func ApproveReturn(c *gin.Context) {
+	updateReturnDecision(c, models.ReturnApproved)
+}
+
+// RejectReturn godoc
+// @Summary Reject a return (Admin only)
+// @Description Reject a requested or approved return. The notes are sent to the customer as the reason
+// @Tags admin,returns
+// @Accept json
+// @Produce json
+// @Param id path int true "Return ID"
+// @Param decision body ReturnDecisionRequest false "Reason"
+// @Success 200 {object} models.ReturnRequest
+// @Failure 400 {object} map[string]interface{} "Invalid return ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Return not found"
+// @Failure 409 {object} map[string]interface{} "Return cannot be rejected"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/returns/{id}/reject [put]
+func RejectReturn(c *gin.Context) {
+	updateReturnDecision(c, models.ReturnRejected)
+}
+
+func updateReturnDecision(c *gin.Context, status models.ReturnStatus) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return
+	}
+
+	var req ReturnDecisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ret, err := loadReturn(models.DB, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+	if !ret.CanTransition(status) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Return cannot be " + string(status),
+			"current_status": ret.Status,
+		})
+		return
+	}
+
+	updates := map[string]interface{}{"status": status}
+	if adminID := c.GetUint("admin_id"); adminID != 0 {
+		updates["processed_by"] = adminID
+	}
+	if status == models.ReturnApproved {
+		updates["approved_at"] = time.Now()
+		if req.Notes != "" {
+			updates["admin_notes"] = req.Notes
+		}
+	} else {
+		updates["rejection_reason"] = req.Notes
+	}
+
+	// Only move the return on if nobody else has in the meantime
+	result := adminDB(c).Model(ret).Where("status = ?", ret.Status).Updates(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update return"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Return was updated by someone else, reload and try again"})
+		return
+	}
+
+	if status == models.ReturnApproved {
+		sendReturnEmail(ret, "Your return was approved",
+			"Please send the items back with "+ret.RMANumber+" written clearly on the parcel.")
+	} else {
+		body := "We are unable to accept your return."
+		if req.Notes != "" {
+			body += "\n\nReason: " + req.Notes
+		}
+		sendReturnEmail(ret, "Your return was not accepted", body)
+	}
+
+	ret, _ = loadReturn(models.DB, ret.ID)
+	c.JSON(http.StatusOK, ret)
+}
+
+// ReceiveReturn godoc
+// @Summary Receive and inspect a return (Admin only)
+// @Description Record the condition of each item that arrived back. Resaleable items are returned to stock and recorded in the inventory ledger; damaged items are not
+// @Tags admin,returns
+// @Accept json
+// @Produce json
+// @Param id path int true "Return ID"
+// @Param inspection body ReceiveReturnRequest true "Inspection results"
+// @Success 200 {object} models.ReturnRequest
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Return not found"
+// @Failure 409 {object} map[string]interface{} "Return is not awaiting receipt"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/returns/{id}/receive [post]
+func ReceiveReturn(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return
+	}
+
+	var req ReceiveReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid inspection",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var ret *models.ReturnRequest
+	var restocked []uint
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if ret, err = loadReturn(tx.Clauses(clause.Locking{Strength: "UPDATE"}), uint(id)); err != nil {
+			return err
+		}
+		if !ret.CanTransition(models.ReturnReceived) {
+			return errReturnState
+		}
+
+		conditions := make(map[uint]models.ItemCondition)
+		for _, r := range req.Items {
+			if r.Condition != models.ConditionResaleable && r.Condition != models.ConditionDamaged {
+				return fmt.Errorf("%w: condition must be %s or %s", errInvalidReturn,
+					models.ConditionResaleable, models.ConditionDamaged)
+			}
+			conditions[r.ReturnItemID] = r.Condition
+		}
+		for _, item := range ret.Items {
+			if _, ok := conditions[item.ID]; !ok {
+				return fmt.Errorf("%w: no condition given for return item %d", errInvalidReturn, item.ID)
+			}
+		}
+		if len(conditions) != len(ret.Items) {
+			return fmt.Errorf("%w: inspection lists items that are not on this return", errInvalidReturn)
+		}
+
+		for i := range ret.Items {
+			item := &ret.Items[i]
+			item.Condition = conditions[item.ID]
+			item.Restocked = item.Condition == models.ConditionResaleable
+
+			if item.Restocked {
+				change := adminStockChange(c, models.MovementReturn, "Returned on "+ret.RMANumber)
+				if req.Notes != "" {
+					change.Note += ": " + req.Notes
+				}
+				change.OrderID = &ret.OrderID
+				change.ReturnRequestID = &ret.ID
+				change.LocationID = req.LocationID
+
+				// Bundles were sold as their components, so put those back
+				quantities := map[uint]int{item.ProductID: item.Quantity}
+				var product models.Product
+				if err := tx.Unscoped().Preload("BundleItems").First(&product, item.ProductID).Error; err == nil && product.IsBundle && item.OrderItem != nil {
+					if quantities, err = bundleComponentsSold(tx, ret.OrderID, *item.OrderItem, &product, item.Quantity); err != nil {
+						return err
+					}
+				}
+				for productID, quantity := range quantities {
+					if _, err := models.ApplyStockChange(tx, productID, quantity, change); err != nil {
+						return err
+					}
+					restocked = append(restocked, productID)
+				}
+			}
+
+			if err := tx.Model(item).UpdateColumns(map[string]interface{}{
+				"condition": item.Condition,
+				"restocked": item.Restocked,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"status":      models.ReturnReceived,
+			"received_at": now,
+		}
+		if req.Notes != "" {
+			updates["admin_notes"] = strings.TrimSpace(ret.AdminNotes + "\n" + req.Notes)
+		}
+		return tx.Model(ret).Updates(updates).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errReturnNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		case errors.Is(err, errReturnState):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "Return is not awaiting receipt",
+				"current_status": ret.Status,
+			})
+		case errors.Is(err, errInvalidReturn):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrLocationNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Location not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to receive return"})
+		}
+		return
+	}
+
+	services.QueueLowStockCheck(restocked...)
+	services.QueueBackInStockCheck(restocked...)
+
+	ret, _ = loadReturn(models.DB, ret.ID)
+	c.JSON(http.StatusOK, ret)
+}
+
+// ResolveReturn godoc
+// @Summary Resolve a received return (Admin only)
+// @Description Complete a return with a refund, an exchange or store credit. Refunds go back on the gift card that paid for the order first and then to the card; exchanges ship the requested sizes as a new order at no charge; store credit is issued as a gift card and emailed to the customer
+// @Tags admin,returns
+// @Accept json
+// @Produce json
+// @Param id path int true "Return ID"
+// @Param resolution body ResolveReturnRequest false "Resolution"
+// @Success 200 {object} map[string]interface{} "Completed return"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Return not found"
+// @Failure 409 {object} map[string]interface{} "Return is not ready to resolve or not enough stock for the exchange"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/returns/{id}/resolve [post]
+func ResolveReturn(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return
+	}
+
+	var req ResolveReturnRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid resolution",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	var ret *models.ReturnRequest
+	var credit *models.GiftCard
+	var creditCode string
+	var exchangeOrder *models.Order
+	var shipped []uint
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if ret, err = loadReturn(tx.Clauses(clause.Locking{Strength: "UPDATE"}), uint(id)); err != nil {
+			return err
+		}
+		if !ret.CanTransition(models.ReturnCompleted) {
+			return errReturnState
+		}
+
+		var order models.Order
+		if err := tx.First(&order, ret.OrderID).Error; err != nil {
+			return err
+		}
+
+		resolution := ret.Resolution
+		if req.Resolution != "" {
+			resolution = req.Resolution
+		}
+		amount := ret.ItemsTotal()
+		if req.Amount != nil {
+			amount = models.RoundMoney(*req.Amount)
+		}
+		if resolution != models.ResolutionExchange && (amount < 0 || amount > ret.ItemsTotal()) {
+			return fmt.Errorf("%w: amount must be between 0 and %.2f", errInvalidReturn, ret.ItemsTotal())
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"status":       models.ReturnCompleted,
+			"resolution":   resolution,
+			"completed_at": now,
+		}
+		if adminID := c.GetUint("admin_id"); adminID != 0 {
+			updates["processed_by"] = adminID
+		}
+		if req.Notes != "" {
+			updates["admin_notes"] = strings.TrimSpace(ret.AdminNotes + "\n" + req.Notes)
+		}
+
+		switch resolution {
+		case models.ResolutionRefund:
+			// Put the gift card share of the payment back on the card first
+			giftCardRefund := 0.0
+			if order.GiftCardID != nil && order.GiftCardAmount > 0 {
+				alreadyRefunded, err := models.ReturnedToGiftCard(tx, order.ID)
+				if err != nil {
+					return err
+				}
+				giftCardRefund = models.RoundMoney(math.Max(0, math.Min(amount, order.GiftCardAmount-alreadyRefunded)))
+				if giftCardRefund > 0 {
+					change := models.GiftCardChange{
+						Type:    models.GiftCardRefunded,
+						OrderID: &order.ID,
+						Actor:   c.GetString("admin_email"),
+						Note:    "Refund for return " + ret.RMANumber,
+					}
+					if adminID := c.GetUint("admin_id"); adminID != 0 {
+						change.AdminID = &adminID
+					}
+					if _, err := models.ApplyGiftCardChange(tx, *order.GiftCardID, giftCardRefund, change); err != nil {
+						return err
+					}
+				}
+			}
+			updates["refund_amount"] = amount
+			updates["gift_card_refund"] = giftCardRefund
+			if amount > giftCardRefund {
+				// Mock gateway: refund the rest to the card the order was paid with
+				updates["refund_reference"] = fmt.Sprintf("RFD-%d", now.UnixMilli())
+			}
+
+		case models.ResolutionStoreCredit:
+			if amount <= 0 {
+				return fmt.Errorf("%w: store credit amount must be positive", errInvalidReturn)
+			}
+			issue := models.GiftCardIssue{
+				Kind:           models.GiftCardStoreCredit,
+				Amount:         amount,
+				ExpiresAt:      giftCardExpiry(models.GiftCardStoreCredit),
+				RecipientEmail: ret.Email,
+				OrderID:        &order.ID,
+				Actor:          c.GetString("admin_email"),
+				Note:           "Store credit for return " + ret.RMANumber,
+			}
+			if adminID := c.GetUint("admin_id"); adminID != 0 {
+				issue.AdminID = &adminID
+			}
+			credit, creditCode, err = models.IssueGiftCard(tx, issue)
+			if err != nil {
+				return err
+			}
+			updates["refund_amount"] = amount
+			updates["store_credit_id"] = credit.ID
+
+		case models.ResolutionExchange:
+			exchangeOrder, shipped, err = createExchangeOrder(c, tx, ret, &order)
+			if err != nil {
+				return err
+			}
+			updates["exchange_order_id"] = exchangeOrder.ID
+
+		default:
+			return fmt.Errorf("%w: resolution must be one of refund, exchange, store_credit", errInvalidReturn)
+		}
+
+		return tx.Model(ret).Updates(updates).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errReturnNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		case errors.Is(err, errReturnState):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "Only received returns can be resolved",
+				"current_status": ret.Status,
+			})
+		case errors.Is(err, errExchangeStock):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Not enough stock for the exchange",
+				"details": "Restock the requested sizes or resolve with a refund or store credit instead",
+			})
+		case errors.Is(err, errInvalidReturn):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve return"})
+		}
+		return
+	}
+
+	ret, _ = loadReturn(models.DB, ret.ID)
+	switch {
+	case credit != nil:
+		sendGiftCardEmail(credit, creditCode)
+		sendReturnEmail(ret, "Your return is complete",
+			fmt.Sprintf("We have issued %.2f %s of store credit for your return. The code is in a separate email.",
+				credit.Balance, config.AppConfig.Site.Currency))
+	case exchangeOrder != nil:
+		services.QueueLowStockCheck(shipped...)
+		sendReturnEmail(ret, "Your exchange is on its way",
+			"Your replacement items will ship as order "+exchangeOrder.OrderNumber+".")
+	default:
+		sendReturnEmail(ret, "Your return is complete",
+			fmt.Sprintf("We have refunded %.2f %s for your return.", ret.RefundAmount, config.AppConfig.Site.Currency))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"return":         ret,
+		"exchange_order": exchangeOrder,
+	})
+}
+
+// createExchangeOrder ships the replacement items for an exchange as a new,
+// already paid order at no charge, taking them from stock.
+func createExchangeOrder(c *gin.Context, tx *gorm.DB, ret *models.ReturnRequest, original *models.Order) (*models.Order, []uint, error) {
+	now := time.Now()
+	order := models.Order{
+		OrderNumber:     "EXC-" + strings.TrimPrefix(ret.RMANumber, "RMA-"),
+		GuestEmail:      original.GuestEmail,
+		ShippingAddress: original.ShippingAddress,
+		Status:          models.OrderStatusPaid,
+		StripePaymentID: ret.RMANumber,
+		PaymentCapture:  models.PaymentCaptured,
+		CapturedAt:      &now,
+	}
+
+	shipNow := make(map[uint]int)
+	for _, item := range ret.Items {
+		var product models.Product
+		if err := tx.Preload("BundleItems.Component").First(&product, item.ProductID).Error; err != nil {
+			return nil, nil, fmt.Errorf("%w: product %d no longer exists", errInvalidReturn, item.ProductID)
+		}
+
+		// Returns resolved as an exchange against the customer's wishes swap
+		// like for like
+		size := item.ExchangeSize
+		if size == "" && item.OrderItem != nil {
+			size = item.OrderItem.Size
+		}
+
+		unitCost := product.CostPrice
+		if product.IsBundle {
+			unitCost = product.BundleCost()
+			for componentID, quantity := range product.ComponentQuantities(item.Quantity) {
+				shipNow[componentID] += quantity
+			}
+		} else {
+			shipNow[product.ID] += item.Quantity
+		}
+
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID:   product.ID,
+			Quantity:    item.Quantity,
+			Price:       0,
+			UnitCost:    unitCost,
+			Size:        size,
+			Fulfillment: models.FulfillFromStock,
+		})
+	}
+	order.CalculateTotal()
+
+	if err := tx.Create(&order).Error; err != nil {
+		return nil, nil, err
+	}
+
+	allocations, err := models.AllocateOrderStock(tx, shipNow)
+	if err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			return nil, nil, errExchangeStock
+		}
+		return nil, nil, err
+	}
+	shipped := make([]uint, 0, len(allocations))
+	for _, allocation := range allocations {
+		change := adminStockChange(c, models.MovementSale, "Exchange for "+ret.RMANumber)
+		change.OrderID = &order.ID
+		change.ReturnRequestID = &ret.ID
+		change.LocationID = allocation.LocationID
+		if _, err := models.ApplyStockChange(tx, allocation.ProductID, -allocation.Quantity, change); err != nil {
+			if errors.Is(err, models.ErrInsufficientStock) {
+				return nil, nil, errExchangeStock
+			}
+			return nil, nil, err
+		}
+		shipped = append(shipped, allocation.ProductID)
+	}
+	order.FulfillmentLocationID = models.SingleLocation(allocations)
+	if err := tx.Model(&order).UpdateColumn("fulfillment_location_id", order.FulfillmentLocationID).Error; err != nil {
+		return nil, nil, err
+	}
+	return &order, shipped, nil
+}
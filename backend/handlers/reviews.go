@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateReviewRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	Name   string `json:"name" binding:"max=100"`
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Title  string `json:"title" binding:"max=200"`
+	Body   string `json:"body" binding:"max=5000"`
+}
+
+type ModerateReviewRequest struct {
+	Note string `json:"note"`
+}
+
+// CreateReview godoc
+// @Summary Submit a product review
+// @Description Submit a review for a product. Reviews are published once approved by an admin. Reviews from emails with a paid order for the product are marked as verified purchases
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param review body CreateReviewRequest true "Review"
+// @Success 201 {object} models.Review
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "Product not found"
+// @Failure 409 {object} map[string]interface{} "Already reviewed"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /products/{id}/reviews [post]
+func CreateReview(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req CreateReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid review",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var product models.Product
+	if err := models.DB.First(&product, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	// One live review per customer per product
+	var existing int64
+	models.DB.Model(&models.Review{}).
+		Where("product_id = ? AND email = ? AND status <> ?", product.ID, email, models.ReviewStatusRejected).
+		Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already reviewed this product"})
+		return
+	}
+
+	review := models.Review{
+		ProductID:        product.ID,
+		Email:            email,
+		Name:             strings.TrimSpace(req.Name),
+		Rating:           req.Rating,
+		Title:            strings.TrimSpace(req.Title),
+		Body:             strings.TrimSpace(req.Body),
+		VerifiedPurchase: models.HasPurchased(email, product.ID),
+		Status:           models.ReviewStatusPending,
+	}
+
+	if err := models.DB.Create(&review).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit review"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, review)
+}
+
+// GetProductReviews godoc
+// @Summary Get product reviews
+// @Description Get approved reviews for a product, newest first
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} map[string]interface{} "Reviews with rating summary"
+// @Failure 400 {object} map[string]interface{} "Invalid product ID"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /products/{id}/reviews [get]
+func GetProductReviews(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var reviews []models.Review
+	if err := models.DB.Where("product_id = ? AND status = ?", uint(id), models.ReviewStatusApproved).
+		Order("created_at desc").
+		Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	summaries, err := models.RatingSummaries([]uint{uint(id)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+	summary := summaries[uint(id)]
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"reviews":        reviews,
+		"average_rating": summary.AverageRating,
+		"review_count":   summary.ReviewCount,
+	})
+}
+
+// GetReviews godoc
+// @Summary List reviews for moderation (Admin only)
+// @Description List reviews, optionally filtered by moderation status
+// @Tags admin,reviews
+// @Accept json
+// @Produce json
+// @Param status query string false "Filter by status (pending, approved, rejected)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Reviews list with pagination"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/reviews [get]
+func GetReviews(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := models.DB.Model(&models.Review{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	// Admins need the reviewer email, which is hidden from the public JSON
+	type adminReview struct {
+		models.Review
+		Email string `json:"email"`
+	}
+	var reviews []models.Review
+	if err := query.Order("created_at desc").Limit(limit).Offset(offset).Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+	result := make([]adminReview, len(reviews))
+	for i, review := range reviews {
+		result[i] = adminReview{Review: review, Email: review.Email}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"reviews": result,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// ApproveReview godoc
+// @Summary Approve a review (Admin only)
+// @Description Publish a review so it counts towards the product rating
+// @Tags admin,reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Review ID"
+// @Param moderation body ModerateReviewRequest false "Optional moderation note"
+// @Success 200 {object} map[string]interface{} "Updated review"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Review not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/reviews/{id}/approve [put]
+func ApproveReview(c *gin.Context) {
+	moderateReview(c, models.ReviewStatusApproved)
+}
+
+// RejectReview godoc
+// @Summary Reject a review (Admin only)
+// @Description Hide a review from the storefront
+// @Tags admin,reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Review ID"
+// @Param moderation body ModerateReviewRequest false "Optional moderation note"
+// @Success 200 {object} map[string]interface{} "Updated review"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 404 {object} map[string]interface{} "Review not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/reviews/{id}/reject [put]
+func RejectReview(c *gin.Context) {
+	moderateReview(c, models.ReviewStatusRejected)
+}
+
+func moderateReview(c *gin.Context, status models.ReviewStatus) {
+	reviewID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	// The note is optional, so an empty body is fine
+	var req ModerateReviewRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	var review models.Review
+	if err := models.DB.First(&review, uint(reviewID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+
+	adminID := c.GetUint("admin_id")
+	now := time.Now()
+	review.Status = status
+	review.ModeratedBy = &adminID
+	review.ModeratedAt = &now
+	review.ModerationNote = req.Note
+
+	if err := adminDB(c).Save(&review).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Review " + string(status),
+		"review":  review,
+	})
+}
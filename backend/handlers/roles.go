@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=64" example:"support"`
+	Description string   `json:"description" example:"Customer support team"`
+	Permissions []string `json:"permissions" example:"view_orders,manage_returns"`
+	// Admins with the role must set up two-factor authentication
+	RequireTwoFactor bool `json:"require_two_factor" example:"false"`
+}
+
+// UpdateRoleRequest changes only the fields that are sent.
+type UpdateRoleRequest struct {
+	Description      *string `json:"description" example:"Customer support team"`
+	RequireTwoFactor *bool   `json:"require_two_factor" example:"false"`
+	// Replaces the role's permissions. Leave out to keep them; an empty list
+	// clears them
+	Permissions []string `json:"permissions" example:"view_orders,manage_returns"`
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// lookupPermissions loads the named permissions, returning the names that are
+// not in the catalog.
+func lookupPermissions(names []string) ([]models.Permission, []string, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil, nil
+	}
+	if err := models.DB.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		found[p.Name] = true
+	}
+	var unknown []string
+	for _, name := range names {
+		if !found[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	return permissions, unknown, nil
+}
+
+// roleEditable checks that the signed-in admin's own role covers role, so
+// nobody can change or remove a role with more access than they have. Roles
+// with every permission can only be changed by admins who have one.
+func roleEditable(c *gin.Context, role models.Role) bool {
+	covered, err := models.RoleCovers(c.MustGet("admin_role").(models.AdminRole), role.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !covered {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot change roles with permissions your own role does not have"})
+		return false
+	}
+	return true
+}
+
+// permissionsBeyondCaller returns the names the signed-in admin's own role
+// does not grant. Admins can only hand out permissions they have.
+func permissionsBeyondCaller(c *gin.Context, names []string) ([]string, error) {
+	role := c.MustGet("admin_role").(models.AdminRole)
+	var beyond []string
+	for _, name := range names {
+		allowed, err := models.RoleHasPermission(role, name)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			beyond = append(beyond, name)
+		}
+	}
+	return beyond, nil
+}
+
+// GetPermissions godoc
+// @Summary Permission catalog (Admin only)
+// @Description List every permission that can be granted to a role
+// @Tags admin,roles
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Permissions"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/permissions [get]
+func GetPermissions(c *gin.Context) {
+	var permissions []models.Permission
+	if err := models.DB.Order("name asc").Find(&permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"permissions": permissions,
+	})
+}
+
+// GetRoles godoc
+// @Summary List roles (Admin only)
+// @Description List roles with their permissions and how many admins have each
+// @Tags admin,roles
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Roles"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles [get]
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := models.DB.Preload("Permissions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("permissions.name asc")
+	}).Order("id asc").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	var counts []struct {
+		Role  models.AdminRole
+		Count int64
+	}
+	models.DB.Model(&models.AdminUser{}).Select("role, COUNT(*) AS count").Group("role").Scan(&counts)
+	admins := make(map[models.AdminRole]int64, len(counts))
+	for _, row := range counts {
+		admins[row.Role] = row.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"roles":   roles,
+		"admins":  admins,
+	})
+}
+
+// CreateRole godoc
+// @Summary Create a role (Admin only)
+// @Description Create a custom role with a set of permissions from the catalog. Only permissions the caller's own role has can be granted
+// @Tags admin,roles
+// @Accept json
+// @Produce json
+// @Param role body CreateRoleRequest true "Role"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} map[string]interface{} "Invalid request or unknown permissions"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or permissions beyond your role"
+// @Failure 409 {object} map[string]interface{} "Role already exists"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles [post]
+func CreateRole(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid role",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if !roleNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role names may only contain lowercase letters, digits and underscores"})
+		return
+	}
+	if models.RoleExists(models.DB, models.AdminRole(name)) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	permissions, unknown, err := lookupPermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":               "Unknown permissions",
+			"unknown_permissions": unknown,
+		})
+		return
+	}
+
+	beyond, err := permissionsBeyondCaller(c, req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if len(beyond) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                   "You cannot grant permissions your own role does not have",
+			"permissions_not_allowed": beyond,
+		})
+		return
+	}
+
+	role := models.Role{
+		Name:             models.AdminRole(name),
+		Description:      req.Description,
+		RequireTwoFactor: req.RequireTwoFactor,
+		Permissions:      permissions,
+	}
+	if err := adminDB(c).Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	models.InvalidatePermissionCache()
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole godoc
+// @Summary Update a role (Admin only)
+// @Description Change a role's description, two-factor policy or permissions; fields left out are kept. Takes effect for admins with the role straight away. Only roles the caller's own role covers can be changed, and only permissions the caller's own role has can be granted. Roles with every permission only accept the description and two-factor policy, from callers with every permission
+// @Tags admin,roles
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Param role body UpdateRoleRequest true "Role"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} map[string]interface{} "Invalid request or unknown permissions"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions, or role or permissions beyond your own"
+// @Failure 404 {object} map[string]interface{} "Role not found"
+// @Failure 409 {object} map[string]interface{} "Role cannot be changed"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles/{id} [put]
+func UpdateRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid role",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var role models.Role
+	if err := models.DB.First(&role, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if !roleEditable(c, role) {
+		return
+	}
+	if role.AllAccess && len(req.Permissions) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This role has every permission and its permissions cannot be changed"})
+		return
+	}
+
+	permissions, unknown, err := lookupPermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":               "Unknown permissions",
+			"unknown_permissions": unknown,
+		})
+		return
+	}
+
+	beyond, err := permissionsBeyondCaller(c, req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if len(beyond) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                   "You cannot grant permissions your own role does not have",
+			"permissions_not_allowed": beyond,
+		})
+		return
+	}
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+		if req.RequireTwoFactor != nil {
+			updates["require_two_factor"] = *req.RequireTwoFactor
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&role).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if role.AllAccess || req.Permissions == nil {
+			return nil
+		}
+		return tx.Model(&role).Association("Permissions").Replace(permissions)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	models.InvalidatePermissionCache()
+
+	models.DB.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole godoc
+// @Summary Delete a role (Admin only)
+// @Description Delete a custom role that no admin has. Built-in roles and roles the caller's own role does not cover cannot be deleted
+// @Tags admin,roles
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid role ID"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Insufficient permissions or role beyond your own"
+// @Failure 404 {object} map[string]interface{} "Role not found"
+// @Failure 409 {object} map[string]interface{} "Role is built in or still assigned"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/roles/{id} [delete]
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var role models.Role
+	if err := models.DB.First(&role, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if !roleEditable(c, role) {
+		return
+	}
+	if role.IsSystem {
+		c.JSON(http.StatusConflict, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	var assigned int64
+	models.DB.Model(&models.AdminUser{}).Where("role = ?", role.Name).Count(&assigned)
+	if assigned > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Role is still assigned to admins",
+			"admins": assigned,
+		})
+		return
+	}
+
+	err = adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	models.InvalidatePermissionCache()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+type NotifyMeRequest struct {
+	Email string `json:"email" binding:"required,email" example:"customer@example.com"`
+	Size  string `json:"size" example:"A2"`
+}
+
+// SubscribeBackInStock godoc
+// @Summary Get notified when a product is back in stock
+// @Description Subscribe an email address (and optionally a size) to a one-time notification when an out-of-stock product is restocked
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param subscription body NotifyMeRequest true "Subscription"
+// @Success 201 {object} map[string]interface{} "Subscribed"
+// @Success 200 {object} map[string]interface{} "Already subscribed"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "Product not found"
+// @Failure 409 {object} map[string]interface{} "Product is in stock"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /products/{id}/notify-me [post]
+func SubscribeBackInStock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req NotifyMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid subscription",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var product models.Product
+	if err := models.DB.First(&product, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if product.IsAvailable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is in stock"})
+		return
+	}
+
+	size := strings.TrimSpace(req.Size)
+	if size != "" {
+		valid := false
+		for _, option := range product.GetSizeOptionsArray() {
+			if strings.EqualFold(option, size) {
+				size = option
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":       "Invalid size",
+				"valid_sizes": product.GetSizeOptionsArray(),
+			})
+			return
+		}
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	var existing models.StockSubscription
+	err = models.DB.Where("product_id = ? AND email = ? AND size = ? AND notified_at IS NULL", product.ID, email, size).
+		First(&existing).Error
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "You are already subscribed to this product",
+		})
+		return
+	}
+
+	sub := models.StockSubscription{
+		ProductID: product.ID,
+		Email:     email,
+		Size:      size,
+	}
+	if err := models.DB.Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "We'll email you when this product is back in stock",
+	})
+}
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	// A code from the authenticator app or an unused recovery code
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required" example:"123456"`
+}
+
+var (
+	errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	errLoginThrottled       = errors.New("login throttled")
+)
+
+// verifyTwoFactorCode accepts a current TOTP code for admin, or one of their
+// recovery codes if allowRecovery is set. A TOTP code is only accepted once.
+func verifyTwoFactorCode(tx *gorm.DB, admin *models.AdminUser, code string, allowRecovery bool) error {
+	if step, ok := services.ValidateTOTP(admin.TOTPSecret, code, time.Now()); ok {
+		result := tx.Model(&models.AdminUser{}).
+			Where("id = ? AND totp_last_step < ?", admin.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidTwoFactorCode
+		}
+		admin.TOTPLastStep = step
+		return nil
+	}
+
+	if !allowRecovery || !admin.TOTPEnabled {
+		return errInvalidTwoFactorCode
+	}
+	if err := models.UseRecoveryCode(tx, admin.ID, code); err != nil {
+		if errors.Is(err, models.ErrTokenInvalid) {
+			return errInvalidTwoFactorCode
+		}
+		return err
+	}
+	return nil
+}
+
+// loadCurrentAdmin loads the signed-in admin.
+func loadCurrentAdmin(c *gin.Context) (*models.AdminUser, bool) {
+	var admin models.AdminUser
+	if err := models.DB.First(&admin, c.GetUint("admin_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Admin not found",
+		})
+		return nil, false
+	}
+	return &admin, true
+}
+
+// VerifyAdminTwoFactor godoc
+// @Summary Finish a two-factor login
+// @Description Exchange the challenge token from the login step and a TOTP or recovery code for a session
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Invalid or expired challenge, or wrong code"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/auth/2fa [post]
+func VerifyAdminTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var admin models.AdminUser
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		challenge, err := models.ConsumeAdminToken(tx, req.ChallengeToken, models.TokenTwoFactor)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("is_active = ? AND totp_enabled = ?", true, true).First(&admin, challenge.AdminID).Error; err != nil {
+			return models.ErrTokenInvalid
+		}
+		if loginThrottled(c, admin.Email, &admin.ID) {
+			return errLoginThrottled
+		}
+		// A wrong code rolls back, so the challenge can be retried until it expires
+		return verifyTwoFactorCode(tx, &admin, req.Code, true)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTokenInvalid):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Login challenge is invalid or has expired, please sign in again",
+			})
+		case errors.Is(err, errLoginThrottled):
+			// Response already sent
+		case errors.Is(err, errInvalidTwoFactorCode):
+			recordFailedLogin(c, admin.Email, &admin.ID, models.LoginBadTwoFactor)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Invalid two-factor code",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to verify two-factor code",
+			})
+		}
+		return
+	}
+
+	recordSuccessfulLogin(admin.Email)
+	completeAdminLogin(c, &admin)
+}
+
+// SetupTwoFactor godoc
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret for the signed-in admin. Scan the otpauth URI with an authenticator app, then confirm with /admin/2fa/enable
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Secret and otpauth URI"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 409 {object} map[string]interface{} "Two-factor authentication already enabled"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/2fa/setup [post]
+func SetupTwoFactor(c *gin.Context) {
+	admin, ok := loadCurrentAdmin(c)
+	if !ok {
+		return
+	}
+	if admin.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := services.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to generate secret",
+		})
+		return
+	}
+	if err := adminDB(c).Model(admin).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to start enrollment",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"secret":      secret,
+		"otpauth_uri": services.TOTPURI(config.AppConfig.Site.Brand, admin.Email, secret),
+	})
+}
+
+// EnableTwoFactor godoc
+// @Summary Confirm two-factor enrollment
+// @Description Turn on two-factor authentication with a code from the authenticator app. Returns recovery codes, which are shown only once. Other sessions are signed out and a new token is returned
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} map[string]interface{} "Token and recovery codes"
+// @Failure 400 {object} map[string]interface{} "Invalid request or enrollment not started"
+// @Failure 401 {object} map[string]interface{} "Unauthorized or wrong code"
+// @Failure 409 {object} map[string]interface{} "Two-factor authentication already enabled"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/2fa/enable [post]
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	admin, ok := loadCurrentAdmin(c)
+	if !ok {
+		return
+	}
+	if admin.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Two-factor authentication is already enabled",
+		})
+		return
+	}
+	if admin.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Start enrollment with POST /api/admin/2fa/setup first",
+		})
+		return
+	}
+
+	var codes []string
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := verifyTwoFactorCode(tx, admin, req.Code, false); err != nil {
+			return err
+		}
+		if err := tx.Model(admin).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		if codes, err = models.ReplaceRecoveryCodes(tx, admin.ID); err != nil {
+			return err
+		}
+		return models.RevokeAdminSessions(tx, admin.ID)
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Invalid two-factor code",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to enable two-factor authentication",
+		})
+		return
+	}
+
+	// The current token may still be limited to enrollment, so replace it
+	pair, err := newAdminSession(c, admin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":        false,
+			"error":          "Two-factor authentication enabled but failed to create a new session, please sign in again",
+			"recovery_codes": codes,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"token":          pair.AccessToken,
+		"refresh_token":  pair.RefreshToken,
+		"recovery_codes": codes,
+		"message":        "Two-factor authentication enabled. Store the recovery codes somewhere safe, they will not be shown again",
+	})
+}
+
+// DisableTwoFactor godoc
+// @Summary Turn off two-factor authentication
+// @Description Turn off two-factor authentication for the signed-in admin. Not allowed when the admin's role requires it
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param request body DisableTwoFactorRequest true "Password and current code"
+// @Success 200 {object} map[string]interface{} "Success message"
+// @Failure 400 {object} map[string]interface{} "Invalid request or not enabled"
+// @Failure 401 {object} map[string]interface{} "Unauthorized, wrong password or wrong code"
+// @Failure 409 {object} map[string]interface{} "Required by role"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/2fa/disable [post]
+func DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	admin, ok := loadCurrentAdmin(c)
+	if !ok {
+		return
+	}
+	if !admin.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Two-factor authentication is not enabled",
+		})
+		return
+	}
+	if required, err := models.RoleRequiresTwoFactor(admin.Role); err != nil || required {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Your role requires two-factor authentication",
+		})
+		return
+	}
+	if !admin.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Password is incorrect",
+		})
+		return
+	}
+
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := verifyTwoFactorCode(tx, admin, req.Code, true); err != nil {
+			return err
+		}
+		return clearTwoFactor(tx, admin.ID)
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Invalid two-factor code",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Replace recovery codes
+// @Description Discard the signed-in admin's recovery codes and issue a new set, shown only once
+// @Tags admin,auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} map[string]interface{} "Recovery codes"
+// @Failure 400 {object} map[string]interface{} "Invalid request or not enabled"
+// @Failure 401 {object} map[string]interface{} "Unauthorized or wrong code"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Security BearerAuth
+// @Router /admin/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	admin, ok := loadCurrentAdmin(c)
+	if !ok {
+		return
+	}
+	if !admin.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Two-factor authentication is not enabled",
+		})
+		return
+	}
+
+	var codes []string
+	err := adminDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := verifyTwoFactorCode(tx, admin, req.Code, false); err != nil {
+			return err
+		}
+		var err error
+		codes, err = models.ReplaceRecoveryCodes(tx, admin.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Invalid two-factor code",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to replace recovery codes",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"recovery_codes": codes,
+	})
+}
+
+// clearTwoFactor removes an admin's TOTP secret and recovery codes.
+func clearTwoFactor(tx *gorm.DB, adminID uint) error {
+	if err := tx.Model(&models.AdminUser{}).Where("id = ?", adminID).Updates(map[string]interface{}{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Where("admin_id = ?", adminID).Delete(&models.AdminRecoveryCode{}).Error
+}
+
+// twoFactorStatus summarises an admin's two-factor setup for their profile.
+func twoFactorStatus(admin *models.AdminUser) gin.H {
+	required, _ := models.RoleRequiresTwoFactor(admin.Role)
+	status := gin.H{
+		"enabled":  admin.TOTPEnabled,
+		"required": required,
+	}
+	if admin.TOTPEnabled {
+		status["recovery_codes_remaining"] = models.RemainingRecoveryCodes(models.DB, admin.ID)
+	}
+	return status
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/calvinnle/bjj-store/backend/handlers"
 	"github.com/calvinnle/bjj-store/backend/middleware"
 	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/calvinnle/bjj-store/backend/services"
 )
 
 // @title BJJ Store API
@@ -29,19 +30,44 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
-// @description Type "Bearer" followed by a space and JWT token.
+// @description Type "Bearer" followed by a space and a JWT or API key.
 
 func main() {
 	// Load configuration with Viper
 	config.LoadConfig()
 
+	// Admin token signing keys
+	if err := services.LoadJWTKeys(services.KeySettings{
+		Algorithm:            config.AppConfig.JWT.Algorithm,
+		Secret:               config.AppConfig.JWT.Secret,
+		SigningKeyFile:       config.AppConfig.JWT.SigningKeyFile,
+		VerificationKeyFiles: config.AppConfig.JWT.VerificationKeyFiles,
+	}); err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
 	// Connect to database
 	models.ConnectDatabase()
 
 	// Auto migrate database
 	models.AutoMigrate()
 
-	// MinIO removed - using direct image URLs instead
+	// Background jobs
+	services.StartRecommendationJob(config.AppConfig.Jobs.RecommendationsInterval)
+	services.StartLowStockMonitor(services.NewLogNotifier(), config.AppConfig.Jobs.LowStockInterval)
+	services.StartSessionPurgeJob(config.AppConfig.Jobs.SessionPurgeInterval)
+	mailer := services.NewMailer(services.MailSettings{
+		Driver:   config.AppConfig.Mail.Driver,
+		From:     config.AppConfig.Mail.From,
+		Host:     config.AppConfig.Mail.SMTPHost,
+		Port:     config.AppConfig.Mail.SMTPPort,
+		Username: config.AppConfig.Mail.SMTPUsername,
+		Password: config.AppConfig.Mail.SMTPPassword,
+	})
+	services.StartBackInStockNotifier(mailer, services.FeedSettings{
+		BaseURL: config.AppConfig.Site.BaseURL,
+		Brand:   config.AppConfig.Site.Brand,
+	}, config.AppConfig.Jobs.BackInStockInterval)
 
 	// Setup Gin router
 	if config.AppConfig.Server.Environment == "production" {
@@ -53,6 +79,12 @@ func main() {
 	// Add CORS middleware
 	r.Use(middleware.CORSMiddleware())
 
+	// Uploaded product images are stored on local disk or in S3/MinIO
+	// depending on storage.driver; serve the locally stored ones
+	if config.AppConfig.Storage.Driver != "s3" {
+		r.Static("/uploads", config.AppConfig.Storage.LocalDir)
+	}
+
 	// API documentation endpoint (placeholder)
 	r.GET("/docs", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -61,6 +93,7 @@ func main() {
 			"endpoints": gin.H{
 				"health": "GET /api/health",
 				"products": "GET /api/products",
+				"product_by_slug": "GET /api/products/by-slug/:slug",
 				"orders": "POST /api/orders",
 				"admin": "POST /api/admin/auth/login",
 			},
@@ -76,47 +109,173 @@ func main() {
 		})
 	})
 
+	// Sitemap for search engines
+	r.GET("/sitemap.xml", handlers.GetSitemap)
+
+	// Public keys for verifying admin tokens
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// API routes
 	api := r.Group("/api")
 	{
 		// Public product routes (no authentication needed)
 		api.GET("/products", handlers.GetProducts)
 		api.GET("/products/:id", handlers.GetProduct)
+		api.GET("/products/by-slug/:slug", handlers.GetProductBySlug)
+		api.GET("/products/:id/reviews", handlers.GetProductReviews)
+		api.GET("/products/:id/related", handlers.GetRelatedProducts)
+		api.POST("/products/:id/reviews", handlers.CreateReview)
+		api.POST("/products/:id/notify-me", handlers.SubscribeBackInStock)
+
+		// Product feeds for shopping channels (public)
+		api.GET("/feeds/products.xml", handlers.GetProductFeedXML)
+		api.GET("/feeds/products.csv", handlers.GetProductFeedCSV)
 
 		// Public order routes (for customers)
 		api.POST("/orders", handlers.CreateOrder)
 		api.GET("/orders/track/:orderNumber", handlers.TrackOrder)
 		api.GET("/orders/email/:email", handlers.GetOrdersByEmail)
 
+		// Public return routes (for customers)
+		api.POST("/returns", handlers.CreateReturn)
+		api.GET("/returns/track/:rmaNumber", handlers.TrackReturn)
+
 		// Payment routes (public)
 		api.POST("/payment/process", handlers.ProcessPayment)
 
+		// Gift cards (public)
+		api.POST("/gift-cards", handlers.PurchaseGiftCard)
+		api.POST("/gift-cards/balance", handlers.CheckGiftCardBalance)
+
 		// Admin authentication routes (no auth required for login)
 		adminAuth := api.Group("/admin/auth")
 		{
 			adminAuth.POST("/login", handlers.AdminLogin)
+			adminAuth.POST("/accept-invite", handlers.AcceptAdminInvite)
+			adminAuth.POST("/forgot-password", handlers.ForgotAdminPassword)
+			adminAuth.POST("/reset-password", handlers.ResetAdminPassword)
+			adminAuth.POST("/2fa", handlers.VerifyAdminTwoFactor)
+			adminAuth.POST("/refresh", handlers.RefreshAdminToken)
 		}
 
 		// Protected admin routes (JWT required)
-		adminAPI := api.Group("/admin", middleware.JWTAuthMiddleware())
+		adminAPI := api.Group("/admin", middleware.JWTAuthMiddleware(), middleware.AuditTrail())
 		{
 			// Admin profile and session management
 			adminAPI.POST("/logout", handlers.AdminLogout)
 			adminAPI.GET("/profile", handlers.GetAdminProfile)
+			adminAPI.PUT("/password", handlers.ChangeAdminPassword)
+			adminAPI.GET("/sessions", handlers.GetAdminSessions)
+			adminAPI.DELETE("/sessions", handlers.RevokeOtherSessions)
+			adminAPI.DELETE("/sessions/:id", handlers.RevokeMySession)
+			adminAPI.POST("/2fa/setup", handlers.SetupTwoFactor)
+			adminAPI.POST("/2fa/enable", handlers.EnableTwoFactor)
+			adminAPI.POST("/2fa/disable", handlers.DisableTwoFactor)
+			adminAPI.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
 			adminAPI.GET("/stats", handlers.GetAdminStats)
 
 			// Product management (require product permissions)
 			adminAPI.POST("/products", middleware.RequirePermission("create_products"), handlers.CreateProduct)
 			adminAPI.PUT("/products/:id", middleware.RequirePermission("update_products"), handlers.UpdateProduct)
 			adminAPI.DELETE("/products/:id", middleware.RequirePermission("delete_products"), handlers.DeleteProduct)
+			adminAPI.POST("/products/:id/images", middleware.RequirePermission("update_products"), handlers.UploadProductImage)
+			adminAPI.PUT("/products/:id/images/:imageId", middleware.RequirePermission("update_products"), handlers.UpdateProductImage)
+			adminAPI.DELETE("/products/:id/images/:imageId", middleware.RequirePermission("update_products"), handlers.DeleteProductImage)
+			adminAPI.PUT("/products/:id/bundle-items", middleware.RequirePermission("update_products"), handlers.SetBundleItems)
+
+			// Review moderation
+			adminAPI.GET("/reviews", middleware.RequirePermission("moderate_reviews"), handlers.GetReviews)
+			adminAPI.PUT("/reviews/:id/approve", middleware.RequirePermission("moderate_reviews"), handlers.ApproveReview)
+			adminAPI.PUT("/reviews/:id/reject", middleware.RequirePermission("moderate_reviews"), handlers.RejectReview)
+
+			// Inventory ledger
+			adminAPI.GET("/inventory/movements", middleware.RequirePermission("view_inventory"), handlers.GetInventoryMovements)
+			adminAPI.POST("/inventory/adjustments", middleware.RequirePermission("manage_inventory"), handlers.CreateInventoryAdjustment)
+			adminAPI.GET("/inventory/reconciliation", middleware.RequirePermission("view_inventory"), handlers.GetInventoryReconciliation)
+			adminAPI.GET("/inventory/low-stock", middleware.RequirePermission("view_inventory"), handlers.GetLowStockReport)
+			adminAPI.GET("/inventory/backorders", middleware.RequirePermission("view_inventory"), handlers.GetBackorderReport)
+			adminAPI.POST("/inventory/transfers", middleware.RequirePermission("manage_inventory"), handlers.CreateStockTransfer)
+
+			// Stock locations
+			adminAPI.GET("/locations", middleware.RequirePermission("view_inventory"), handlers.GetLocations)
+			adminAPI.POST("/locations", middleware.RequirePermission("manage_inventory"), handlers.CreateLocation)
+			adminAPI.PUT("/locations/:id", middleware.RequirePermission("manage_inventory"), handlers.UpdateLocation)
+			adminAPI.DELETE("/locations/:id", middleware.RequirePermission("manage_inventory"), handlers.DeleteLocation)
+			adminAPI.GET("/locations/:id/stock", middleware.RequirePermission("view_inventory"), handlers.GetLocationStock)
+
+			// Suppliers and purchase orders
+			adminAPI.GET("/suppliers", middleware.RequirePermission("manage_purchasing"), handlers.GetSuppliers)
+			adminAPI.POST("/suppliers", middleware.RequirePermission("manage_purchasing"), handlers.CreateSupplier)
+			adminAPI.PUT("/suppliers/:id", middleware.RequirePermission("manage_purchasing"), handlers.UpdateSupplier)
+			adminAPI.GET("/purchase-orders", middleware.RequirePermission("manage_purchasing"), handlers.GetPurchaseOrders)
+			adminAPI.POST("/purchase-orders", middleware.RequirePermission("manage_purchasing"), handlers.CreatePurchaseOrder)
+			adminAPI.GET("/purchase-orders/:id", middleware.RequirePermission("manage_purchasing"), handlers.GetPurchaseOrder)
+			adminAPI.PUT("/purchase-orders/:id/status", middleware.RequirePermission("manage_purchasing"), handlers.UpdatePurchaseOrderStatus)
+			adminAPI.POST("/purchase-orders/:id/receive", middleware.RequirePermission("manage_purchasing"), handlers.ReceivePurchaseOrder)
+
+			// Reports
+			adminAPI.GET("/reports/margins", middleware.RequirePermission("view_reports"), handlers.GetMarginReport)
 
 			// Order management (require order permissions)
 			adminAPI.GET("/orders", middleware.RequirePermission("view_orders"), handlers.GetAllOrders)
 			adminAPI.PUT("/orders/:id/status", middleware.RequirePermission("update_orders"), handlers.UpdateOrderStatus)
+			adminAPI.PUT("/orders/:id", middleware.RequirePermission("update_orders"), handlers.EditOrder)
+			adminAPI.GET("/orders/:id/edits", middleware.RequirePermission("view_orders"), handlers.GetOrderEdits)
+
+			// Returns (RMA)
+			adminAPI.GET("/returns", middleware.RequirePermission("view_orders"), handlers.GetReturns)
+			adminAPI.GET("/returns/:id", middleware.RequirePermission("view_orders"), handlers.GetReturn)
+			adminAPI.PUT("/returns/:id/approve", middleware.RequirePermission("manage_returns"), handlers.ApproveReturn)
+			adminAPI.PUT("/returns/:id/reject", middleware.RequirePermission("manage_returns"), handlers.RejectReturn)
+			adminAPI.POST("/returns/:id/receive", middleware.RequirePermission("manage_returns"), handlers.ReceiveReturn)
+			adminAPI.POST("/returns/:id/resolve", middleware.RequirePermission("manage_returns"), handlers.ResolveReturn)
+
+			// Roles and permissions
+			adminAPI.GET("/permissions", middleware.RequirePermission("manage_roles"), handlers.GetPermissions)
+			adminAPI.GET("/roles", middleware.RequirePermission("manage_roles"), handlers.GetRoles)
+			adminAPI.POST("/roles", middleware.RequirePermission("manage_roles"), handlers.CreateRole)
+			adminAPI.PUT("/roles/:id", middleware.RequirePermission("manage_roles"), handlers.UpdateRole)
+			adminAPI.DELETE("/roles/:id", middleware.RequirePermission("manage_roles"), handlers.DeleteRole)
+
+			// Admin users
+			adminAPI.GET("/admins", middleware.RequirePermission("manage_admins"), handlers.GetAdminUsers)
+			adminAPI.POST("/admins", middleware.RequirePermission("manage_admins"), handlers.InviteAdminUser)
+			adminAPI.POST("/admins/:id/invite", middleware.RequirePermission("manage_admins"), handlers.ResendAdminInvite)
+			adminAPI.PUT("/admins/:id/role", middleware.RequirePermission("manage_admins"), handlers.UpdateAdminRole)
+			adminAPI.PUT("/admins/:id/deactivate", middleware.RequirePermission("manage_admins"), handlers.DeactivateAdminUser)
+			adminAPI.PUT("/admins/:id/activate", middleware.RequirePermission("manage_admins"), handlers.ActivateAdminUser)
+			adminAPI.DELETE("/admins/:id", middleware.RequirePermission("manage_admins"), handlers.DeleteAdminUser)
+			adminAPI.DELETE("/admins/:id/2fa", middleware.RequirePermission("manage_admins"), handlers.ResetAdminTwoFactor)
+			adminAPI.GET("/admins/:id/sessions", middleware.RequirePermission("manage_admins"), handlers.GetAdminUserSessions)
+			adminAPI.DELETE("/admins/:id/sessions", middleware.RequirePermission("manage_admins"), handlers.RevokeAdminUserSessions)
+			adminAPI.DELETE("/admins/:id/sessions/:sessionId", middleware.RequirePermission("manage_admins"), handlers.RevokeAdminUserSession)
+			adminAPI.GET("/admins/:id/lockout", middleware.RequirePermission("manage_admins"), handlers.GetAdminLockout)
+			adminAPI.POST("/admins/:id/unlock", middleware.RequirePermission("manage_admins"), handlers.UnlockAdminUser)
+			adminAPI.GET("/login-failures", middleware.RequirePermission("manage_admins"), handlers.GetLoginFailures)
+			adminAPI.POST("/login-failures/unlock-ip", middleware.RequirePermission("manage_admins"), handlers.UnlockLoginIP)
+
+			// Audit log
+			adminAPI.GET("/audit", middleware.RequirePermission("view_audit_log"), handlers.GetAuditLogs)
+
+			// API keys for scripts
+			adminAPI.GET("/api-keys", middleware.RequirePermission("manage_api_keys"), handlers.GetAPIKeys)
+			adminAPI.POST("/api-keys", middleware.RequirePermission("manage_api_keys"), handlers.CreateAPIKey)
+			adminAPI.DELETE("/api-keys/:id", middleware.RequirePermission("manage_api_keys"), handlers.RevokeAPIKey)
+
+			// Gift cards and store credit
+			adminAPI.GET("/gift-cards", middleware.RequirePermission("manage_gift_cards"), handlers.GetGiftCards)
+			adminAPI.POST("/gift-cards", middleware.RequirePermission("manage_gift_cards"), handlers.IssueGiftCard)
+			adminAPI.GET("/gift-cards/:id", middleware.RequirePermission("manage_gift_cards"), handlers.GetGiftCard)
+			adminAPI.PUT("/gift-cards/:id/disable", middleware.RequirePermission("manage_gift_cards"), handlers.DisableGiftCard)
 
 		}
 	}
 
+	// Every permission a route requires can be granted to roles
+	if err := models.SyncPermissions(middleware.Permissions()); err != nil {
+		log.Printf("Failed to sync permission catalog: %v", err)
+	}
+
 	log.Printf("Server starting on port %s", config.AppConfig.Server.Port)
 	log.Printf("Environment: %s", config.AppConfig.Server.Environment)
 	log.Printf("Default admin: %s", config.AppConfig.Admin.DefaultEmail)
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyRefusedRoutes act on the signed-in admin's own account, hand out
+// further keys, or require no permission a key could be scoped to, so they
+// need the admin in person.
+var apiKeyRefusedRoutes = map[string]bool{
+	"/api/admin/logout":             true,
+	"/api/admin/stats":              true,
+	"/api/admin/profile":            true,
+	"/api/admin/password":           true,
+	"/api/admin/sessions":           true,
+	"/api/admin/sessions/:id":       true,
+	"/api/admin/2fa/setup":          true,
+	"/api/admin/2fa/enable":         true,
+	"/api/admin/2fa/disable":        true,
+	"/api/admin/2fa/recovery-codes": true,
+	"/api/admin/api-keys":           true,
+	"/api/admin/api-keys/:id":       true,
+}
+
+// authenticateAPIKey signs the request in as the admin who owns key. The
+// admin's role still applies, and RequirePermission also checks the key's
+// scopes.
+func authenticateAPIKey(c *gin.Context, plain string) {
+	key, err := models.AuthenticateAPIKey(plain)
+	if err != nil {
+		if !errors.Is(err, models.ErrAPIKeyInvalid) {
+			log.Printf("Failed to check API key: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid, expired or revoked API key",
+		})
+		c.Abort()
+		return
+	}
+
+	// Keys stop working when their owner is deactivated or deleted
+	var admin models.AdminUser
+	if err := models.DB.First(&admin, key.AdminID).Error; err != nil || !admin.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "API key owner is no longer active",
+		})
+		c.Abort()
+		return
+	}
+
+	if apiKeyRefusedRoutes[c.FullPath()] {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "API keys cannot be used for this route",
+			"hint":  "Sign in with a password to manage your account and API keys",
+		})
+		c.Abort()
+		return
+	}
+
+	if err := models.TouchAPIKey(key, c.ClientIP()); err != nil {
+		log.Printf("Failed to record API key use: %v", err)
+	}
+
+	// Store admin info in context
+	c.Set("admin_id", admin.ID)
+	c.Set("admin_email", admin.Email)
+	c.Set("admin_role", admin.Role)
+	c.Set("api_key", key)
+	c.Set("api_key_id", key.ID)
+
+	c.Next()
+}
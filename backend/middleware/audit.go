@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditTrail records admin changes in the audit log. It must run after
+// JWTAuthMiddleware. Changes made through a database handle with the
+// request's context are recorded row by row with a diff; a successful
+// request that changed nothing the hooks could see, such as revoking a
+// session, is recorded on its own.
+func AuditTrail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := &models.AuditActor{
+			AdminID:   c.GetUint("admin_id"),
+			APIKeyID:  c.GetUint("api_key_id"),
+			Email:     c.GetString("admin_email"),
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Method:    c.Request.Method,
+			Path:      c.FullPath(),
+		}
+		c.Request = c.Request.WithContext(models.WithAuditActor(c.Request.Context(), actor))
+
+		c.Next()
+
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			return
+		}
+		if c.Writer.Status() >= http.StatusBadRequest || actor.Recorded() {
+			return
+		}
+		entry := models.AuditLog{
+			Action:     models.AuditRequest,
+			EntityType: routeEntity(c.FullPath()),
+			EntityID:   c.Param("id"),
+		}
+		if err := models.RecordAudit(c.Request.Context(), entry); err != nil {
+			log.Printf("Failed to write audit log for %s %s: %v", c.Request.Method, c.FullPath(), err)
+		}
+	}
+}
+
+// routeEntity names what an admin route acts on, from its first segment:
+// "/api/admin/products/:id/images" is about products.
+func routeEntity(path string) string {
+	path = strings.TrimPrefix(path, "/api/admin/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
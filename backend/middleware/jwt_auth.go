@@ -2,16 +2,42 @@ package middleware
 
 import (
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/calvinnle/bjj-store/backend/config"
 	"github.com/calvinnle/bjj-store/backend/models"
 	"github.com/calvinnle/bjj-store/backend/services"
 	"github.com/gin-gonic/gin"
 )
 
+// passwordChangeRoutes are the routes an admin can still use while their
+// password has to be changed.
+var passwordChangeRoutes = map[string]bool{
+	"/api/admin/password": true,
+	"/api/admin/profile":  true,
+	"/api/admin/logout":   true,
+}
+
+// twoFactorSetupRoutes are the routes an admin can still use while their
+// role requires two-factor authentication they have not set up.
+var twoFactorSetupRoutes = map[string]bool{
+	"/api/admin/2fa/setup":  true,
+	"/api/admin/2fa/enable": true,
+	"/api/admin/password":   true,
+	"/api/admin/profile":    true,
+	"/api/admin/logout":     true,
+}
+
+// JWTAuthMiddleware authenticates admin requests with a bearer JWT or an
+// API key, sent as "Authorization: Bearer <key>" or in X-API-Key.
 func JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, key)
+			return
+		}
+
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -34,8 +60,13 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if models.IsAPIKey(tokenString) {
+			authenticateAPIKey(c, tokenString)
+			return
+		}
+
 		// Create JWT service with config
-		jwtService := services.NewJWTService(config.AppConfig.JWT.Secret)
+		jwtService := services.NewJWTService(services.JWTKeys())
 
 		// Validate token
 		claims, err := jwtService.ValidateToken(tokenString)
@@ -49,7 +80,8 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Check if token is revoked
-		if jwtService.IsTokenRevoked(tokenString) {
+		session, err := jwtService.ActiveSession(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Token has been revoked",
 			})
@@ -57,16 +89,60 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Admins who must rotate their password can only do that
+		if claims.PasswordChangeRequired && !passwordChangeRoutes[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Password change required",
+				"hint":  "Change your password with PUT /api/admin/password",
+			})
+			c.Abort()
+			return
+		}
+		if claims.TwoFactorSetupRequired && !twoFactorSetupRoutes[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Two-factor authentication setup required",
+				"hint":  "Set it up with POST /api/admin/2fa/setup and POST /api/admin/2fa/enable",
+			})
+			c.Abort()
+			return
+		}
+
 		// Store admin info in context
 		c.Set("admin_id", claims.AdminID)
 		c.Set("admin_email", claims.Email)
 		c.Set("admin_role", claims.Role)
+		c.Set("session_family", session.FamilyID)
 
 		c.Next()
 	}
 }
 
+// permissionCatalog collects every permission a route requires as routes
+// are registered, so the catalog always matches the API.
+var permissionCatalog = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// Permissions returns the permissions required by the routes registered so
+// far, sorted by name.
+func Permissions() []string {
+	permissionCatalog.Lock()
+	defer permissionCatalog.Unlock()
+
+	names := make([]string, 0, len(permissionCatalog.names))
+	for name := range permissionCatalog.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func RequirePermission(permission string) gin.HandlerFunc {
+	permissionCatalog.Lock()
+	permissionCatalog.names[permission] = true
+	permissionCatalog.Unlock()
+
 	return func(c *gin.Context) {
 		adminRole, exists := c.Get("admin_role")
 		if !exists {
@@ -79,10 +155,17 @@ func RequirePermission(permission string) gin.HandlerFunc {
 
 		role := adminRole.(models.AdminRole)
 
-		// Create temporary admin user to check permissions
-		admin := models.AdminUser{Role: role}
+		// Role permissions are cached, so this rarely touches the database
+		allowed, err := models.RoleHasPermission(role, permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to check permissions",
+			})
+			c.Abort()
+			return
+		}
 
-		if !admin.HasPermission(permission) {
+		if !allowed {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error":               "Insufficient permissions",
 				"required_permission": permission,
@@ -92,6 +175,16 @@ func RequirePermission(permission string) gin.HandlerFunc {
 			return
 		}
 
+		// API keys are further limited to their scopes
+		if key, ok := c.Get("api_key"); ok && !key.(*models.APIKey).HasScope(permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":               "API key does not have the required scope",
+				"required_permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
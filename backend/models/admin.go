@@ -1,7 +1,14 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
+	"unicode"
+
+	"github.com/calvinnle/bjj-store/backend/config"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -17,24 +24,80 @@ const (
 )
 
 type AdminUser struct {
-	ID           uint           `json:"id" gorm:"primaryKey" example:"1"`
-	Email        string         `json:"email" gorm:"unique;not null" example:"admin@bjjstore.com"`
-	PasswordHash string         `json:"-" gorm:"not null"` // Don't include in JSON
-	Role         AdminRole      `json:"role" gorm:"default:viewer" example:"super_admin"`
-	IsActive     bool           `json:"is_active" gorm:"default:true" example:"true"`
-	LastLogin    *time.Time     `json:"last_login" example:"2025-07-26T15:20:41.306413+07:00"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                 uint           `json:"id" gorm:"primaryKey" example:"1"`
+	Email              string         `json:"email" gorm:"unique;not null" example:"admin@bjjstore.com"`
+	PasswordHash       string         `json:"-" gorm:"not null"` // Don't include in JSON
+	Role               AdminRole      `json:"role" gorm:"default:viewer" example:"super_admin"`
+	IsActive           bool           `json:"is_active" gorm:"default:true" example:"true"`
+	InvitePending      bool           `json:"invite_pending" gorm:"default:false" example:"false"` // invited but has not set a password yet
+	InvitedBy          *uint          `json:"invited_by,omitempty" example:"1"`
+	MustChangePassword bool           `json:"must_change_password" gorm:"default:false" example:"false"` // set for the default admin until its password is rotated
+	TOTPSecret         string         `json:"-"`                                                         // set during enrollment, before TOTPEnabled
+	TOTPEnabled        bool           `json:"totp_enabled" gorm:"default:false" example:"false"`
+	TOTPLastStep       int64          `json:"-"` // last accepted time step, so a code cannot be replayed
+	LastLogin          *time.Time     `json:"last_login" example:"2025-07-26T15:20:41.306413+07:00"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// AdminSession is one access/refresh token pair. Refreshing rotates the pair
+// into a new row of the same family; a family is one sign-in.
 type AdminSession struct {
-	ID        uint      `json:"id" gorm:"primaryKey" example:"1"`
-	AdminID   uint      `json:"admin_id" gorm:"not null" example:"1"`
-	TokenHash string    `json:"-" gorm:"not null"`
-	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
-	IsRevoked bool      `json:"is_revoked" gorm:"default:false" example:"false"`
-	CreatedAt time.Time `json:"created_at"`
+	ID               uint       `json:"id" gorm:"primaryKey" example:"1"`
+	AdminID          uint       `json:"admin_id" gorm:"not null" example:"1"`
+	FamilyID         string     `json:"family_id" gorm:"size:32;index" example:"9f86d081884c7d659a2feaa0c55ad015"`
+	TokenHash        string     `json:"-" gorm:"not null"`
+	ExpiresAt        time.Time  `json:"expires_at" gorm:"not null"`
+	RefreshTokenHash string     `json:"-" gorm:"size:64;index"`
+	RefreshExpiresAt time.Time  `json:"refresh_expires_at" gorm:"default:CURRENT_TIMESTAMP"`
+	AuthenticatedAt  time.Time  `json:"authenticated_at" gorm:"default:CURRENT_TIMESTAMP"` // when the admin signed in, carried across refreshes
+	RotatedAt        *time.Time `json:"rotated_at"`                                        // set once the refresh token has been exchanged
+	IPAddress        string     `json:"ip_address" gorm:"size:64" example:"203.0.113.7"`
+	UserAgent        string     `json:"user_agent" gorm:"size:512"`
+	LastSeenAt       *time.Time `json:"last_seen_at"`
+	IsRevoked        bool       `json:"is_revoked" gorm:"default:false" example:"false"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// RevokeSessionFamily revokes every session descended from the same sign-in.
+func RevokeSessionFamily(tx *gorm.DB, familyID string) error {
+	return tx.Model(&AdminSession{}).
+		Where("family_id = ? AND is_revoked = ?", familyID, false).
+		Update("is_revoked", true).Error
+}
+
+// ActiveAdminSessions lists an admin's signed-in sessions, one row per
+// family: the latest pair, which is the only one not revoked.
+func ActiveAdminSessions(tx *gorm.DB, adminID uint) ([]AdminSession, error) {
+	now := time.Now()
+	var sessions []AdminSession
+	err := tx.Where("admin_id = ? AND is_revoked = ? AND (refresh_expires_at > ? OR expires_at > ?)", adminID, false, now, now).
+		Order("COALESCE(last_seen_at, created_at) desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// PurgeExpiredSessions deletes sessions that can no longer be used. Rotated
+// pairs are kept while their family is alive so refresh token reuse is still
+// detected.
+func PurgeExpiredSessions(tx *gorm.DB) (int64, error) {
+	now := time.Now()
+	result := tx.Exec(`DELETE FROM admin_sessions s
+		WHERE s.expires_at < ? AND s.refresh_expires_at < ?
+		AND NOT EXISTS (
+			SELECT 1 FROM admin_sessions live
+			WHERE live.family_id = s.family_id AND live.is_revoked = false AND live.refresh_expires_at > ?
+		)`, now, now, now)
+	return result.RowsAffected, result.Error
+}
+
+// RevokeAdminSessions revokes every active session of an admin, signing
+// them out everywhere.
+func RevokeAdminSessions(tx *gorm.DB, adminID uint) error {
+	return tx.Model(&AdminSession{}).
+		Where("admin_id = ? AND is_revoked = ?", adminID, false).
+		Update("is_revoked", true).Error
 }
 
 // Hash password before saving
@@ -47,6 +110,38 @@ func (a *AdminUser) HashPassword(password string) error {
 	return nil
 }
 
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// ValidatePassword checks a new password for an admin against the password
+// policy: a minimum length, letters mixed with digits or symbols, and nothing
+// derived from the admin's email or the default password.
+func ValidatePassword(password, email string) error {
+	if minLength := config.AppConfig.Admin.PasswordMinLength; len([]rune(password)) < minLength {
+		return fmt.Errorf("%w: it must be at least %d characters long", ErrWeakPassword, minLength)
+	}
+
+	var letters, others bool
+	for _, r := range password {
+		if unicode.IsLetter(r) {
+			letters = true
+		} else if !unicode.IsSpace(r) {
+			others = true
+		}
+	}
+	if !letters || !others {
+		return fmt.Errorf("%w: it must mix letters with digits or symbols", ErrWeakPassword)
+	}
+
+	lower := strings.ToLower(password)
+	if local, _, _ := strings.Cut(strings.ToLower(email), "@"); local != "" && strings.Contains(lower, local) {
+		return fmt.Errorf("%w: it must not contain your email address", ErrWeakPassword)
+	}
+	if password == config.AppConfig.Admin.DefaultPassword {
+		return fmt.Errorf("%w: it must not be the default password", ErrWeakPassword)
+	}
+	return nil
+}
+
 // Check if password is correct
 func (a *AdminUser) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password))
@@ -55,17 +150,19 @@ func (a *AdminUser) CheckPassword(password string) bool {
 
 // Check if admin has permission
 func (a *AdminUser) HasPermission(permission string) bool {
-	switch a.Role {
-	case RoleSuperAdmin:
-		return true // Super admin has all permissions
-	case RoleInventory:
-		return permission == "view_products" || permission == "create_products" ||
-			permission == "update_products" || permission == "delete_products"
-	case RoleOrderManager:
-		return permission == "view_orders" || permission == "update_orders"
-	case RoleViewer:
-		return permission == "view_products" || permission == "view_orders"
-	default:
-		return false
+	ok, err := RoleHasPermission(a.Role, permission)
+	return err == nil && ok
+}
+
+// backfillSessionFamilies gives sessions created before session families a
+// family of their own, so they can be listed and revoked like the rest.
+func backfillSessionFamilies() {
+	result := DB.Exec("UPDATE admin_sessions SET family_id = 'legacy' || id WHERE family_id IS NULL OR family_id = ''")
+	if result.Error != nil {
+		log.Printf("Failed to backfill session families: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Backfilled session families for %d sessions", result.RowsAffected)
 	}
 }
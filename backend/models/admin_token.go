@@ -0,0 +1,89 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AdminTokenPurpose string
+
+const (
+	TokenInvite        AdminTokenPurpose = "invite"
+	TokenPasswordReset AdminTokenPurpose = "password_reset"
+)
+
+var ErrTokenInvalid = errors.New("token is invalid, expired or already used")
+
+// AdminToken is a single-use token emailed to an admin, e.g. to accept an
+// invite. Only a hash of the token is stored.
+type AdminToken struct {
+	ID        uint              `json:"id" gorm:"primaryKey"`
+	AdminID   uint              `json:"admin_id" gorm:"not null;index"`
+	Purpose   AdminTokenPurpose `json:"purpose" gorm:"size:32;not null"`
+	TokenHash string            `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time         `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time        `json:"used_at"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+func hashAdminToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueAdminToken creates a token for adminID that is valid for ttl, and
+// retires any earlier unused tokens for the same purpose. The plain token
+// is returned once and never stored.
+func IssueAdminToken(tx *gorm.DB, adminID uint, purpose AdminTokenPurpose, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	now := time.Now()
+	if err := tx.Model(&AdminToken{}).
+		Where("admin_id = ? AND purpose = ? AND used_at IS NULL", adminID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	record := AdminToken{
+		AdminID:   adminID,
+		Purpose:   purpose,
+		TokenHash: hashAdminToken(token),
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeAdminToken marks a token as used and returns it, or fails with
+// ErrTokenInvalid if it does not exist, has expired or was used already.
+func ConsumeAdminToken(tx *gorm.DB, token string, purpose AdminTokenPurpose) (*AdminToken, error) {
+	hash := hashAdminToken(token)
+	now := time.Now()
+
+	result := tx.Model(&AdminToken{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTokenInvalid
+	}
+
+	var record AdminToken
+	if err := tx.Where("token_hash = ?", hash).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix starts every API key, so keys are easy to recognise in
+// headers and to find if they leak.
+const apiKeyPrefix = "bjj_"
+
+var ErrAPIKeyInvalid = errors.New("API key is invalid, expired or revoked")
+
+// APIKeyScopes are the permissions an API key may use.
+type APIKeyScopes []string
+
+// APIKey lets a script call the admin API without signing in. A key acts
+// for the admin who created it, limited to its scopes and to what that
+// admin's role still allows. Only a hash of the key is stored; the prefix
+// identifies it in listings.
+type APIKey struct {
+	ID         uint         `json:"id" gorm:"primaryKey" example:"1"`
+	Name       string       `json:"name" gorm:"size:100;not null" example:"Inventory sync"`
+	Prefix     string       `json:"prefix" gorm:"size:16;not null;uniqueIndex" example:"bjj_3f9a1c2e"`
+	KeyHash    string       `json:"-" gorm:"size:64;not null"`
+	Scopes     APIKeyScopes `json:"scopes" gorm:"type:jsonb"`
+	AdminID    uint         `json:"admin_id" gorm:"not null;index" example:"1"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+	LastUsedIP string       `json:"last_used_ip" gorm:"size:64" example:"203.0.113.7"`
+	RevokedAt  *time.Time   `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// GORM JSON handling for APIKeyScopes
+func (s APIKeyScopes) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *APIKeyScopes) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+// HasScope reports whether the key may use permission.
+func (k *APIKey) HasScope(permission string) bool {
+	for _, scope := range k.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether token looks like an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// IssueAPIKey fills in key's prefix and hash and saves it. The plain key is
+// returned once and never stored.
+func IssueAPIKey(tx *gorm.DB, key *APIKey) (string, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	key.Prefix = apiKeyPrefix + hex.EncodeToString(id)
+	plain := key.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	key.KeyHash = hashAPIKey(plain)
+	if err := tx.Create(key).Error; err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// AuthenticateAPIKey returns the live key matching plain, or
+// ErrAPIKeyInvalid.
+func AuthenticateAPIKey(plain string) (*APIKey, error) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(plain, apiKeyPrefix), "_")
+	if !IsAPIKey(plain) || !ok {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	var keys []APIKey
+	if err := DB.Where("prefix = ? AND revoked_at IS NULL", apiKeyPrefix+prefix).Limit(1).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrAPIKeyInvalid
+	}
+	key := keys[0]
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashAPIKey(plain))) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+	if !key.ExpiresAt.After(time.Now()) {
+		return nil, ErrAPIKeyInvalid
+	}
+	return &key, nil
+}
+
+// RevokeAdminAPIKeys revokes every live API key owned by the admin.
+func RevokeAdminAPIKeys(tx *gorm.DB, adminID uint) error {
+	return tx.Model(&APIKey{}).
+		Where("admin_id = ? AND revoked_at IS NULL", adminID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TouchAPIKey records that key was used from ip. Like session activity, it
+// is written at most once a minute per key.
+func TouchAPIKey(key *APIKey, ip string) error {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < time.Minute && key.LastUsedIP == ip {
+		return nil
+	}
+	return DB.Model(&APIKey{}).Where("id = ?", key.ID).
+		Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error
+}
@@ -0,0 +1,509 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRequest AuditAction = "request" // an admin request that changed nothing the hooks could see
+)
+
+// AuditChange is the value of one column before and after a change.
+type AuditChange struct {
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// AuditChanges maps column names to what changed.
+type AuditChanges map[string]AuditChange
+
+// AuditLog records one change an admin made. The log is append-only.
+type AuditLog struct {
+	ID         uint         `json:"id" gorm:"primaryKey" example:"1"`
+	AdminID    *uint        `json:"admin_id,omitempty" gorm:"index" example:"1"`
+	APIKeyID   *uint        `json:"api_key_id,omitempty" gorm:"index" example:"3"` // set when the admin acted through an API key
+	Actor      string       `json:"actor" example:"admin@bjjstore.com"`
+	Action     AuditAction  `json:"action" gorm:"size:16;index" example:"update"`
+	EntityType string       `json:"entity_type" gorm:"size:64;index:idx_audit_entity" example:"products"`
+	EntityID   string       `json:"entity_id" gorm:"size:64;index:idx_audit_entity" example:"12"`
+	Changes    AuditChanges `json:"changes,omitempty" gorm:"type:jsonb"`
+	Method     string       `json:"method" gorm:"size:8" example:"PUT"`
+	Path       string       `json:"path" example:"/api/admin/products/:id"`
+	IPAddress  string       `json:"ip_address" gorm:"size:64" example:"203.0.113.7"`
+	UserAgent  string       `json:"user_agent"`
+	CreatedAt  time.Time    `json:"created_at" gorm:"index"`
+}
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return errors.New("audit log is append-only")
+}
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return errors.New("audit log is append-only")
+}
+
+// appendOnlyTables are history that must never be rewritten. The hooks
+// above only stop changes made through GORM models; triggers stop raw SQL
+// and sessions that skip hooks too.
+var appendOnlyTables = []string{"audit_logs", "order_edits"}
+
+// protectAppendOnlyTables installs triggers that refuse updates, deletes and
+// truncation of appendOnlyTables.
+func protectAppendOnlyTables() error {
+	err := DB.Exec(`CREATE OR REPLACE FUNCTION reject_append_only_change() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+		END;
+		$$ LANGUAGE plpgsql`).Error
+	if err != nil {
+		return err
+	}
+	for _, table := range appendOnlyTables {
+		statements := []string{
+			fmt.Sprintf("DROP TRIGGER IF EXISTS %[1]s_append_only ON %[1]s", table),
+			fmt.Sprintf("CREATE TRIGGER %[1]s_append_only BEFORE UPDATE OR DELETE ON %[1]s "+
+				"FOR EACH ROW EXECUTE FUNCTION reject_append_only_change()", table),
+			fmt.Sprintf("DROP TRIGGER IF EXISTS %[1]s_no_truncate ON %[1]s", table),
+			fmt.Sprintf("CREATE TRIGGER %[1]s_no_truncate BEFORE TRUNCATE ON %[1]s "+
+				"FOR EACH STATEMENT EXECUTE FUNCTION reject_append_only_change()", table),
+		}
+		for _, statement := range statements {
+			if err := DB.Exec(statement).Error; err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GORM JSON handling for AuditChanges
+func (c AuditChanges) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+func (c *AuditChanges) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, c)
+}
+
+// AuditActor is the admin behind a request. Changes made through a database
+// handle whose context carries an actor are written to the audit log.
+type AuditActor struct {
+	AdminID   uint
+	APIKeyID  uint
+	Email     string
+	IPAddress string
+	UserAgent string
+	Method    string
+	Path      string
+
+	recorded atomic.Int32
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor returns a context whose database changes are audited
+// against actor.
+func WithAuditActor(ctx context.Context, actor *AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// AuditActorFrom returns the actor in ctx, or nil.
+func AuditActorFrom(ctx context.Context) *AuditActor {
+	if ctx == nil {
+		return nil
+	}
+	actor, _ := ctx.Value(auditActorKey{}).(*AuditActor)
+	return actor
+}
+
+// Recorded reports whether any audit entries were written for the actor.
+func (a *AuditActor) Recorded() bool {
+	return a.recorded.Load() > 0
+}
+
+// RecordAudit writes entry with the actor from ctx.
+func RecordAudit(ctx context.Context, entry AuditLog) error {
+	actor := AuditActorFrom(ctx)
+	if actor == nil {
+		return errors.New("no audit actor in context")
+	}
+	return writeAudit(DB.WithContext(ctx), actor, []AuditLog{entry})
+}
+
+func writeAudit(tx *gorm.DB, actor *AuditActor, entries []AuditLog) error {
+	for i := range entries {
+		if actor.AdminID != 0 {
+			adminID := actor.AdminID
+			entries[i].AdminID = &adminID
+		}
+		if actor.APIKeyID != 0 {
+			apiKeyID := actor.APIKeyID
+			entries[i].APIKeyID = &apiKeyID
+		}
+		entries[i].Actor = actor.Email
+		entries[i].Method = actor.Method
+		entries[i].Path = actor.Path
+		entries[i].IPAddress = actor.IPAddress
+		entries[i].UserAgent = truncateString(actor.UserAgent, 255)
+	}
+	if err := tx.Create(&entries).Error; err != nil {
+		return err
+	}
+	actor.recorded.Add(int32(len(entries)))
+	return nil
+}
+
+func truncateString(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// unauditedTables change on their own as admins use the site, or are
+// audited elsewhere.
+var unauditedTables = map[string]bool{
+	"audit_logs":      true,
+	"admin_sessions":  true,
+	"login_throttles": true,
+	"login_failures":  true,
+}
+
+// redactedColumns are recorded as changed without their values.
+var redactedColumns = map[string]bool{
+	"password_hash":      true,
+	"totp_secret":        true,
+	"token_hash":         true,
+	"refresh_token_hash": true,
+	"code_hash":          true,
+	"key_hash":           true,
+}
+
+const redacted = "[redacted]"
+
+// ignoredColumns change with every update and would only add noise.
+var ignoredColumns = map[string]bool{
+	"updated_at": true,
+}
+
+const auditBeforeKey = "audit:before"
+
+// registerAuditCallbacks hooks the audit log into every create, update and
+// delete made with an actor in the statement's context.
+func registerAuditCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:create").Register("audit:create", auditCreate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("audit:before_update", auditSnapshot); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("audit:update", auditUpdate); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("audit:before_delete", auditSnapshot); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("audit:delete", auditDelete)
+}
+
+// auditedStatement returns the actor if tx's statement should be audited.
+func auditedStatement(tx *gorm.DB) *AuditActor {
+	if tx.Statement.Schema == nil || unauditedTables[tx.Statement.Schema.Table] {
+		return nil
+	}
+	return AuditActorFrom(tx.Statement.Context)
+}
+
+// auditSession is a fresh handle on tx's connection, so audit reads and
+// writes join its transaction.
+func auditSession(tx *gorm.DB) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+}
+
+func auditCreate(tx *gorm.DB) {
+	actor := auditedStatement(tx)
+	if actor == nil || tx.Error != nil {
+		return
+	}
+
+	var entries []AuditLog
+	eachRow(tx.Statement.ReflectValue, func(row reflect.Value) {
+		changes := AuditChanges{}
+		for _, field := range tx.Statement.Schema.Fields {
+			if field.DBName == "" || ignoredColumns[field.DBName] {
+				continue
+			}
+			value, zero := field.ValueOf(tx.Statement.Context, row)
+			if zero {
+				continue
+			}
+			changes[field.DBName] = AuditChange{To: auditValue(field.DBName, value)}
+		}
+		entries = append(entries, AuditLog{
+			Action:     AuditCreate,
+			EntityType: tx.Statement.Schema.Table,
+			EntityID:   structKey(tx, row),
+			Changes:    changes,
+		})
+	})
+	if len(entries) == 0 {
+		return
+	}
+	if err := writeAudit(auditSession(tx), actor, entries); err != nil {
+		log.Printf("Failed to write audit log for %s: %v", tx.Statement.Schema.Table, err)
+	}
+}
+
+// auditSnapshot loads the rows an update or delete is about to change.
+func auditSnapshot(tx *gorm.DB) {
+	if auditedStatement(tx) == nil || tx.Error != nil {
+		return
+	}
+	stmt := tx.Statement
+
+	query := auditSession(tx).Model(reflect.New(stmt.Schema.ModelType).Interface())
+	if stmt.Unscoped {
+		query = query.Unscoped()
+	}
+	conditions := false
+	if where, ok := stmt.Clauses["WHERE"]; ok {
+		if expr, ok := where.Expression.(clause.Where); ok && len(expr.Exprs) > 0 {
+			query = query.Clauses(expr)
+			conditions = true
+		}
+	}
+	// GORM adds the model's primary key to the conditions itself, after
+	// this callback runs
+	if keys := primaryKeyValues(tx); len(keys) > 0 && len(stmt.Schema.PrimaryFields) == 1 {
+		column := clause.Column{Table: clause.CurrentTable, Name: stmt.Schema.PrimaryFields[0].DBName}
+		query = query.Where(clause.IN{Column: column, Values: keys})
+		conditions = true
+	}
+	if !conditions {
+		// GORM refuses updates and deletes without conditions anyway
+		return
+	}
+
+	var rows []map[string]interface{}
+	if err := query.Find(&rows).Error; err != nil {
+		log.Printf("Failed to read %s for audit log: %v", stmt.Schema.Table, err)
+		return
+	}
+	tx.InstanceSet(auditBeforeKey, rows)
+}
+
+func auditUpdate(tx *gorm.DB) {
+	actor := auditedStatement(tx)
+	before := snapshotRows(tx)
+	if actor == nil || tx.Error != nil || tx.RowsAffected == 0 || len(before) == 0 {
+		return
+	}
+	stmt := tx.Statement
+
+	keys := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		keys = append(keys, rowKeyValue(stmt.Schema, row))
+	}
+	var after []map[string]interface{}
+	if len(stmt.Schema.PrimaryFields) == 1 {
+		column := clause.Column{Table: clause.CurrentTable, Name: stmt.Schema.PrimaryFields[0].DBName}
+		err := auditSession(tx).Model(reflect.New(stmt.Schema.ModelType).Interface()).Unscoped().
+			Where(clause.IN{Column: column, Values: keys}).Find(&after).Error
+		if err != nil {
+			log.Printf("Failed to read %s for audit log: %v", stmt.Schema.Table, err)
+			return
+		}
+	}
+	afterByKey := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByKey[rowKey(stmt.Schema, row)] = row
+	}
+
+	var entries []AuditLog
+	for _, old := range before {
+		key := rowKey(stmt.Schema, old)
+		updated, ok := afterByKey[key]
+		if !ok {
+			continue
+		}
+		changes := AuditChanges{}
+		for column := range old {
+			if ignoredColumns[column] {
+				continue
+			}
+			from, to := plainValue(old[column]), plainValue(updated[column])
+			if reflect.DeepEqual(from, to) {
+				continue
+			}
+			if redactedColumns[column] {
+				from, to = redacted, redacted
+			}
+			changes[column] = AuditChange{From: from, To: to}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		entries = append(entries, AuditLog{
+			Action:     AuditUpdate,
+			EntityType: stmt.Schema.Table,
+			EntityID:   key,
+			Changes:    changes,
+		})
+	}
+	if len(entries) == 0 {
+		return
+	}
+	if err := writeAudit(auditSession(tx), actor, entries); err != nil {
+		log.Printf("Failed to write audit log for %s: %v", stmt.Schema.Table, err)
+	}
+}
+
+func auditDelete(tx *gorm.DB) {
+	actor := auditedStatement(tx)
+	before := snapshotRows(tx)
+	if actor == nil || tx.Error != nil || tx.RowsAffected == 0 || len(before) == 0 {
+		return
+	}
+
+	entries := make([]AuditLog, 0, len(before))
+	for _, row := range before {
+		changes := AuditChanges{}
+		for column, value := range row {
+			if value == nil || ignoredColumns[column] {
+				continue
+			}
+			changes[column] = AuditChange{From: auditValue(column, value)}
+		}
+		entries = append(entries, AuditLog{
+			Action:     AuditDelete,
+			EntityType: tx.Statement.Schema.Table,
+			EntityID:   rowKey(tx.Statement.Schema, row),
+			Changes:    changes,
+		})
+	}
+	if err := writeAudit(auditSession(tx), actor, entries); err != nil {
+		log.Printf("Failed to write audit log for %s: %v", tx.Statement.Schema.Table, err)
+	}
+}
+
+func snapshotRows(tx *gorm.DB) []map[string]interface{} {
+	value, ok := tx.InstanceGet(auditBeforeKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := value.([]map[string]interface{})
+	return rows
+}
+
+// eachRow calls fn for the struct, or each struct in the slice, in value.
+func eachRow(value reflect.Value, fn func(row reflect.Value)) {
+	switch value.Kind() {
+	case reflect.Struct:
+		fn(value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			row := reflect.Indirect(value.Index(i))
+			if row.Kind() == reflect.Struct {
+				fn(row)
+			}
+		}
+	}
+}
+
+// primaryKeyValues returns the non-zero primary keys of the models a
+// statement was given.
+func primaryKeyValues(tx *gorm.DB) []interface{} {
+	stmt := tx.Statement
+	if len(stmt.Schema.PrimaryFields) != 1 || !stmt.ReflectValue.IsValid() {
+		return nil
+	}
+	field := stmt.Schema.PrimaryFields[0]
+	var keys []interface{}
+	eachRow(stmt.ReflectValue, func(row reflect.Value) {
+		if row.Type() != stmt.Schema.ModelType {
+			return
+		}
+		if value, zero := field.ValueOf(stmt.Context, row); !zero {
+			keys = append(keys, value)
+		}
+	})
+	return keys
+}
+
+func structKey(tx *gorm.DB, row reflect.Value) string {
+	values := make([]string, 0, len(tx.Statement.Schema.PrimaryFields))
+	for _, field := range tx.Statement.Schema.PrimaryFields {
+		value, _ := field.ValueOf(tx.Statement.Context, row)
+		values = append(values, fmt.Sprint(value))
+	}
+	return strings.Join(values, ",")
+}
+
+func rowKeyValue(s *schema.Schema, row map[string]interface{}) interface{} {
+	if len(s.PrimaryFields) == 0 {
+		return nil
+	}
+	return row[s.PrimaryFields[0].DBName]
+}
+
+func rowKey(s *schema.Schema, row map[string]interface{}) string {
+	values := make([]string, 0, len(s.PrimaryFields))
+	for _, field := range s.PrimaryFields {
+		values = append(values, fmt.Sprint(row[field.DBName]))
+	}
+	return strings.Join(values, ",")
+}
+
+// auditValue prepares a column value for the audit record.
+func auditValue(column string, value interface{}) interface{} {
+	if redactedColumns[column] {
+		return redacted
+	}
+	return plainValue(value)
+}
+
+// plainValue turns raw driver values into ones that compare and encode
+// sensibly: JSON columns stay JSON and other bytes become text.
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		if json.Valid(v) {
+			return json.RawMessage(v)
+		}
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return fmt.Sprintf("%x", v)
+	case time.Time:
+		return v.UTC()
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.UTC()
+	}
+	return value
+}
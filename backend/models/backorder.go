@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrBackorderLimitReached = errors.New("backorder limit reached")
+
+// PlanFulfillment splits quantity into the units that can ship from stock now
+// and the units that would be backordered or pre-ordered. ok is false when
+// stock is short and the product cannot be sold beyond it.
+func (p *Product) PlanFulfillment(quantity int) (fromStock, backordered int, fulfillment ItemFulfillment, ok bool) {
+	fromStock = min(quantity, max(p.Stock, 0))
+	backordered = quantity - fromStock
+
+	switch {
+	case backordered == 0:
+		return fromStock, 0, FulfillFromStock, true
+	case p.IsBundle:
+		// Bundles ship from component stock and cannot be sold ahead of it
+		return fromStock, backordered, FulfillFromStock, false
+	case p.IsPreorder:
+		return fromStock, backordered, FulfillPreorder, true
+	case p.AllowBackorder:
+		return fromStock, backordered, FulfillBackorder, true
+	default:
+		return fromStock, backordered, FulfillFromStock, false
+	}
+}
+
+// OutstandingBackorders returns how many units of a product have been paid
+// for but are still waiting on stock.
+func OutstandingBackorders(db *gorm.DB, productID uint) (int, error) {
+	var total int
+	err := db.Model(&OrderItem{}).
+		Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+		Where("order_items.product_id = ? AND orders.status = ?", productID, OrderStatusPaid).
+		Select("COALESCE(SUM(order_items.backordered_quantity), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// CheckBackorderLimit returns ErrBackorderLimitReached if backordering
+// another quantity units would exceed the product's cap.
+func CheckBackorderLimit(db *gorm.DB, product *Product, quantity int) error {
+	if product.BackorderLimit == nil || quantity <= 0 {
+		return nil
+	}
+
+	outstanding, err := OutstandingBackorders(db, product.ID)
+	if err != nil {
+		return err
+	}
+	if outstanding+quantity > *product.BackorderLimit {
+		return fmt.Errorf("%w for %s: %d of %d already sold in advance",
+			ErrBackorderLimitReached, product.Name, outstanding, *product.BackorderLimit)
+	}
+	return nil
+}
+
+// BackorderSummary is the outstanding advance-sold quantity for one product.
+type BackorderSummary struct {
+	ProductID        uint       `json:"product_id"`
+	ProductName      string     `json:"product_name"`
+	IsPreorder       bool       `json:"is_preorder"`
+	Stock            int        `json:"stock"`
+	Outstanding      int        `json:"outstanding"`
+	Orders           int        `json:"orders"`
+	BackorderLimit   *int       `json:"backorder_limit"`
+	ExpectedShipDate *time.Time `json:"expected_ship_date"`
+}
+
+// BackorderSummaries lists products with paid orders waiting on stock.
+func BackorderSummaries() ([]BackorderSummary, error) {
+	var rows []BackorderSummary
+	err := DB.Table("order_items").
+		Select("products.id AS product_id, products.name AS product_name, products.is_preorder, "+
+			"products.stock, products.backorder_limit, products.expected_ship_date, "+
+			"SUM(order_items.backordered_quantity) AS outstanding, "+
+			"COUNT(DISTINCT order_items.order_id) AS orders").
+		Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+		Joins("JOIN products ON products.id = order_items.product_id").
+		Where("orders.status = ? AND order_items.backordered_quantity > 0", OrderStatusPaid).
+		Group("products.id, products.name, products.is_preorder, products.stock, products.backorder_limit, products.expected_ship_date").
+		Order("products.expected_ship_date ASC NULLS LAST, products.id").
+		Scan(&rows).Error
+	return rows, err
+}
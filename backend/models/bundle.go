@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BundleItem is one component of a bundle product, such as the belt in a
+// "gi + belt + rash guard" starter kit.
+type BundleItem struct {
+	ID          uint      `json:"id" gorm:"primaryKey" example:"1"`
+	BundleID    uint      `json:"bundle_id" gorm:"not null;index" example:"10"`
+	ComponentID uint      `json:"component_id" gorm:"not null;index" example:"3"`
+	Component   *Product  `json:"component,omitempty" gorm:"foreignKey:ComponentID"`
+	Quantity    int       `json:"quantity" gorm:"not null;default:1" example:"1"`
+	Size        string    `json:"size" example:"A2"` // fixed component size, empty if the component has none
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// bundleStockExpr is the number of complete bundles the components in stock
+// can make up. Deleted components make the bundle unavailable.
+const bundleStockExpr = `COALESCE((SELECT MIN(CASE WHEN c.deleted_at IS NULL THEN c.stock / bi.quantity ELSE 0 END)
+	FROM bundle_items bi JOIN products c ON c.id = bi.component_id
+	WHERE bi.bundle_id = products.id), 0)`
+
+// AfterFind works out what a bundle's components would cost separately when
+// they have been preloaded.
+func (p *Product) AfterFind(tx *gorm.DB) error {
+	if !p.IsBundle || len(p.BundleItems) == 0 {
+		return nil
+	}
+
+	var total float64
+	for _, item := range p.BundleItems {
+		if item.Component == nil {
+			return nil
+		}
+		total += item.Component.Price * float64(item.Quantity)
+	}
+	p.ComponentsPrice = total
+	p.BundleSavings = total - p.Price
+	return nil
+}
+
+// BundleCost is the cost price of one bundle from its preloaded components.
+func (p *Product) BundleCost() float64 {
+	var cost float64
+	for _, item := range p.BundleItems {
+		if item.Component != nil {
+			cost += item.Component.CostPrice * float64(item.Quantity)
+		}
+	}
+	return cost
+}
+
+// ComponentQuantities returns how many units of each component quantity
+// bundles take, keyed by product ID.
+func (p *Product) ComponentQuantities(quantity int) map[uint]int {
+	quantities := make(map[uint]int, len(p.BundleItems))
+	for _, item := range p.BundleItems {
+		quantities[item.ComponentID] += item.Quantity * quantity
+	}
+	return quantities
+}
+
+// RefreshBundleStock recomputes the stock of the given bundles from their
+// components.
+func RefreshBundleStock(tx *gorm.DB, bundleIDs ...uint) error {
+	if len(bundleIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&Product{}).
+		Where("id IN ? AND is_bundle = ? AND stock <> "+bundleStockExpr, bundleIDs, true).
+		UpdateColumns(map[string]interface{}{
+			"stock":      gorm.Expr(bundleStockExpr),
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// RefreshBundlesContaining recomputes the stock of every bundle that
+// includes componentID.
+func RefreshBundlesContaining(tx *gorm.DB, componentID uint) error {
+	return tx.Model(&Product{}).
+		Where("is_bundle = ? AND id IN (SELECT bundle_id FROM bundle_items WHERE component_id = ?) AND stock <> "+bundleStockExpr,
+			true, componentID).
+		UpdateColumns(map[string]interface{}{
+			"stock":      gorm.Expr(bundleStockExpr),
+			"updated_at": time.Now(),
+		}).Error
+}
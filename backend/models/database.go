@@ -33,19 +33,42 @@ func ConnectDatabase() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// Record admin changes in the audit log
+	if err := registerAuditCallbacks(database); err != nil {
+		log.Fatal("Failed to register audit log callbacks:", err)
+	}
+
 	DB = database
 	log.Println("Database connected successfully!")
 }
 
 func AutoMigrate() {
-	err := DB.AutoMigrate(&Product{}, &Order{}, &OrderItem{}, &AdminUser{}, &AdminSession{})
+	err := DB.AutoMigrate(&Product{}, &Order{}, &OrderItem{}, &AdminUser{}, &AdminSession{}, &ProductImage{}, &ProductSlugRedirect{}, &Review{}, &ProductRecommendation{}, &InventoryMovement{}, &Supplier{}, &PurchaseOrder{}, &PurchaseOrderLine{}, &StockSubscription{}, &Location{}, &LocationStock{}, &BundleItem{}, &GiftCard{}, &GiftCardTransaction{}, &ReturnRequest{}, &ReturnItem{}, &OrderEdit{}, &Permission{}, &Role{}, &AdminToken{}, &AdminRecoveryCode{}, &LoginThrottle{}, &LoginFailure{}, &AuditLog{}, &APIKey{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 	log.Println("Database migration completed!")
 
-	// Create default admin user if none exists
+	// Refuse changes to history tables in the database itself
+	if err := protectAppendOnlyTables(); err != nil {
+		log.Fatal("Failed to protect append-only tables:", err)
+	}
+
+	// Create the built-in roles and default admin user if none exists
+	seedRoles()
 	createDefaultAdmin()
+
+	// Give existing products a slug
+	backfillProductSlugs()
+
+	// Start the stock ledger from current stock levels
+	openInventoryLedger()
+
+	// Place existing stock at the default location
+	openDefaultLocation()
+
+	// Sessions from before refresh tokens each become their own family
+	backfillSessionFamilies()
 }
 
 func createDefaultAdmin() {
@@ -54,9 +77,10 @@ func createDefaultAdmin() {
 
 	if count == 0 {
 		admin := AdminUser{
-			Email:    config.AppConfig.Admin.DefaultEmail,
-			Role:     RoleSuperAdmin,
-			IsActive: true,
+			Email:              config.AppConfig.Admin.DefaultEmail,
+			Role:               RoleSuperAdmin,
+			IsActive:           true,
+			MustChangePassword: true,
 		}
 
 		if err := admin.HashPassword(config.AppConfig.Admin.DefaultPassword); err != nil {
@@ -70,5 +94,17 @@ func createDefaultAdmin() {
 		}
 
 		log.Printf("Default admin created: %s", admin.Email)
+		return
+	}
+
+	// Existing installs still signing in with the default password have to
+	// change it too
+	var admin AdminUser
+	if err := DB.Where("email = ? AND must_change_password = ?", config.AppConfig.Admin.DefaultEmail, false).First(&admin).Error; err != nil {
+		return
+	}
+	if admin.CheckPassword(config.AppConfig.Admin.DefaultPassword) {
+		DB.Model(&admin).Update("must_change_password", true)
+		log.Printf("Default admin %s must change the default password", admin.Email)
 	}
 }
@@ -0,0 +1,273 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GiftCardKind string
+
+const (
+	GiftCardPurchased   GiftCardKind = "gift_card"
+	GiftCardStoreCredit GiftCardKind = "store_credit"
+)
+
+type GiftCardTransactionType string
+
+const (
+	GiftCardIssued   GiftCardTransactionType = "issue"
+	GiftCardRedeemed GiftCardTransactionType = "redeem"
+	GiftCardRefunded GiftCardTransactionType = "refund" // redeemed amount returned, e.g. on cancellation
+	GiftCardVoided   GiftCardTransactionType = "void"
+)
+
+var (
+	ErrGiftCardNotFound     = errors.New("gift card not found")
+	ErrGiftCardExpired      = errors.New("gift card has expired")
+	ErrGiftCardDisabled     = errors.New("gift card has been disabled")
+	ErrGiftCardInsufficient = errors.New("insufficient gift card balance")
+)
+
+// giftCardAlphabet leaves out characters that are easily confused (0/O, 1/I/L).
+const giftCardAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// GiftCard is a prepaid balance redeemable at checkout, either bought as a
+// gift or issued as store credit. Only a hash of the code is stored.
+type GiftCard struct {
+	ID             uint         `json:"id" gorm:"primaryKey" example:"1"`
+	CodeHash       string       `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Last4          string       `json:"last4" gorm:"size:4" example:"7KQ2"`
+	Kind           GiftCardKind `json:"kind" gorm:"size:32;not null;index" example:"gift_card"`
+	InitialBalance float64      `json:"initial_balance" gorm:"not null" example:"100.00"`
+	Balance        float64      `json:"balance" gorm:"not null" example:"42.50"`
+	ExpiresAt      *time.Time   `json:"expires_at"`
+	RecipientEmail string       `json:"recipient_email" gorm:"index" example:"friend@example.com"`
+	PurchaserEmail string       `json:"purchaser_email,omitempty" example:"customer@example.com"`
+	Message        string       `json:"message,omitempty" gorm:"type:text" example:"Happy birthday, see you on the mats!"`
+	OrderID        *uint        `json:"order_id,omitempty" gorm:"index" example:"42"` // order the credit was issued against
+	IssuedBy       *uint        `json:"issued_by,omitempty" example:"1"`
+	DisabledAt     *time.Time   `json:"disabled_at,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// GiftCardTransaction is one entry in a gift card's append-only ledger. The
+// sum of a card's amounts always equals its balance.
+type GiftCardTransaction struct {
+	ID           uint                    `json:"id" gorm:"primaryKey" example:"1"`
+	GiftCardID   uint                    `json:"gift_card_id" gorm:"not null;index" example:"1"`
+	Type         GiftCardTransactionType `json:"type" gorm:"size:32;not null;index" example:"redeem"`
+	Amount       float64                 `json:"amount" gorm:"not null" example:"-57.50"`
+	BalanceAfter float64                 `json:"balance_after" gorm:"not null" example:"42.50"`
+	OrderID      *uint                   `json:"order_id,omitempty" gorm:"index" example:"42"`
+	Actor        string                  `json:"actor" example:"customer@example.com"`
+	AdminID      *uint                   `json:"admin_id,omitempty" example:"1"`
+	Note         string                  `json:"note" example:"Store credit for return RMA-1001"`
+	CreatedAt    time.Time               `json:"created_at" gorm:"index"`
+}
+
+// GiftCardChange describes why and by whom a card's balance is changing.
+type GiftCardChange struct {
+	Type    GiftCardTransactionType
+	OrderID *uint
+	Actor   string
+	AdminID *uint
+	Note    string
+}
+
+// GiftCardIssue describes a new gift card or store credit.
+type GiftCardIssue struct {
+	Kind           GiftCardKind
+	Amount         float64
+	ExpiresAt      *time.Time
+	RecipientEmail string
+	PurchaserEmail string
+	Message        string
+	OrderID        *uint
+	Actor          string
+	AdminID        *uint
+	Note           string
+}
+
+func (t *GiftCardTransaction) BeforeUpdate(tx *gorm.DB) error {
+	return errors.New("gift card transactions are append-only")
+}
+
+func (t *GiftCardTransaction) BeforeDelete(tx *gorm.DB) error {
+	return errors.New("gift card transactions are append-only")
+}
+
+// IsExpired reports whether the card can no longer be used.
+func (g *GiftCard) IsExpired() bool {
+	return g.ExpiresAt != nil && time.Now().After(*g.ExpiresAt)
+}
+
+// Usable returns why the card cannot be redeemed, or nil if it can.
+func (g *GiftCard) Usable() error {
+	switch {
+	case g.DisabledAt != nil:
+		return ErrGiftCardDisabled
+	case g.IsExpired():
+		return ErrGiftCardExpired
+	}
+	return nil
+}
+
+// RoundMoney rounds an amount to whole cents.
+func RoundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// NormalizeGiftCardCode strips separators and case so codes can be typed
+// however the customer likes.
+func NormalizeGiftCardCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// HashGiftCardCode returns the lookup hash stored for a code.
+func HashGiftCardCode(code string) string {
+	sum := sha256.Sum256([]byte(NormalizeGiftCardCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateGiftCardCode returns a random 16 character code formatted as
+// XXXX-XXXX-XXXX-XXXX (about 79 bits of entropy).
+func GenerateGiftCardCode() (string, error) {
+	size := big.NewInt(int64(len(giftCardAlphabet)))
+	var b strings.Builder
+	for i := 0; i < 16; i++ {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(giftCardAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// FindGiftCard looks a card up by its code.
+func FindGiftCard(tx *gorm.DB, code string) (*GiftCard, error) {
+	var card GiftCard
+	err := tx.Where("code_hash = ?", HashGiftCardCode(code)).First(&card).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// IssueGiftCard creates a card with the given balance and records the
+// issuance. The plain code is returned once and never stored.
+func IssueGiftCard(tx *gorm.DB, issue GiftCardIssue) (*GiftCard, string, error) {
+	amount := RoundMoney(issue.Amount)
+	if amount <= 0 {
+		return nil, "", fmt.Errorf("gift card amount must be positive")
+	}
+
+	code, err := GenerateGiftCardCode()
+	if err != nil {
+		return nil, "", err
+	}
+	normalized := NormalizeGiftCardCode(code)
+
+	card := GiftCard{
+		CodeHash:       HashGiftCardCode(code),
+		Last4:          normalized[len(normalized)-4:],
+		Kind:           issue.Kind,
+		InitialBalance: amount,
+		Balance:        amount,
+		ExpiresAt:      issue.ExpiresAt,
+		RecipientEmail: strings.ToLower(strings.TrimSpace(issue.RecipientEmail)),
+		PurchaserEmail: strings.ToLower(strings.TrimSpace(issue.PurchaserEmail)),
+		Message:        issue.Message,
+		OrderID:        issue.OrderID,
+		IssuedBy:       issue.AdminID,
+	}
+	if err := tx.Create(&card).Error; err != nil {
+		return nil, "", err
+	}
+
+	entry := GiftCardTransaction{
+		GiftCardID:   card.ID,
+		Type:         GiftCardIssued,
+		Amount:       amount,
+		BalanceAfter: amount,
+		OrderID:      issue.OrderID,
+		Actor:        issue.Actor,
+		AdminID:      issue.AdminID,
+		Note:         issue.Note,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, "", err
+	}
+	return &card, code, nil
+}
+
+// ApplyGiftCardChange atomically adds amount to a card's balance and appends
+// a ledger entry. Redemptions (negative amounts) fail with
+// ErrGiftCardInsufficient rather than overdraw the card, and with
+// ErrGiftCardExpired or ErrGiftCardDisabled if the card cannot be used.
+func ApplyGiftCardChange(tx *gorm.DB, cardID uint, amount float64, change GiftCardChange) (*GiftCardTransaction, error) {
+	amount = RoundMoney(amount)
+	if amount == 0 {
+		return nil, nil
+	}
+
+	query := tx.Model(&GiftCard{}).Where("id = ?", cardID)
+	if amount < 0 {
+		query = query.Where("balance + ? >= 0 AND disabled_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", amount, time.Now())
+	}
+	result := query.UpdateColumns(map[string]interface{}{
+		"balance":    gorm.Expr("ROUND((balance + ?)::numeric, 2)", amount),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var card GiftCard
+	if err := tx.First(&card, cardID).Error; err != nil {
+		return nil, ErrGiftCardNotFound
+	}
+	if result.RowsAffected == 0 {
+		if err := card.Usable(); err != nil {
+			return nil, err
+		}
+		return nil, ErrGiftCardInsufficient
+	}
+
+	entry := GiftCardTransaction{
+		GiftCardID:   card.ID,
+		Type:         change.Type,
+		Amount:       amount,
+		BalanceAfter: card.Balance,
+		OrderID:      change.OrderID,
+		Actor:        change.Actor,
+		AdminID:      change.AdminID,
+		Note:         change.Note,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
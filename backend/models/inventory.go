@@ -0,0 +1,238 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type MovementReason string
+
+const (
+	MovementSale         MovementReason = "sale"
+	MovementRestock      MovementReason = "restock"
+	MovementAdjustment   MovementReason = "adjustment"
+	MovementReturn       MovementReason = "return"
+	MovementCancellation MovementReason = "cancellation"
+	MovementTransfer     MovementReason = "transfer"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrBundleStock       = errors.New("bundle stock follows its components and cannot be changed directly")
+	ErrAppendOnly        = errors.New("inventory movements are append-only")
+)
+
+// InventoryMovement is one entry in the append-only stock ledger. The sum of
+// a product's deltas always equals its current Stock.
+type InventoryMovement struct {
+	ID              uint           `json:"id" gorm:"primaryKey" example:"1"`
+	ProductID       uint           `json:"product_id" gorm:"not null;index" example:"1"`
+	Delta           int            `json:"delta" gorm:"not null" example:"-2"`
+	StockAfter      int            `json:"stock_after" gorm:"not null" example:"13"`
+	Reason          MovementReason `json:"reason" gorm:"size:32;not null;index" example:"sale"`
+	Actor           string         `json:"actor" example:"admin@bjjstore.com"`
+	AdminID         *uint          `json:"admin_id,omitempty" example:"1"`
+	OrderID         *uint          `json:"order_id,omitempty" gorm:"index" example:"42"`
+	PurchaseOrderID *uint          `json:"purchase_order_id,omitempty" gorm:"index" example:"3"`
+	ReturnRequestID *uint          `json:"return_request_id,omitempty" gorm:"index" example:"7"`
+	LocationID      *uint          `json:"location_id,omitempty" gorm:"index" example:"1"`
+	Note            string         `json:"note" example:"Damaged in storage"`
+	CreatedAt       time.Time      `json:"created_at" gorm:"index"`
+}
+
+// StockChange describes why and by whom a product's stock is being changed.
+type StockChange struct {
+	Reason  MovementReason
+	Actor   string
+	AdminID *uint
+	OrderID *uint
+	Note    string
+
+	PurchaseOrderID *uint
+	ReturnRequestID *uint
+	LocationID      *uint // nil lets ApplyStockChange choose the location
+}
+
+func (m *InventoryMovement) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAppendOnly
+}
+
+func (m *InventoryMovement) BeforeDelete(tx *gorm.DB) error {
+	return ErrAppendOnly
+}
+
+// ApplyStockChange atomically adds delta to the product's stock, and to its
+// quantity at change.LocationID, and appends a ledger entry in the same
+// transaction. Without a location, additions go to the default location and
+// removals are taken the way orders are: from the highest priority location
+// holding enough, or split across locations with one movement each, the
+// last of which is returned. Stock never goes below zero; a decrement that
+// would do so fails with ErrInsufficientStock. Bundles fail with
+// ErrBundleStock.
+func ApplyStockChange(tx *gorm.DB, productID uint, delta int, change StockChange) (*InventoryMovement, error) {
+	if delta == 0 {
+		return nil, nil
+	}
+	if err := ensureNotBundle(tx, productID); err != nil {
+		return nil, err
+	}
+
+	if change.LocationID == nil && delta < 0 {
+		allocations, err := AllocateOrderStock(tx, map[uint]int{productID: -delta})
+		if err != nil {
+			return nil, err
+		}
+		var movement *InventoryMovement
+		for _, allocation := range allocations {
+			change.LocationID = allocation.LocationID
+			if movement, err = ApplyStockChange(tx, productID, -allocation.Quantity, change); err != nil {
+				return nil, err
+			}
+		}
+		return movement, nil
+	}
+
+	var locationID uint
+	if change.LocationID != nil {
+		locationID = *change.LocationID
+		if err := tx.First(&Location{}, locationID).Error; err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrLocationNotFound, locationID)
+		}
+	} else {
+		id, err := DefaultLocationID(tx)
+		if err != nil {
+			return nil, err
+		}
+		locationID = id
+	}
+
+	result := tx.Model(&Product{}).
+		Where("id = ? AND stock + ? >= 0", productID, delta).
+		UpdateColumns(map[string]interface{}{
+			"stock":      gorm.Expr("stock + ?", delta),
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w for product %d", ErrInsufficientStock, productID)
+	}
+	if err := adjustLocationStock(tx, locationID, productID, delta); err != nil {
+		return nil, err
+	}
+	if err := RefreshBundlesContaining(tx, productID); err != nil {
+		return nil, err
+	}
+
+	var stock int
+	if err := tx.Model(&Product{}).Where("id = ?", productID).Pluck("stock", &stock).Error; err != nil {
+		return nil, err
+	}
+
+	movement := newMovement(productID, delta, stock, locationID, change)
+	if err := tx.Create(&movement).Error; err != nil {
+		return nil, err
+	}
+	return &movement, nil
+}
+
+// ensureNotBundle fails with ErrBundleStock if the product is a bundle,
+// whose stock is derived from its components.
+func ensureNotBundle(tx *gorm.DB, productID uint) error {
+	var bundles int64
+	if err := tx.Model(&Product{}).Where("id = ? AND is_bundle = ?", productID, true).Count(&bundles).Error; err != nil {
+		return err
+	}
+	if bundles > 0 {
+		return fmt.Errorf("%w: product %d", ErrBundleStock, productID)
+	}
+	return nil
+}
+
+func newMovement(productID uint, delta, stockAfter int, locationID uint, change StockChange) InventoryMovement {
+	return InventoryMovement{
+		ProductID:       productID,
+		Delta:           delta,
+		StockAfter:      stockAfter,
+		Reason:          change.Reason,
+		Actor:           change.Actor,
+		AdminID:         change.AdminID,
+		OrderID:         change.OrderID,
+		PurchaseOrderID: change.PurchaseOrderID,
+		ReturnRequestID: change.ReturnRequestID,
+		LocationID:      &locationID,
+		Note:            change.Note,
+	}
+}
+
+// StockDiscrepancy is a product whose ledger total or location quantities do
+// not match its stock.
+type StockDiscrepancy struct {
+	ProductID     uint   `json:"product_id"`
+	ProductName   string `json:"product_name"`
+	Stock         int    `json:"stock"`
+	LedgerTotal   int    `json:"ledger_total"`
+	Difference    int    `json:"difference"`
+	LocationTotal int    `json:"location_total"`
+}
+
+// ReconcileInventory compares each product's stock with the sum of its
+// ledger entries and of its per-location quantities, and returns the
+// products that disagree. Bundles hold no stock of their own and are skipped.
+func ReconcileInventory() ([]StockDiscrepancy, error) {
+	const ledgerTotal = "COALESCE((SELECT SUM(m.delta) FROM inventory_movements m WHERE m.product_id = products.id), 0)"
+	const locationTotal = "COALESCE((SELECT SUM(ls.quantity) FROM location_stocks ls WHERE ls.product_id = products.id), 0)"
+
+	var rows []StockDiscrepancy
+	err := DB.Model(&Product{}).
+		Select("products.id AS product_id, products.name AS product_name, products.stock, "+
+			ledgerTotal+" AS ledger_total, "+locationTotal+" AS location_total").
+		Where("products.is_bundle = ?", false).
+		Where("products.stock <> " + ledgerTotal + " OR products.stock <> " + locationTotal).
+		Order("products.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rows {
+		rows[i].Difference = rows[i].Stock - rows[i].LedgerTotal
+	}
+	return rows, nil
+}
+
+// openInventoryLedger records the stock products had before the ledger
+// existed, so that reconciliation starts out balanced.
+func openInventoryLedger() {
+	var products []Product
+	// Bundle stock follows its components and has no ledger of its own
+	err := DB.Where("stock <> 0 AND is_bundle = ?", false).
+		Where("NOT EXISTS (SELECT 1 FROM inventory_movements m WHERE m.product_id = products.id)").
+		Find(&products).Error
+	if err != nil {
+		log.Printf("Failed to load products for inventory ledger: %v", err)
+		return
+	}
+
+	for _, p := range products {
+		movement := InventoryMovement{
+			ProductID:  p.ID,
+			Delta:      p.Stock,
+			StockAfter: p.Stock,
+			Reason:     MovementAdjustment,
+			Actor:      "system",
+			Note:       "Opening balance",
+		}
+		if err := DB.Create(&movement).Error; err != nil {
+			log.Printf("Failed to record opening stock for product %d: %v", p.ID, err)
+		}
+	}
+	if len(products) > 0 {
+		log.Printf("Recorded opening inventory balance for %d products", len(products))
+	}
+}
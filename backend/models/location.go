@@ -0,0 +1,374 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrLocationNotFound = errors.New("location not found")
+
+// Location is a place stock is held, such as the warehouse or the academy
+// shop. Lower Priority locations are preferred when allocating orders.
+type Location struct {
+	ID        uint           `json:"id" gorm:"primaryKey" example:"1"`
+	Name      string         `json:"name" gorm:"not null" example:"Main warehouse"`
+	Code      string         `json:"code" gorm:"size:32;not null;uniqueIndex" example:"main"`
+	Address   string         `json:"address" example:"12 Industrial Way, San Diego, CA"`
+	Priority  int            `json:"priority" gorm:"default:0" example:"0"`
+	IsDefault bool           `json:"is_default" gorm:"default:false" example:"true"` // receives stock added without a location
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// LocationStock is the quantity of a product held at a location. A product's
+// location quantities always add up to its Stock.
+type LocationStock struct {
+	ID         uint      `json:"id" gorm:"primaryKey" example:"1"`
+	LocationID uint      `json:"location_id" gorm:"not null;uniqueIndex:idx_location_stocks_location_product" example:"1"`
+	Location   Location  `json:"location,omitempty" gorm:"foreignKey:LocationID"`
+	ProductID  uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_location_stocks_location_product;index" example:"1"`
+	Product    *Product  `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Quantity   int       `json:"quantity" gorm:"not null;default:0" example:"8"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// StockAllocation is a quantity of a product taken from one location.
+type StockAllocation struct {
+	ProductID  uint  `json:"product_id"`
+	LocationID *uint `json:"location_id"`
+	Quantity   int   `json:"quantity"`
+}
+
+// LocationAvailability is a product's stock at one location, as shown in the
+// public catalog.
+type LocationAvailability struct {
+	LocationID uint   `json:"location_id" example:"1"`
+	Name       string `json:"name" example:"Main warehouse"`
+	Quantity   int    `json:"quantity" example:"8"`
+}
+
+// DefaultLocationID returns the location that receives stock added without
+// an explicit location.
+func DefaultLocationID(tx *gorm.DB) (uint, error) {
+	var location Location
+	err := tx.Where("is_default = ?", true).Order("priority, id").First(&location).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = tx.Order("priority, id").First(&location).Error
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: no default location", ErrLocationNotFound)
+	}
+	return location.ID, nil
+}
+
+// adjustLocationStock adds delta to a product's quantity at a location,
+// failing with ErrInsufficientStock if it would go below zero.
+func adjustLocationStock(tx *gorm.DB, locationID, productID uint, delta int) error {
+	if delta > 0 {
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "location_id"}, {Name: "product_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"quantity":   gorm.Expr("location_stocks.quantity + ?", delta),
+				"updated_at": time.Now(),
+			}),
+		}).Create(&LocationStock{
+			LocationID: locationID,
+			ProductID:  productID,
+			Quantity:   delta,
+		}).Error
+	}
+
+	result := tx.Model(&LocationStock{}).
+		Where("location_id = ? AND product_id = ? AND quantity + ? >= 0", locationID, productID, delta).
+		UpdateColumns(map[string]interface{}{
+			"quantity":   gorm.Expr("quantity + ?", delta),
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w for product %d at location %d", ErrInsufficientStock, productID, locationID)
+	}
+	return nil
+}
+
+// AllocateOrderStock decides which locations ship the given quantities,
+// keyed by product ID. A single location that can ship everything is
+// preferred so the order goes out in one parcel; otherwise each product is
+// taken from the highest priority location that holds enough, splitting
+// across locations only when no single one does.
+func AllocateOrderStock(tx *gorm.DB, quantities map[uint]int) ([]StockAllocation, error) {
+	productIDs := make([]uint, 0, len(quantities))
+	for id, qty := range quantities {
+		if qty > 0 {
+			productIDs = append(productIDs, id)
+		}
+	}
+	if len(productIDs) == 0 {
+		return nil, nil
+	}
+	sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
+
+	var levels []LocationStock
+	err := tx.Joins("JOIN locations ON locations.id = location_stocks.location_id AND locations.deleted_at IS NULL").
+		Where("location_stocks.product_id IN ? AND location_stocks.quantity > 0", productIDs).
+		Order("locations.priority, locations.id").
+		Find(&levels).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Quantities per location in priority order
+	var locationOrder []uint
+	held := make(map[uint]map[uint]int)
+	for _, level := range levels {
+		if held[level.LocationID] == nil {
+			held[level.LocationID] = make(map[uint]int)
+			locationOrder = append(locationOrder, level.LocationID)
+		}
+		held[level.LocationID][level.ProductID] = level.Quantity
+	}
+
+	for _, locationID := range locationOrder {
+		complete := true
+		for _, productID := range productIDs {
+			if held[locationID][productID] < quantities[productID] {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			allocations := make([]StockAllocation, 0, len(productIDs))
+			for _, productID := range productIDs {
+				id := locationID
+				allocations = append(allocations, StockAllocation{
+					ProductID:  productID,
+					LocationID: &id,
+					Quantity:   quantities[productID],
+				})
+			}
+			return allocations, nil
+		}
+	}
+
+	var allocations []StockAllocation
+	for _, productID := range productIDs {
+		needed := quantities[productID]
+
+		single := false
+		for _, locationID := range locationOrder {
+			if held[locationID][productID] >= needed {
+				id := locationID
+				allocations = append(allocations, StockAllocation{ProductID: productID, LocationID: &id, Quantity: needed})
+				single = true
+				break
+			}
+		}
+		if single {
+			continue
+		}
+
+		for _, locationID := range locationOrder {
+			take := min(needed, held[locationID][productID])
+			if take <= 0 {
+				continue
+			}
+			id := locationID
+			allocations = append(allocations, StockAllocation{ProductID: productID, LocationID: &id, Quantity: take})
+			needed -= take
+			if needed == 0 {
+				break
+			}
+		}
+		if needed > 0 {
+			return nil, fmt.Errorf("%w for product %d", ErrInsufficientStock, productID)
+		}
+	}
+	return allocations, nil
+}
+
+// SingleLocation returns the location all allocations come from, or nil if
+// they span several.
+func SingleLocation(allocations []StockAllocation) *uint {
+	var location *uint
+	for _, a := range allocations {
+		if a.LocationID == nil || (location != nil && *location != *a.LocationID) {
+			return nil
+		}
+		location = a.LocationID
+	}
+	return location
+}
+
+// OrderStockAllocations returns the stock an order currently holds, per
+// product and location, according to the inventory ledger.
+func OrderStockAllocations(tx *gorm.DB, orderID uint) ([]StockAllocation, error) {
+	var rows []StockAllocation
+	err := tx.Model(&InventoryMovement{}).
+		Select("product_id, location_id, -SUM(delta) AS quantity").
+		Where("order_id = ? AND reason IN ?", orderID, []MovementReason{MovementSale, MovementCancellation}).
+		Group("product_id, location_id").
+		Having("SUM(delta) < 0").
+		Order("product_id, location_id").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// TransferStock moves quantity units of a product between two locations,
+// recording a pair of transfer movements. The product's total stock is
+// unchanged.
+func TransferStock(tx *gorm.DB, productID, fromID, toID uint, quantity int, change StockChange) ([]InventoryMovement, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("transfer quantity must be positive")
+	}
+	if fromID == toID {
+		return nil, fmt.Errorf("cannot transfer to the same location")
+	}
+	if err := ensureNotBundle(tx, productID); err != nil {
+		return nil, err
+	}
+	for _, id := range []uint{fromID, toID} {
+		if err := tx.First(&Location{}, id).Error; err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrLocationNotFound, id)
+		}
+	}
+
+	if err := adjustLocationStock(tx, fromID, productID, -quantity); err != nil {
+		return nil, err
+	}
+	if err := adjustLocationStock(tx, toID, productID, quantity); err != nil {
+		return nil, err
+	}
+
+	var stock int
+	if err := tx.Model(&Product{}).Where("id = ?", productID).Pluck("stock", &stock).Error; err != nil {
+		return nil, err
+	}
+
+	change.Reason = MovementTransfer
+	movements := []InventoryMovement{
+		newMovement(productID, -quantity, stock, fromID, change),
+		newMovement(productID, quantity, stock, toID, change),
+	}
+	if err := tx.Create(&movements).Error; err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+// LocationAvailabilities returns per-location stock for products, keyed by
+// product ID.
+func LocationAvailabilities(productIDs []uint) (map[uint][]LocationAvailability, error) {
+	availability := make(map[uint][]LocationAvailability, len(productIDs))
+	if len(productIDs) == 0 {
+		return availability, nil
+	}
+
+	var rows []struct {
+		ProductID  uint
+		LocationID uint
+		Name       string
+		Quantity   int
+	}
+	err := DB.Model(&LocationStock{}).
+		Select("location_stocks.product_id, locations.id AS location_id, locations.name, location_stocks.quantity").
+		Joins("JOIN locations ON locations.id = location_stocks.location_id AND locations.deleted_at IS NULL").
+		Where("location_stocks.product_id IN ? AND location_stocks.quantity > 0", productIDs).
+		Order("locations.priority, locations.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		availability[row.ProductID] = append(availability[row.ProductID], LocationAvailability{
+			LocationID: row.LocationID,
+			Name:       row.Name,
+			Quantity:   row.Quantity,
+		})
+	}
+	return availability, nil
+}
+
+// AttachAvailabilities fills in Availability on products.
+func AttachAvailabilities(products []Product) error {
+	ids := make([]uint, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+
+	availability, err := LocationAvailabilities(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		products[i].Availability = availability[products[i].ID]
+	}
+	return nil
+}
+
+// AttachAvailability fills in Availability on p.
+func (p *Product) AttachAvailability() error {
+	availability, err := LocationAvailabilities([]uint{p.ID})
+	if err != nil {
+		return err
+	}
+	p.Availability = availability[p.ID]
+	return nil
+}
+
+// openDefaultLocation creates the default location on first run and assigns
+// it the stock of products that predate locations.
+func openDefaultLocation() {
+	var count int64
+	DB.Model(&Location{}).Count(&count)
+	if count == 0 {
+		location := Location{Name: "Main warehouse", Code: "main", IsDefault: true}
+		if err := DB.Create(&location).Error; err != nil {
+			log.Printf("Failed to create default location: %v", err)
+			return
+		}
+		log.Printf("Default stock location created: %s", location.Name)
+	}
+
+	locationID, err := DefaultLocationID(DB)
+	if err != nil {
+		log.Printf("Failed to load default location: %v", err)
+		return
+	}
+
+	// Bundle stock follows its components and is not held at a location;
+	// drop rows earlier versions created for bundles
+	if err := DB.Where("product_id IN (SELECT id FROM products WHERE is_bundle = ?)", true).
+		Delete(&LocationStock{}).Error; err != nil {
+		log.Printf("Failed to remove location stock for bundles: %v", err)
+	}
+
+	var products []Product
+	err = DB.Where("stock > 0 AND is_bundle = ?", false).
+		Where("NOT EXISTS (SELECT 1 FROM location_stocks ls WHERE ls.product_id = products.id)").
+		Find(&products).Error
+	if err != nil {
+		log.Printf("Failed to load products for location stock: %v", err)
+		return
+	}
+
+	for _, p := range products {
+		level := LocationStock{LocationID: locationID, ProductID: p.ID, Quantity: p.Stock}
+		if err := DB.Create(&level).Error; err != nil {
+			log.Printf("Failed to assign stock for product %d to default location: %v", p.ID, err)
+		}
+	}
+	if len(products) > 0 {
+		log.Printf("Assigned stock for %d products to the default location", len(products))
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"log"
+	"time"
+)
+
+// LoginThrottle counts recent failed logins for one account or IP address.
+// Keys look like "account:admin@bjjstore.com" or "ip:203.0.113.7".
+type LoginThrottle struct {
+	ThrottleKey   string     `json:"key" gorm:"primaryKey;size:191"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type LoginFailureReason string
+
+const (
+	LoginUnknownAccount LoginFailureReason = "unknown_account"
+	LoginBadPassword    LoginFailureReason = "bad_password"
+	LoginBadTwoFactor   LoginFailureReason = "bad_two_factor"
+	LoginThrottled      LoginFailureReason = "throttled" // refused without checking the password
+)
+
+// LoginFailure is an audit record of a failed admin login. Rows are only
+// ever inserted.
+type LoginFailure struct {
+	ID        uint               `json:"id" gorm:"primaryKey"`
+	Email     string             `json:"email" gorm:"size:255;index" example:"admin@bjjstore.com"`
+	AdminID   *uint              `json:"admin_id,omitempty" gorm:"index" example:"1"`
+	IPAddress string             `json:"ip_address" gorm:"size:64;index" example:"203.0.113.7"`
+	UserAgent string             `json:"user_agent" gorm:"size:512"`
+	Reason    LoginFailureReason `json:"reason" gorm:"size:32;not null" example:"bad_password"`
+	Locked    bool               `json:"locked" gorm:"default:false"` // this failure locked the account or IP
+	CreatedAt time.Time          `json:"created_at" gorm:"index"`
+}
+
+// RecordLoginFailure stores an audit record of a failed login. Failing to
+// write it must not change the outcome of the login, so errors are logged.
+func RecordLoginFailure(failure LoginFailure) {
+	if len(failure.UserAgent) > 512 {
+		failure.UserAgent = failure.UserAgent[:512]
+	}
+	if err := DB.Create(&failure).Error; err != nil {
+		log.Printf("Failed to record login failure for %s: %v", failure.Email, err)
+	}
+}
@@ -19,29 +19,56 @@ const (
 	OrderStatusCancelled OrderStatus = "cancelled"
 )
 
+type PaymentCapture string
+
+const (
+	PaymentAuthorized PaymentCapture = "authorized"
+	PaymentCaptured   PaymentCapture = "captured"
+)
+
+type ItemFulfillment string
+
+const (
+	FulfillFromStock ItemFulfillment = "stock"
+	FulfillBackorder ItemFulfillment = "backorder"
+	FulfillPreorder  ItemFulfillment = "preorder"
+)
+
 type Order struct {
-	ID              uint           `json:"id" gorm:"primaryKey" example:"1"`
-	OrderNumber     string         `json:"order_number" gorm:"unique;not null" example:"BJJ-1753519000"`
-	GuestEmail      string         `json:"guest_email" gorm:"not null" example:"customer@example.com"`
-	ShippingAddress Address        `json:"shipping_address" gorm:"type:jsonb"`
-	Items           []OrderItem    `json:"items" gorm:"foreignKey:OrderID"`
-	TotalAmount     float64        `json:"total_amount" gorm:"not null" example:"120.00"`
-	Status          OrderStatus    `json:"status" gorm:"default:pending" example:"pending"`
-	StripePaymentID string         `json:"stripe_payment_id" example:"pi_1234567890"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                    uint           `json:"id" gorm:"primaryKey" example:"1"`
+	OrderNumber           string         `json:"order_number" gorm:"unique;not null" example:"BJJ-1753519000"`
+	GuestEmail            string         `json:"guest_email" gorm:"not null" example:"customer@example.com"`
+	ShippingAddress       Address        `json:"shipping_address" gorm:"type:jsonb"`
+	Items                 []OrderItem    `json:"items" gorm:"foreignKey:OrderID"`
+	TotalAmount           float64        `json:"total_amount" gorm:"not null" example:"120.00"`
+	Status                OrderStatus    `json:"status" gorm:"default:pending" example:"pending"`
+	StripePaymentID       string         `json:"stripe_payment_id" example:"pi_1234567890"`
+	HasBackorder          bool           `json:"has_backorder" gorm:"default:false;index" example:"false"`
+	HasPreorder           bool           `json:"has_preorder" gorm:"default:false;index" example:"true"`
+	ExpectedShipAt        *time.Time     `json:"expected_ship_at"`
+	PaymentCapture        PaymentCapture `json:"payment_capture,omitempty" example:"authorized"`
+	CapturedAt            *time.Time     `json:"captured_at,omitempty"`
+	DeliveredAt           *time.Time     `json:"delivered_at,omitempty"`
+	FulfillmentLocationID *uint          `json:"fulfillment_location_id,omitempty" example:"1"` // set when every in-stock item ships from one location
+	GiftCardID            *uint          `json:"gift_card_id,omitempty" example:"1"`
+	GiftCardAmount        float64        `json:"gift_card_amount" gorm:"default:0" example:"50.00"` // paid by gift card or store credit; the card paid the rest
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	DeletedAt             gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 type OrderItem struct {
-	ID        uint      `json:"id" gorm:"primaryKey" example:"1"`
-	OrderID   uint      `json:"order_id" gorm:"not null" example:"1"`
-	ProductID uint      `json:"product_id" gorm:"not null" example:"1"`
-	Product   Product   `json:"product" gorm:"foreignKey:ProductID"`
-	Quantity  int       `json:"quantity" gorm:"not null" example:"1"`
-	Price     float64   `json:"price" gorm:"not null" example:"120.00"`
-	Size      string    `json:"size" example:"A2"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                  uint            `json:"id" gorm:"primaryKey" example:"1"`
+	OrderID             uint            `json:"order_id" gorm:"not null" example:"1"`
+	ProductID           uint            `json:"product_id" gorm:"not null" example:"1"`
+	Product             Product         `json:"product" gorm:"foreignKey:ProductID"`
+	Quantity            int             `json:"quantity" gorm:"not null" example:"1"`
+	Price               float64         `json:"price" gorm:"not null" example:"120.00"`
+	UnitCost            float64         `json:"-" gorm:"default:0"` // cost price when the item was paid for
+	Size                string          `json:"size" example:"A2"`
+	BackorderedQuantity int             `json:"backordered_quantity" gorm:"default:0" example:"0"` // units sold beyond stock, taken from stock when the order ships
+	Fulfillment         ItemFulfillment `json:"fulfillment" gorm:"default:stock" example:"stock"`
+	CreatedAt           time.Time       `json:"created_at"`
 }
 
 type Address struct {
@@ -85,6 +112,38 @@ func (o *Order) CalculateTotal() {
 	o.TotalAmount = total
 }
 
+// MarkFulfillment flags the order as containing an item fulfilled the given
+// way and pushes out the expected ship date if the item ships later.
+func (o *Order) MarkFulfillment(fulfillment ItemFulfillment, shipDate *time.Time) {
+	switch fulfillment {
+	case FulfillBackorder:
+		o.HasBackorder = true
+	case FulfillPreorder:
+		o.HasPreorder = true
+	default:
+		return
+	}
+	if shipDate != nil && (o.ExpectedShipAt == nil || shipDate.After(*o.ExpectedShipAt)) {
+		o.ExpectedShipAt = shipDate
+	}
+}
+
+// CaptureOnShip reports whether payment should be authorized only and
+// captured at shipment, given the capture rule for pre-orders and backorders.
+func (o *Order) CaptureOnShip(preorderRule, backorderRule string) bool {
+	return (o.HasPreorder && preorderRule == "on_ship") ||
+		(o.HasBackorder && backorderRule == "on_ship")
+}
+
+// ReturnableUntil is when the return window for a delivered order closes.
+func (o *Order) ReturnableUntil(window time.Duration) time.Time {
+	delivered := o.UpdatedAt
+	if o.DeliveredAt != nil {
+		delivered = *o.DeliveredAt
+	}
+	return delivered.Add(window)
+}
+
 func (o *Order) GenerateOrderNumber() string {
 	return fmt.Sprintf("BJJ-%d", time.Now().Unix())
 }
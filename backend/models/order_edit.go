@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PaymentAdjustment string
+
+const (
+	AdjustmentNone          PaymentAdjustment = "none"          // order not paid yet, or total unchanged
+	AdjustmentCharge        PaymentAdjustment = "charge"        // difference charged to the card
+	AdjustmentRefund        PaymentAdjustment = "refund"        // difference refunded
+	AdjustmentAuthorization PaymentAdjustment = "authorization" // authorized amount changed before capture
+)
+
+// EditChanges lists what an order edit changed, one line per change.
+type EditChanges []string
+
+// OrderEdit records one admin edit to an order before it shipped. Edits are
+// append-only.
+type OrderEdit struct {
+	ID               uint              `json:"id" gorm:"primaryKey" example:"1"`
+	OrderID          uint              `json:"order_id" gorm:"not null;index" example:"42"`
+	Actor            string            `json:"actor" example:"admin@bjjstore.com"`
+	AdminID          *uint             `json:"admin_id,omitempty" example:"1"`
+	Changes          EditChanges       `json:"changes" gorm:"type:jsonb"`
+	PreviousTotal    float64           `json:"previous_total" example:"120.00"`
+	NewTotal         float64           `json:"new_total" example:"150.00"`
+	PaymentDelta     float64           `json:"payment_delta" example:"30.00"`
+	Adjustment       PaymentAdjustment `json:"adjustment" gorm:"size:32" example:"charge"`
+	PaymentReference string            `json:"payment_reference,omitempty" example:"TXN-1753519000-42"`
+	GiftCardRefund   float64           `json:"gift_card_refund" gorm:"default:0" example:"0"` // part of a refund put back on the gift card that paid for the order
+	Note             string            `json:"note" example:"Customer asked for an A1 instead"`
+	CreatedAt        time.Time         `json:"created_at" gorm:"index"`
+}
+
+func (e *OrderEdit) BeforeUpdate(tx *gorm.DB) error {
+	return errors.New("order edits are append-only")
+}
+
+func (e *OrderEdit) BeforeDelete(tx *gorm.DB) error {
+	return errors.New("order edits are append-only")
+}
+
+// GORM JSON handling for EditChanges
+func (c EditChanges) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+func (c *EditChanges) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, c)
+}
+
+// ReleaseOrderStock gives back quantity units of a product taken for an
+// order, to the locations they were taken from. Units the ledger cannot
+// place go to the default location.
+func ReleaseOrderStock(tx *gorm.DB, orderID, productID uint, quantity int, change StockChange) error {
+	allocations, err := OrderStockAllocations(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, allocation := range allocations {
+		if quantity == 0 {
+			break
+		}
+		if allocation.ProductID != productID {
+			continue
+		}
+		qty := min(quantity, allocation.Quantity)
+		change.LocationID = allocation.LocationID
+		if _, err := ApplyStockChange(tx, productID, qty, change); err != nil {
+			return err
+		}
+		quantity -= qty
+	}
+
+	if quantity > 0 {
+		change.LocationID = nil
+		if _, err := ApplyStockChange(tx, productID, quantity, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
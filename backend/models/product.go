@@ -9,17 +9,37 @@ import (
 )
 
 type Product struct {
-	ID          uint           `json:"id" gorm:"primaryKey" example:"1"`
-	Name        string         `json:"name" gorm:"not null" example:"Tatami Estilo 6.0 Gi"`
-	Description string         `json:"description" example:"Premium BJJ gi with excellent fit and durability"`
-	Price       float64        `json:"price" gorm:"not null" example:"120.00"`
-	Category    string         `json:"category" example:"gi"`
-	SizeOptions string         `json:"size_options" gorm:"type:text" example:"A1,A2,A3,A4"` // Changed to simple string
-	Stock       int            `json:"stock" gorm:"default:0" example:"15"`
-	ImageURL    string         `json:"image_url" example:"https://example.com/gi.jpg"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID               uint                   `json:"id" gorm:"primaryKey" example:"1"`
+	Name             string                 `json:"name" gorm:"not null" example:"Tatami Estilo 6.0 Gi"`
+	Slug             string                 `json:"slug" gorm:"size:255;uniqueIndex:idx_products_slug,where:slug <> ''" example:"tatami-estilo-6-0-gi"`
+	Description      string                 `json:"description" example:"Premium BJJ gi with excellent fit and durability"`
+	Price            float64                `json:"price" gorm:"not null" example:"120.00"`
+	CostPrice        float64                `json:"-" gorm:"default:0"` // weighted average cost of stock on hand, admin reports only
+	Category         string                 `json:"category" example:"gi"`
+	Brand            string                 `json:"brand" gorm:"index" example:"Tatami"`
+	SizeOptions      string                 `json:"size_options" gorm:"type:text" example:"A1,A2,A3,A4"` // Changed to simple string
+	Stock            int                    `json:"stock" gorm:"default:0" example:"15"`
+	ReorderThreshold int                    `json:"reorder_threshold" gorm:"default:0" example:"3"` // alert when stock falls to this level
+	ReorderQuantity  int                    `json:"reorder_quantity" gorm:"default:0" example:"20"`
+	LowStockSince    *time.Time             `json:"low_stock_since"`
+	AllowBackorder   bool                   `json:"allow_backorder" gorm:"default:false" example:"false"`
+	IsPreorder       bool                   `json:"is_preorder" gorm:"default:false" example:"true"`
+	ExpectedShipDate *time.Time             `json:"expected_ship_date" example:"2025-09-01T00:00:00Z"`
+	BackorderLimit   *int                   `json:"backorder_limit" example:"50"`                         // units that may be sold beyond stock; nil means no cap
+	IsBundle         bool                   `json:"is_bundle" gorm:"default:false;index" example:"false"` // stock is derived from BundleItems
+	BundleItems      []BundleItem           `json:"bundle_items,omitempty" gorm:"foreignKey:BundleID"`
+	ImageURL         string                 `json:"image_url" example:"https://example.com/gi.jpg"`
+	MetaTitle        string                 `json:"meta_title" gorm:"size:255" example:"Tatami Estilo 6.0 Gi | BJJ Store"`
+	MetaDescription  string                 `json:"meta_description" gorm:"size:500" example:"Lightweight pearl weave competition gi"`
+	Images           []ProductImage         `json:"images,omitempty" gorm:"foreignKey:ProductID"`
+	AverageRating    float64                `json:"average_rating" gorm:"-" example:"4.5"`
+	ReviewCount      int64                  `json:"review_count" gorm:"-" example:"12"`
+	ComponentsPrice  float64                `json:"components_price,omitempty" gorm:"-" example:"210.00"` // bundles: price of the components bought separately
+	BundleSavings    float64                `json:"bundle_savings,omitempty" gorm:"-" example:"30.00"`
+	Availability     []LocationAvailability `json:"availability,omitempty" gorm:"-"` // stock per location
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt         `json:"-" gorm:"index"`
 }
 
 // Business methods
@@ -39,6 +59,15 @@ func (p *Product) HasSufficientStock(quantity int) bool {
 	return p.Stock >= quantity
 }
 
+// AcceptsBackorders reports whether the product can be sold beyond its stock.
+func (p *Product) AcceptsBackorders() bool {
+	return p.AllowBackorder || p.IsPreorder
+}
+
+func (p *Product) IsLowStock() bool {
+	return p.Stock <= p.ReorderThreshold
+}
+
 // Helper methods to work with size options as comma-separated string
 func (p *Product) GetSizeOptionsArray() []string {
 	if p.SizeOptions == "" {
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ProductImage struct {
+	ID           uint      `json:"id" gorm:"primaryKey" example:"1"`
+	ProductID    uint      `json:"product_id" gorm:"not null;index" example:"1"`
+	URL          string    `json:"url" gorm:"not null" example:"http://localhost:8080/uploads/products/1/4f2a9c.jpg"`
+	ThumbnailURL string    `json:"thumbnail_url" example:"http://localhost:8080/uploads/products/1/4f2a9c_thumb.jpg"`
+	StorageKey   string    `json:"-" gorm:"not null"`
+	ThumbnailKey string    `json:"-"`
+	AltText      string    `json:"alt_text" example:"Front view of the white gi"`
+	SortOrder    int       `json:"sort_order" gorm:"default:0" example:"0"`
+	ContentType  string    `json:"content_type" example:"image/jpeg"`
+	Width        int       `json:"width" example:"1200"`
+	Height       int       `json:"height" example:"1600"`
+	Size         int64     `json:"size" example:"245760"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Image changes touch the product, so the sitemap and merchant feeds pick
+// up the new gallery on their next refresh.
+func (i *ProductImage) AfterCreate(tx *gorm.DB) error {
+	return touchProduct(tx, i.ProductID)
+}
+
+func (i *ProductImage) AfterUpdate(tx *gorm.DB) error {
+	return touchProduct(tx, i.ProductID)
+}
+
+func (i *ProductImage) AfterDelete(tx *gorm.DB) error {
+	return touchProduct(tx, i.ProductID)
+}
+
+func touchProduct(tx *gorm.DB, productID uint) error {
+	if productID == 0 {
+		return nil
+	}
+	return tx.Model(&Product{}).Where("id = ?", productID).UpdateColumn("updated_at", time.Now()).Error
+}
+
+// NextImageSortOrder returns the sort order for an image appended to the
+// end of a product's gallery.
+func NextImageSortOrder(productID uint) int {
+	var maxOrder struct {
+		Max *int
+	}
+	DB.Model(&ProductImage{}).
+		Where("product_id = ?", productID).
+		Select("MAX(sort_order) as max").
+		Scan(&maxOrder)
+	if maxOrder.Max == nil {
+		return 0
+	}
+	return *maxOrder.Max + 1
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PurchaseOrderStatus string
+
+const (
+	PurchaseOrderDraft             PurchaseOrderStatus = "draft"
+	PurchaseOrderOrdered           PurchaseOrderStatus = "ordered"
+	PurchaseOrderPartiallyReceived PurchaseOrderStatus = "partially_received"
+	PurchaseOrderReceived          PurchaseOrderStatus = "received"
+	PurchaseOrderCancelled         PurchaseOrderStatus = "cancelled"
+)
+
+type Supplier struct {
+	ID          uint           `json:"id" gorm:"primaryKey" example:"1"`
+	Name        string         `json:"name" gorm:"not null;uniqueIndex" example:"Tatami Fightwear"`
+	ContactName string         `json:"contact_name" example:"Jane Smith"`
+	Email       string         `json:"email" example:"orders@tatamifightwear.com"`
+	Phone       string         `json:"phone" example:"+44 20 7946 0000"`
+	Notes       string         `json:"notes" gorm:"type:text"`
+	IsActive    bool           `json:"is_active" gorm:"default:true" example:"true"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+type PurchaseOrder struct {
+	ID         uint                `json:"id" gorm:"primaryKey" example:"1"`
+	PONumber   string              `json:"po_number" gorm:"unique;not null" example:"PO-1753519000123"`
+	SupplierID uint                `json:"supplier_id" gorm:"not null;index" example:"1"`
+	Supplier   Supplier            `json:"supplier" gorm:"foreignKey:SupplierID"`
+	Status     PurchaseOrderStatus `json:"status" gorm:"default:draft;index" example:"ordered"`
+	ExpectedAt *time.Time          `json:"expected_at" example:"2025-08-15T00:00:00Z"`
+	Notes      string              `json:"notes" gorm:"type:text"`
+	Lines      []PurchaseOrderLine `json:"lines" gorm:"foreignKey:PurchaseOrderID"`
+	TotalCost  float64             `json:"total_cost" example:"1200.00"`
+	CreatedBy  *uint               `json:"created_by" example:"1"`
+	OrderedAt  *time.Time          `json:"ordered_at"`
+	ReceivedAt *time.Time          `json:"received_at"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+type PurchaseOrderLine struct {
+	ID               uint       `json:"id" gorm:"primaryKey" example:"1"`
+	PurchaseOrderID  uint       `json:"purchase_order_id" gorm:"not null;index" example:"1"`
+	ProductID        uint       `json:"product_id" gorm:"not null;index" example:"1"`
+	Product          Product    `json:"product" gorm:"foreignKey:ProductID"`
+	QuantityOrdered  int        `json:"quantity_ordered" gorm:"not null" example:"20"`
+	QuantityReceived int        `json:"quantity_received" gorm:"default:0" example:"12"`
+	UnitCost         float64    `json:"unit_cost" gorm:"not null" example:"60.00"`
+	ExpectedAt       *time.Time `json:"expected_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// Business methods
+func (l *PurchaseOrderLine) Remaining() int {
+	return l.QuantityOrdered - l.QuantityReceived
+}
+
+func (po *PurchaseOrder) CalculateTotal() {
+	total := 0.0
+	for _, line := range po.Lines {
+		total += line.UnitCost * float64(line.QuantityOrdered)
+	}
+	po.TotalCost = total
+}
+
+// CanReceive reports whether goods can be booked in against the order.
+func (po *PurchaseOrder) CanReceive() bool {
+	return po.Status == PurchaseOrderOrdered || po.Status == PurchaseOrderPartiallyReceived
+}
+
+// RefreshReceiptStatus sets the status from the received quantities.
+func (po *PurchaseOrder) RefreshReceiptStatus() {
+	received, outstanding := 0, 0
+	for _, line := range po.Lines {
+		received += line.QuantityReceived
+		outstanding += line.Remaining()
+	}
+
+	switch {
+	case outstanding <= 0:
+		now := time.Now()
+		po.Status = PurchaseOrderReceived
+		po.ReceivedAt = &now
+	case received > 0:
+		po.Status = PurchaseOrderPartiallyReceived
+	}
+}
+
+func GeneratePONumber() string {
+	return fmt.Sprintf("PO-%d", time.Now().UnixMilli())
+}
+
+// ReceiveStock books quantity units of a product into stock at unitCost,
+// updating the product's weighted average cost and the inventory ledger.
+func ReceiveStock(tx *gorm.DB, productID uint, quantity int, unitCost float64, change StockChange) (*InventoryMovement, error) {
+	var product Product
+	if err := tx.Select("id", "stock", "cost_price").First(&product, productID).Error; err != nil {
+		return nil, err
+	}
+
+	cost := unitCost
+	if product.Stock > 0 {
+		cost = (float64(product.Stock)*product.CostPrice + float64(quantity)*unitCost) /
+			float64(product.Stock+quantity)
+	}
+	if err := tx.Model(&Product{}).Where("id = ?", productID).
+		UpdateColumn("cost_price", cost).Error; err != nil {
+		return nil, err
+	}
+
+	return ApplyStockChange(tx, productID, quantity, change)
+}
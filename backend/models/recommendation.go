@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RecommendationKind string
+
+const (
+	// RecommendationSimilar links products sharing a category or brand
+	RecommendationSimilar RecommendationKind = "similar"
+	// RecommendationBoughtTogether links products that appear in the same paid orders
+	RecommendationBoughtTogether RecommendationKind = "bought_together"
+)
+
+// ProductRecommendation is a precomputed edge between two products. Rows are
+// rebuilt by the recommendations job, so reads are a single indexed lookup.
+type ProductRecommendation struct {
+	ID               uint               `json:"id" gorm:"primaryKey" example:"1"`
+	ProductID        uint               `json:"product_id" gorm:"not null;index:idx_recommendations_lookup,priority:1" example:"1"`
+	Kind             RecommendationKind `json:"kind" gorm:"size:32;not null;index:idx_recommendations_lookup,priority:2" example:"bought_together"`
+	RelatedProductID uint               `json:"related_product_id" gorm:"not null" example:"2"`
+	Score            float64            `json:"score" example:"7"`
+	Rank             int                `json:"rank" gorm:"not null;index:idx_recommendations_lookup,priority:3" example:"1"`
+	CreatedAt        time.Time          `json:"created_at"`
+}
+
+// Recommendations returns the precomputed recommendations of the given kind
+// for productID, best first, skipping products that have since been deleted.
+func Recommendations(productID uint, kind RecommendationKind, limit int) ([]Product, error) {
+	var products []Product
+	err := DB.Model(&Product{}).
+		Joins("JOIN product_recommendations pr ON pr.related_product_id = products.id").
+		Where("pr.product_id = ? AND pr.kind = ?", productID, kind).
+		Order("pr.rank ASC").
+		Limit(limit).
+		Preload("Images", func(db *gorm.DB) *gorm.DB {
+			return db.Order("sort_order ASC, id ASC")
+		}).
+		Find(&products).Error
+	return products, err
+}
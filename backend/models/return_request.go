@@ -0,0 +1,157 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReturnStatus string
+
+const (
+	ReturnRequested ReturnStatus = "requested"
+	ReturnApproved  ReturnStatus = "approved"
+	ReturnRejected  ReturnStatus = "rejected"
+	ReturnReceived  ReturnStatus = "received" // goods back and inspected
+	ReturnCompleted ReturnStatus = "completed"
+)
+
+type ReturnReason string
+
+const (
+	ReturnWrongSize      ReturnReason = "wrong_size"
+	ReturnDefective      ReturnReason = "defective"
+	ReturnNotAsDescribed ReturnReason = "not_as_described"
+	ReturnWrongItem      ReturnReason = "wrong_item"
+	ReturnChangedMind    ReturnReason = "changed_mind"
+	ReturnOtherReason    ReturnReason = "other"
+)
+
+type ReturnResolution string
+
+const (
+	ResolutionRefund      ReturnResolution = "refund"
+	ResolutionExchange    ReturnResolution = "exchange"
+	ResolutionStoreCredit ReturnResolution = "store_credit"
+)
+
+type ItemCondition string
+
+const (
+	ConditionResaleable ItemCondition = "resaleable"
+	ConditionDamaged    ItemCondition = "damaged"
+)
+
+var (
+	ReturnReasons     = []ReturnReason{ReturnWrongSize, ReturnDefective, ReturnNotAsDescribed, ReturnWrongItem, ReturnChangedMind, ReturnOtherReason}
+	ReturnResolutions = []ReturnResolution{ResolutionRefund, ResolutionExchange, ResolutionStoreCredit}
+)
+
+// ReturnRequest is a customer's request to send back items from a delivered
+// order, tracked by its RMA number.
+type ReturnRequest struct {
+	ID         uint             `json:"id" gorm:"primaryKey" example:"1"`
+	RMANumber  string           `json:"rma_number" gorm:"unique;not null" example:"RMA-1753519000123"`
+	OrderID    uint             `json:"order_id" gorm:"not null;index" example:"42"`
+	Order      *Order           `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	Email      string           `json:"email" gorm:"not null;index" example:"customer@example.com"`
+	Status     ReturnStatus     `json:"status" gorm:"size:32;default:requested;index" example:"requested"`
+	Resolution ReturnResolution `json:"resolution" gorm:"size:32;not null" example:"exchange"` // requested by the customer; admins may change it when resolving
+	Comment    string           `json:"comment" gorm:"type:text" example:"The A2 is too long in the sleeves"`
+	Items      []ReturnItem     `json:"items" gorm:"foreignKey:ReturnRequestID"`
+	AdminNotes string           `json:"admin_notes,omitempty" gorm:"type:text"`
+
+	// Outcome
+	RefundAmount    float64 `json:"refund_amount" gorm:"default:0" example:"120.00"`
+	GiftCardRefund  float64 `json:"gift_card_refund" gorm:"default:0" example:"0"` // part of RefundAmount put back on the gift card that paid for the order
+	RefundReference string  `json:"refund_reference,omitempty" example:"RFD-1753519000"`
+	StoreCreditID   *uint   `json:"store_credit_id,omitempty" example:"5"`
+	ExchangeOrderID *uint   `json:"exchange_order_id,omitempty" example:"43"`
+	ProcessedBy     *uint   `json:"processed_by,omitempty" example:"1"`
+	RejectionReason string  `json:"rejection_reason,omitempty" example:"Item has been worn"`
+
+	ApprovedAt  *time.Time `json:"approved_at,omitempty"`
+	ReceivedAt  *time.Time `json:"received_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ReturnItem is a quantity of one order item being sent back.
+type ReturnItem struct {
+	ID              uint          `json:"id" gorm:"primaryKey" example:"1"`
+	ReturnRequestID uint          `json:"return_request_id" gorm:"not null;index" example:"1"`
+	OrderItemID     uint          `json:"order_item_id" gorm:"not null;index" example:"7"`
+	OrderItem       *OrderItem    `json:"order_item,omitempty" gorm:"foreignKey:OrderItemID"`
+	ProductID       uint          `json:"product_id" gorm:"not null;index" example:"1"`
+	Quantity        int           `json:"quantity" gorm:"not null" example:"1"`
+	UnitPrice       float64       `json:"unit_price" gorm:"not null" example:"120.00"` // price paid, from the order item
+	Reason          ReturnReason  `json:"reason" gorm:"size:32;not null" example:"wrong_size"`
+	Comment         string        `json:"comment" example:"Sleeves too long"`
+	ExchangeSize    string        `json:"exchange_size,omitempty" example:"A1"`                    // size wanted instead, for exchanges
+	Condition       ItemCondition `json:"condition,omitempty" gorm:"size:32" example:"resaleable"` // set on inspection
+	Restocked       bool          `json:"restocked" gorm:"default:false" example:"true"`
+	CreatedAt       time.Time     `json:"created_at"`
+}
+
+func GenerateRMANumber() string {
+	return fmt.Sprintf("RMA-%d", time.Now().UnixMilli())
+}
+
+// ItemsTotal is what the customer paid for the returned items.
+func (r *ReturnRequest) ItemsTotal() float64 {
+	total := 0.0
+	for _, item := range r.Items {
+		total += item.UnitPrice * float64(item.Quantity)
+	}
+	return RoundMoney(total)
+}
+
+// CanTransition reports whether the return may move to status next.
+func (r *ReturnRequest) CanTransition(next ReturnStatus) bool {
+	switch r.Status {
+	case ReturnRequested:
+		return next == ReturnApproved || next == ReturnRejected
+	case ReturnApproved:
+		return next == ReturnReceived || next == ReturnRejected
+	case ReturnReceived:
+		return next == ReturnCompleted
+	}
+	return false
+}
+
+// ReturnedQuantities sums, per order item, the units on the order's returns
+// that are still open or were accepted. Rejected returns do not count.
+func ReturnedQuantities(tx *gorm.DB, orderID uint) (map[uint]int, error) {
+	var rows []struct {
+		OrderItemID uint
+		Quantity    int
+	}
+	err := tx.Model(&ReturnItem{}).
+		Select("return_items.order_item_id, SUM(return_items.quantity) AS quantity").
+		Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id").
+		Where("return_requests.order_id = ? AND return_requests.status <> ?", orderID, ReturnRejected).
+		Group("return_items.order_item_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	quantities := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		quantities[row.OrderItemID] = row.Quantity
+	}
+	return quantities, nil
+}
+
+// ReturnedToGiftCard sums what completed returns of an order have already put
+// back on the gift card that paid for it.
+func ReturnedToGiftCard(tx *gorm.DB, orderID uint) (float64, error) {
+	var total float64
+	err := tx.Model(&ReturnRequest{}).
+		Where("order_id = ? AND status = ?", orderID, ReturnCompleted).
+		Select("COALESCE(SUM(gift_card_refund), 0)").
+		Scan(&total).Error
+	return total, err
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReviewStatus string
+
+const (
+	ReviewStatusPending  ReviewStatus = "pending"
+	ReviewStatusApproved ReviewStatus = "approved"
+	ReviewStatusRejected ReviewStatus = "rejected"
+)
+
+type Review struct {
+	ID               uint           `json:"id" gorm:"primaryKey" example:"1"`
+	ProductID        uint           `json:"product_id" gorm:"not null;index" example:"1"`
+	Email            string         `json:"-" gorm:"not null;index"`
+	Name             string         `json:"name" example:"John D."`
+	Rating           int            `json:"rating" gorm:"not null" example:"5"`
+	Title            string         `json:"title" example:"Great fit"`
+	Body             string         `json:"body" gorm:"type:text" example:"Shrank just enough after the first wash."`
+	VerifiedPurchase bool           `json:"verified_purchase" gorm:"default:false" example:"true"`
+	Status           ReviewStatus   `json:"status" gorm:"default:pending;index" example:"approved"`
+	ModeratedBy      *uint          `json:"moderated_by,omitempty" example:"1"`
+	ModeratedAt      *time.Time     `json:"moderated_at,omitempty"`
+	ModerationNote   string         `json:"moderation_note,omitempty" example:"Contains a link to another store"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// RatingSummary is the aggregate of approved reviews for a product.
+type RatingSummary struct {
+	ProductID     uint
+	AverageRating float64
+	ReviewCount   int64
+}
+
+// HasPurchased reports whether email has a paid order containing productID.
+func HasPurchased(email string, productID uint) bool {
+	var count int64
+	DB.Model(&OrderItem{}).
+		Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+		Where("LOWER(orders.guest_email) = LOWER(?) AND order_items.product_id = ?", email, productID).
+		Where("orders.status IN ?", []OrderStatus{OrderStatusPaid, OrderStatusShipped, OrderStatusDelivered}).
+		Count(&count)
+	return count > 0
+}
+
+// RatingSummaries returns approved review aggregates keyed by product ID.
+func RatingSummaries(productIDs []uint) (map[uint]RatingSummary, error) {
+	summaries := make(map[uint]RatingSummary, len(productIDs))
+	if len(productIDs) == 0 {
+		return summaries, nil
+	}
+
+	var rows []RatingSummary
+	err := DB.Model(&Review{}).
+		Select("product_id, AVG(rating) AS average_rating, COUNT(*) AS review_count").
+		Where("status = ? AND product_id IN ?", ReviewStatusApproved, productIDs).
+		Group("product_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		summaries[row.ProductID] = row
+	}
+	return summaries, nil
+}
+
+// AttachRatings fills in AverageRating and ReviewCount on products.
+func AttachRatings(products []Product) error {
+	ids := make([]uint, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+
+	summaries, err := RatingSummaries(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		summary := summaries[products[i].ID]
+		products[i].AverageRating = summary.AverageRating
+		products[i].ReviewCount = summary.ReviewCount
+	}
+	return nil
+}
+
+// AttachRating fills in AverageRating and ReviewCount on p.
+func (p *Product) AttachRating() error {
+	products := []Product{*p}
+	if err := AttachRatings(products); err != nil {
+		return err
+	}
+	p.AverageRating = products[0].AverageRating
+	p.ReviewCount = products[0].ReviewCount
+	return nil
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// Permission is one entry in the permission catalog. Routes name the
+// permission they require; roles are granted a set of them.
+type Permission struct {
+	ID          uint      `json:"id" gorm:"primaryKey" example:"1"`
+	Name        string    `json:"name" gorm:"size:64;not null;uniqueIndex" example:"view_orders"`
+	Description string    `json:"description" example:"View orders and their history"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Role is a named set of permissions assigned to admin users.
+type Role struct {
+	ID               uint         `json:"id" gorm:"primaryKey" example:"1"`
+	Name             AdminRole    `json:"name" gorm:"size:64;not null;uniqueIndex" example:"order_manager"`
+	Description      string       `json:"description" example:"Handles orders, returns and gift cards"`
+	IsSystem         bool         `json:"is_system" gorm:"default:false" example:"true"`          // built-in roles cannot be deleted
+	AllAccess        bool         `json:"all_access" gorm:"default:false" example:"false"`        // every permission, including ones added later
+	RequireTwoFactor bool         `json:"require_two_factor" gorm:"default:false" example:"true"` // admins with the role must set up 2FA
+	Permissions      []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+}
+
+// permissionDescriptions documents the built-in permissions for the catalog.
+var permissionDescriptions = map[string]string{
+	"view_products":     "View products",
+	"create_products":   "Create products",
+	"update_products":   "Edit products, images and bundles",
+	"delete_products":   "Delete products",
+	"moderate_reviews":  "Approve and reject reviews",
+	"view_inventory":    "View stock levels, movements and locations",
+	"manage_inventory":  "Adjust and transfer stock, manage locations",
+	"manage_purchasing": "Manage suppliers and purchase orders",
+	"view_reports":      "View margin and sales reports",
+	"view_orders":       "View orders, returns and edit history",
+	"update_orders":     "Update order status and edit orders",
+	"manage_gift_cards": "Issue, view and disable gift cards",
+	"manage_returns":    "Approve, receive and resolve returns",
+	"manage_roles":      "Create roles and assign permissions",
+	"manage_admins":     "Invite, deactivate and delete admin users",
+	"view_audit_log":    "View the audit log of admin changes",
+	"manage_api_keys":   "Create and revoke API keys",
+}
+
+// systemRoles are created on first run with the permissions the built-in
+// roles have always had.
+var systemRoles = []struct {
+	name        AdminRole
+	description string
+	allAccess   bool
+	permissions []string
+}{
+	{RoleSuperAdmin, "Full access to everything", true, nil},
+	{RoleInventory, "Manages the catalog, stock and purchasing", false, []string{
+		"view_products", "create_products", "update_products", "delete_products",
+		"moderate_reviews", "view_inventory", "manage_inventory", "manage_purchasing",
+	}},
+	{RoleOrderManager, "Handles orders, returns and gift cards", false, []string{
+		"view_orders", "update_orders", "manage_gift_cards", "manage_returns",
+	}},
+	{RoleViewer, "Read-only access", false, []string{
+		"view_products", "view_orders", "view_inventory",
+	}},
+}
+
+// SyncPermissions adds any permissions in names that are not yet in the
+// catalog. Existing permissions are left alone.
+func SyncPermissions(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	permissions := make([]Permission, 0, len(names))
+	for _, name := range names {
+		permissions = append(permissions, Permission{Name: name, Description: permissionDescriptions[name]})
+	}
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&permissions).Error
+}
+
+// seedRoles fills the permission catalog with the built-in permissions and
+// creates the built-in roles that do not exist yet.
+func seedRoles() {
+	names := make([]string, 0, len(permissionDescriptions))
+	for name := range permissionDescriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := SyncPermissions(names); err != nil {
+		log.Printf("Failed to seed permissions: %v", err)
+		return
+	}
+
+	for _, seed := range systemRoles {
+		var count int64
+		DB.Model(&Role{}).Where("name = ?", seed.name).Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		role := Role{Name: seed.name, Description: seed.description, IsSystem: true, AllAccess: seed.allAccess}
+		if len(seed.permissions) > 0 {
+			DB.Where("name IN ?", seed.permissions).Find(&role.Permissions)
+		}
+		if err := DB.Create(&role).Error; err != nil {
+			log.Printf("Failed to create role %s: %v", seed.name, err)
+			continue
+		}
+		log.Printf("Role created: %s", role.Name)
+	}
+}
+
+// cachedRole is what the permission check needs to know about a role.
+type cachedRole struct {
+	allAccess        bool
+	requireTwoFactor bool
+	permissions      map[string]bool
+}
+
+// permissionCache keeps every role's permissions in memory so permission
+// checks do not hit the database on each request. It is reloaded when it
+// is older than admin.permission_cache_ttl, or straight away after roles
+// are changed through this instance.
+var permissionCache struct {
+	sync.RWMutex
+	roles    map[AdminRole]cachedRole
+	loadedAt time.Time
+}
+
+// InvalidatePermissionCache makes the next permission check reload roles.
+func InvalidatePermissionCache() {
+	permissionCache.Lock()
+	permissionCache.roles = nil
+	permissionCache.Unlock()
+}
+
+func cachedRoles() (map[AdminRole]cachedRole, error) {
+	permissionCache.RLock()
+	roles, loadedAt := permissionCache.roles, permissionCache.loadedAt
+	permissionCache.RUnlock()
+	if roles != nil && time.Since(loadedAt) < config.AppConfig.Admin.PermissionCacheTTL {
+		return roles, nil
+	}
+
+	var rows []Role
+	if err := DB.Preload("Permissions").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	roles = make(map[AdminRole]cachedRole, len(rows))
+	for _, row := range rows {
+		role := cachedRole{
+			allAccess:        row.AllAccess,
+			requireTwoFactor: row.RequireTwoFactor,
+			permissions:      make(map[string]bool, len(row.Permissions)),
+		}
+		for _, permission := range row.Permissions {
+			role.permissions[permission.Name] = true
+		}
+		roles[row.Name] = role
+	}
+
+	permissionCache.Lock()
+	permissionCache.roles = roles
+	permissionCache.loadedAt = time.Now()
+	permissionCache.Unlock()
+	return roles, nil
+}
+
+// RoleHasPermission reports whether role grants permission.
+func RoleHasPermission(role AdminRole, permission string) (bool, error) {
+	roles, err := cachedRoles()
+	if err != nil {
+		return false, err
+	}
+	r, ok := roles[role]
+	if !ok {
+		return false, nil
+	}
+	return r.allAccess || r.permissions[permission], nil
+}
+
+// RoleCovers reports whether role has every permission target has. Only
+// roles with every permission cover those roles too.
+func RoleCovers(role, target AdminRole) (bool, error) {
+	roles, err := cachedRoles()
+	if err != nil {
+		return false, err
+	}
+	r, ok := roles[role]
+	if !ok {
+		return false, nil
+	}
+	if r.allAccess {
+		return true, nil
+	}
+	t, ok := roles[target]
+	if !ok || t.allAccess {
+		return false, nil
+	}
+	for permission := range t.permissions {
+		if !r.permissions[permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// RoleRequiresTwoFactor reports whether admins with role must use
+// two-factor authentication.
+func RoleRequiresTwoFactor(role AdminRole) (bool, error) {
+	roles, err := cachedRoles()
+	if err != nil {
+		return false, err
+	}
+	return roles[role].requireTwoFactor, nil
+}
+
+// RolePermissions lists the permissions role grants, for showing to the
+// admin who has it.
+func RolePermissions(role AdminRole) ([]string, error) {
+	roles, err := cachedRoles()
+	if err != nil {
+		return nil, err
+	}
+	r, ok := roles[role]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+
+	var names []string
+	if r.allAccess {
+		if err := DB.Model(&Permission{}).Order("name").Pluck("name", &names).Error; err != nil {
+			return nil, err
+		}
+		return names, nil
+	}
+	for name := range r.permissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RoleExists reports whether a role with the given name has been defined.
+func RoleExists(tx *gorm.DB, name AdminRole) bool {
+	var count int64
+	tx.Model(&Role{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// ProductSlugRedirect remembers a slug a product used to have so that old
+// links keep resolving after the slug is edited.
+type ProductSlugRedirect struct {
+	ID        uint      `json:"id" gorm:"primaryKey" example:"1"`
+	ProductID uint      `json:"product_id" gorm:"not null;index" example:"1"`
+	Slug      string    `json:"slug" gorm:"size:255;uniqueIndex;not null" example:"tatami-estilo-gi"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Slugify converts s into a lowercase, hyphen separated ASCII slug.
+// Accents are stripped ("Jiu-Jitsu Gi Trançado" -> "jiu-jitsu-gi-trancado").
+func Slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Drop combining marks left over from decomposing accented letters
+		case r == 'đ':
+			b.WriteRune('d')
+			hyphen = false
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			hyphen = false
+		default:
+			if !hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+				hyphen = true
+			}
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if len(slug) > 200 {
+		slug = strings.TrimSuffix(slug[:200], "-")
+	}
+	return slug
+}
+
+// slugTaken reports whether slug is in use, or was previously used, by a
+// product other than productID. Soft-deleted products keep their slugs.
+func slugTaken(db *gorm.DB, slug string, productID uint) (bool, error) {
+	var count int64
+	if err := db.Unscoped().Model(&Product{}).
+		Where("slug = ? AND id <> ?", slug, productID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	if err := db.Model(&ProductSlugRedirect{}).
+		Where("slug = ? AND product_id <> ?", slug, productID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// UniqueSlug returns base, or base with a numeric suffix, such that it is not
+// used by any product other than productID.
+func UniqueSlug(db *gorm.DB, base string, productID uint) (string, error) {
+	if base == "" {
+		base = "product"
+	}
+	slug := base
+	for i := 2; ; i++ {
+		taken, err := slugTaken(db, slug, productID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// RecordSlugChange keeps oldSlug as a redirect to the product and drops any
+// redirect the product's new slug would otherwise shadow.
+func RecordSlugChange(db *gorm.DB, productID uint, oldSlug, newSlug string) error {
+	if oldSlug == "" || oldSlug == newSlug {
+		return nil
+	}
+
+	if err := db.Where("slug = ? AND product_id = ?", newSlug, productID).
+		Delete(&ProductSlugRedirect{}).Error; err != nil {
+		return err
+	}
+
+	redirect := ProductSlugRedirect{ProductID: productID, Slug: oldSlug}
+	return db.Where(ProductSlugRedirect{Slug: oldSlug}).FirstOrCreate(&redirect).Error
+}
+
+// BeforeSave generates a slug from the product name when none is set and
+// normalises and de-duplicates slugs supplied by admins.
+func (p *Product) BeforeSave(tx *gorm.DB) error {
+	base := Slugify(p.Slug)
+	if base == "" {
+		base = Slugify(p.Name)
+	}
+
+	slug, err := UniqueSlug(tx.Session(&gorm.Session{NewDB: true}), base, p.ID)
+	if err != nil {
+		return err
+	}
+	p.Slug = slug
+	return nil
+}
+
+// backfillProductSlugs assigns slugs to products created before slugs existed.
+func backfillProductSlugs() {
+	var products []Product
+	if err := DB.Where("slug IS NULL OR slug = ''").Find(&products).Error; err != nil {
+		log.Printf("Failed to load products for slug backfill: %v", err)
+		return
+	}
+	for i := range products {
+		if err := DB.Save(&products[i]).Error; err != nil {
+			log.Printf("Failed to generate slug for product %d: %v", products[i].ID, err)
+		}
+	}
+	if len(products) > 0 {
+		log.Printf("Generated slugs for %d products", len(products))
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// StockSubscription is a customer's request to be emailed when an
+// out-of-stock product becomes available again.
+type StockSubscription struct {
+	ID         uint       `json:"id" gorm:"primaryKey" example:"1"`
+	ProductID  uint       `json:"product_id" gorm:"not null;uniqueIndex:idx_stock_subscriptions_pending,where:notified_at IS NULL" example:"1"`
+	Product    Product    `json:"-" gorm:"foreignKey:ProductID"`
+	Email      string     `json:"email" gorm:"not null;uniqueIndex:idx_stock_subscriptions_pending,where:notified_at IS NULL" example:"customer@example.com"`
+	Size       string     `json:"size" gorm:"uniqueIndex:idx_stock_subscriptions_pending,where:notified_at IS NULL" example:"A2"`
+	NotifiedAt *time.Time `json:"notified_at" gorm:"index"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// PendingStockSubscriptions returns subscriptions for productID that have
+// not been notified yet, oldest first.
+func PendingStockSubscriptions(productID uint) ([]StockSubscription, error) {
+	var subs []StockSubscription
+	err := DB.Where("product_id = ? AND notified_at IS NULL", productID).
+		Order("created_at ASC, id ASC").
+		Find(&subs).Error
+	return subs, err
+}
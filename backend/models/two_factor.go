@@ -0,0 +1,91 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TokenTwoFactor is the purpose of the challenge token handed out by the
+// first login step to admins with two-factor authentication.
+const TokenTwoFactor AdminTokenPurpose = "two_factor"
+
+// RecoveryCodeCount is how many recovery codes an admin gets at a time.
+const RecoveryCodeCount = 10
+
+// AdminRecoveryCode is a single-use code that stands in for a TOTP code when
+// the admin has lost their authenticator. Only a hash is stored.
+type AdminRecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	AdminID   uint       `json:"admin_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// normalizeRecoveryCode lets admins type codes with or without the dash and
+// in any case.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// ReplaceRecoveryCodes discards an admin's recovery codes and creates a new
+// set. The plain codes are returned once and never stored.
+func ReplaceRecoveryCodes(tx *gorm.DB, adminID uint) ([]string, error) {
+	if err := tx.Where("admin_id = ?", adminID).Delete(&AdminRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, RecoveryCodeCount)
+	records := make([]AdminRecoveryCode, 0, RecoveryCodeCount)
+	for len(codes) < RecoveryCodeCount {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := encoding.EncodeToString(buf) // 8 characters
+		codes = append(codes, code[:4]+"-"+code[4:])
+		records = append(records, AdminRecoveryCode{AdminID: adminID, CodeHash: hashAdminToken(code)})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode marks one of an admin's recovery codes as used, or fails
+// with ErrTokenInvalid if it does not match an unused code.
+func UseRecoveryCode(tx *gorm.DB, adminID uint, code string) error {
+	result := tx.Model(&AdminRecoveryCode{}).
+		Where("admin_id = ? AND code_hash = ? AND used_at IS NULL", adminID, hashAdminToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+// RemainingRecoveryCodes counts an admin's unused recovery codes.
+func RemainingRecoveryCodes(tx *gorm.DB, adminID uint) int64 {
+	var count int64
+	tx.Model(&AdminRecoveryCode{}).Where("admin_id = ? AND used_at IS NULL", adminID).Count(&count)
+	return count
+}
+
+// NeedsTwoFactorSetup reports whether the admin's role requires two-factor
+// authentication that the admin has not set up yet.
+func (a *AdminUser) NeedsTwoFactorSetup() bool {
+	if a.TOTPEnabled {
+		return false
+	}
+	required, err := RoleRequiresTwoFactor(a.Role)
+	// Fail closed: if the policy cannot be read, ask for setup
+	return err != nil || required
+}
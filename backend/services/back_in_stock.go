@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+)
+
+// BackInStockNotifier emails customers subscribed to an out-of-stock product
+// once it is back in stock, then marks their subscriptions fulfilled.
+type BackInStockNotifier struct {
+	mailer   Mailer
+	settings FeedSettings
+	queue    chan uint
+}
+
+var backInStockNotifier *BackInStockNotifier
+
+// StartBackInStockNotifier starts the background sender. Products queued with
+// QueueBackInStockCheck are handled as soon as possible, and pending
+// subscriptions for in-stock products are swept every interval to catch
+// restocks made elsewhere.
+func StartBackInStockNotifier(mailer Mailer, settings FeedSettings, interval time.Duration) {
+	n := &BackInStockNotifier{
+		mailer:   mailer,
+		settings: settings,
+		queue:    make(chan uint, 256),
+	}
+	backInStockNotifier = n
+
+	go func() {
+		var sweep <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			sweep = ticker.C
+		}
+
+		n.sweep()
+		for {
+			select {
+			case id := <-n.queue:
+				if err := n.notify(id); err != nil {
+					log.Printf("Back in stock notification failed for product %d: %v", id, err)
+				}
+			case <-sweep:
+				n.sweep()
+			}
+		}
+	}()
+}
+
+// QueueBackInStockCheck asks the notifier to email subscribers of the given
+// products if they are in stock. It never blocks.
+func QueueBackInStockCheck(productIDs ...uint) {
+	n := backInStockNotifier
+	if n == nil {
+		return
+	}
+	for _, id := range productIDs {
+		select {
+		case n.queue <- id:
+		default:
+		}
+	}
+}
+
+func (n *BackInStockNotifier) sweep() {
+	var ids []uint
+	err := models.DB.Model(&models.StockSubscription{}).
+		Joins("JOIN products ON products.id = stock_subscriptions.product_id AND products.deleted_at IS NULL").
+		Where("stock_subscriptions.notified_at IS NULL AND products.stock > 0").
+		Distinct().
+		Pluck("stock_subscriptions.product_id", &ids).Error
+	if err != nil {
+		log.Printf("Back in stock sweep failed: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := n.notify(id); err != nil {
+			log.Printf("Back in stock notification failed for product %d: %v", id, err)
+		}
+	}
+}
+
+func (n *BackInStockNotifier) notify(productID uint) error {
+	var product models.Product
+	if err := models.DB.First(&product, productID).Error; err != nil {
+		return err
+	}
+	if !product.IsAvailable() {
+		return nil
+	}
+
+	subs, err := models.PendingStockSubscriptions(product.ID)
+	if err != nil {
+		return err
+	}
+
+	link := productLink(n.settings, feedEntry{ID: product.ID, Slug: product.Slug})
+	for _, sub := range subs {
+		name := product.Name
+		if sub.Size != "" {
+			name += " (size " + sub.Size + ")"
+		}
+		err := n.mailer.Send(context.Background(), Email{
+			To:      sub.Email,
+			Subject: product.Name + " is back in stock",
+			Body: fmt.Sprintf("Good news! %s is back in stock at %s.\n\n%s\n\n"+
+				"You are receiving this email because you asked to be notified. "+
+				"This is a one-time notification.", name, n.settings.Brand, link),
+		})
+		if err != nil {
+			// Leave the subscription pending so the next sweep retries it
+			log.Printf("Failed to send back in stock email to subscription %d: %v", sub.ID, err)
+			continue
+		}
+
+		now := time.Now()
+		if err := models.DB.Model(&models.StockSubscription{}).
+			Where("id = ? AND notified_at IS NULL", sub.ID).
+			UpdateColumn("notified_at", now).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"gorm.io/gorm"
+)
+
+// FeedSettings describes the storefront the sitemap and product feed link to.
+type FeedSettings struct {
+	BaseURL  string
+	Brand    string
+	Currency string
+}
+
+// FeedDocument is a rendered sitemap or feed ready to be served.
+type FeedDocument struct {
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+}
+
+type feedEntry struct {
+	ID          uint
+	Slug        string
+	Title       string
+	Description string
+	Category    string
+	Brand       string
+	Price       float64
+	Stock       int
+	Backorder   bool
+	Preorder    bool
+	ImageURL    string
+	UpdatedAt   time.Time
+}
+
+// CatalogFeed keeps an in-memory copy of the active catalog for the sitemap
+// and merchant feeds. Each Refresh only loads products changed since the
+// previous one, and documents are re-rendered only when something changed.
+type CatalogFeed struct {
+	mu       sync.Mutex
+	entries  map[uint]feedEntry
+	synced   bool
+	lastSync time.Time
+	version  uint64
+	rendered map[string]renderedFeed
+}
+
+type renderedFeed struct {
+	version uint64
+	doc     *FeedDocument
+}
+
+func NewCatalogFeed() *CatalogFeed {
+	return &CatalogFeed{
+		entries:  make(map[uint]feedEntry),
+		rendered: make(map[string]renderedFeed),
+	}
+}
+
+// Refresh applies product changes made since the last refresh.
+func (f *CatalogFeed) Refresh() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.refreshLocked()
+}
+
+func (f *CatalogFeed) refreshLocked() error {
+	// Start the next window slightly in the past so writes committed while
+	// this query runs are picked up next time
+	syncStart := time.Now().Add(-time.Second)
+
+	query := models.DB.Unscoped().Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order ASC, id ASC")
+	})
+	if f.synced {
+		query = query.Where("updated_at > ? OR deleted_at > ?", f.lastSync, f.lastSync)
+	}
+
+	var products []models.Product
+	if err := query.Find(&products).Error; err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		if p.DeletedAt.Valid {
+			delete(f.entries, p.ID)
+			continue
+		}
+
+		image := p.ImageURL
+		if len(p.Images) > 0 {
+			image = p.Images[0].URL
+		}
+		f.entries[p.ID] = feedEntry{
+			ID:          p.ID,
+			Slug:        p.Slug,
+			Title:       p.Name,
+			Description: p.Description,
+			Category:    p.Category,
+			Brand:       p.Brand,
+			Price:       p.Price,
+			Stock:       p.Stock,
+			Backorder:   p.AllowBackorder,
+			Preorder:    p.IsPreorder,
+			ImageURL:    image,
+			UpdatedAt:   p.UpdatedAt,
+		}
+	}
+
+	if !f.synced || len(products) > 0 {
+		f.version++
+	}
+	f.synced = true
+	f.lastSync = syncStart
+	return nil
+}
+
+func (f *CatalogFeed) document(kind string, settings FeedSettings, render func([]feedEntry, FeedSettings) ([]byte, error)) (*FeedDocument, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refreshLocked(); err != nil {
+		return nil, err
+	}
+
+	if cached, ok := f.rendered[kind]; ok && cached.version == f.version {
+		return cached.doc, nil
+	}
+
+	entries := make([]feedEntry, 0, len(f.entries))
+	var lastModified time.Time
+	for _, e := range f.entries {
+		entries = append(entries, e)
+		if e.UpdatedAt.After(lastModified) {
+			lastModified = e.UpdatedAt
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	body, err := render(entries, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(body)
+	doc := &FeedDocument{
+		Body:         body,
+		ETag:         `"` + hex.EncodeToString(hash[:16]) + `"`,
+		LastModified: lastModified,
+	}
+	f.rendered[kind] = renderedFeed{version: f.version, doc: doc}
+	return doc, nil
+}
+
+// Sitemap returns the sitemap.xml for the storefront.
+func (f *CatalogFeed) Sitemap(settings FeedSettings) (*FeedDocument, error) {
+	return f.document("sitemap", settings, renderSitemap)
+}
+
+// ProductsXML returns a Google Merchant Center RSS 2.0 product feed.
+func (f *CatalogFeed) ProductsXML(settings FeedSettings) (*FeedDocument, error) {
+	return f.document("products.xml", settings, renderProductsXML)
+}
+
+// ProductsCSV returns the product feed as CSV with Merchant Center headers.
+func (f *CatalogFeed) ProductsCSV(settings FeedSettings) (*FeedDocument, error) {
+	return f.document("products.csv", settings, renderProductsCSV)
+}
+
+// productLink is the storefront page of a product, by slug where it has one.
+func productLink(settings FeedSettings, e feedEntry) string {
+	path := e.Slug
+	if path == "" {
+		path = strconv.FormatUint(uint64(e.ID), 10)
+	}
+	return strings.TrimRight(settings.BaseURL, "/") + "/products/" + path
+}
+
+func availability(e feedEntry) string {
+	switch {
+	case e.Stock > 0:
+		return "in_stock"
+	case e.Preorder:
+		return "preorder"
+	case e.Backorder:
+		return "backorder"
+	}
+	return "out_of_stock"
+}
+
+func formatPrice(settings FeedSettings, price float64) string {
+	return fmt.Sprintf("%.2f %s", price, settings.Currency)
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+func renderSitemap(entries []feedEntry, settings FeedSettings) ([]byte, error) {
+	base := strings.TrimRight(settings.BaseURL, "/")
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+
+	set.URLs = append(set.URLs,
+		sitemapURL{Loc: base + "/", ChangeFreq: "daily", Priority: "1.0"},
+		sitemapURL{Loc: base + "/products", ChangeFreq: "daily", Priority: "0.9"},
+	)
+
+	categories := map[string]time.Time{}
+	for _, e := range entries {
+		if e.Category == "" {
+			continue
+		}
+		if e.UpdatedAt.After(categories[e.Category]) {
+			categories[e.Category] = e.UpdatedAt
+		}
+	}
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:        base + "/products?category=" + url.QueryEscape(name),
+			LastMod:    categories[name].UTC().Format("2006-01-02"),
+			ChangeFreq: "weekly",
+			Priority:   "0.7",
+		})
+	}
+
+	for _, e := range entries {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:        productLink(settings, e),
+			LastMod:    e.UpdatedAt.UTC().Format("2006-01-02"),
+			ChangeFreq: "weekly",
+			Priority:   "0.8",
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type merchantRSS struct {
+	XMLName xml.Name        `xml:"rss"`
+	Version string          `xml:"version,attr"`
+	XMLNSG  string          `xml:"xmlns:g,attr"`
+	Channel merchantChannel `xml:"channel"`
+}
+
+type merchantChannel struct {
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	Items       []merchantItem `xml:"item"`
+}
+
+type merchantItem struct {
+	ID              string `xml:"g:id"`
+	Title           string `xml:"g:title"`
+	Description     string `xml:"g:description"`
+	Link            string `xml:"g:link"`
+	ImageLink       string `xml:"g:image_link,omitempty"`
+	Availability    string `xml:"g:availability"`
+	Price           string `xml:"g:price"`
+	Brand           string `xml:"g:brand,omitempty"`
+	Condition       string `xml:"g:condition"`
+	ProductType     string `xml:"g:product_type,omitempty"`
+	IdentifierExist string `xml:"g:identifier_exists"`
+}
+
+func merchantItems(entries []feedEntry, settings FeedSettings) []merchantItem {
+	items := make([]merchantItem, 0, len(entries))
+	for _, e := range entries {
+		brand := e.Brand
+		if brand == "" {
+			brand = settings.Brand
+		}
+		items = append(items, merchantItem{
+			ID:              strconv.FormatUint(uint64(e.ID), 10),
+			Title:           e.Title,
+			Description:     e.Description,
+			Link:            productLink(settings, e),
+			ImageLink:       e.ImageURL,
+			Availability:    availability(e),
+			Price:           formatPrice(settings, e.Price),
+			Brand:           brand,
+			Condition:       "new",
+			ProductType:     e.Category,
+			IdentifierExist: "no",
+		})
+	}
+	return items
+}
+
+func renderProductsXML(entries []feedEntry, settings FeedSettings) ([]byte, error) {
+	feed := merchantRSS{
+		Version: "2.0",
+		XMLNSG:  "http://base.google.com/ns/1.0",
+		Channel: merchantChannel{
+			Title:       settings.Brand,
+			Link:        strings.TrimRight(settings.BaseURL, "/"),
+			Description: settings.Brand + " product feed",
+			Items:       merchantItems(entries, settings),
+		},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func renderProductsCSV(entries []feedEntry, settings FeedSettings) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"id", "title", "description", "link", "image_link", "availability", "price", "brand", "condition", "product_type", "identifier_exists"})
+	for _, item := range merchantItems(entries, settings) {
+		w.Write([]string{
+			item.ID, item.Title, item.Description, item.Link, item.ImageLink,
+			item.Availability, item.Price, item.Brand, item.Condition,
+			item.ProductType, item.IdentifierExist,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
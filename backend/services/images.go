@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedImageType = errors.New("unsupported image type")
+	ErrImageTooLarge        = errors.New("image dimensions too large")
+)
+
+// maxImagePixels guards against small files that decode to huge bitmaps.
+const maxImagePixels = 40_000_000
+
+// AllowedImageTypes maps sniffed content types to file extensions.
+var AllowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ProcessedImage is an uploaded image along with its generated thumbnail.
+type ProcessedImage struct {
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+	Thumbnail   []byte
+}
+
+// ProcessImage sniffs the content type of data, decodes it and renders a
+// JPEG thumbnail whose longest edge is at most thumbSize pixels. The content
+// type is taken from the bytes themselves, never from the client.
+func ProcessImage(data []byte, thumbSize int) (*ProcessedImage, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := AllowedImageTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImageType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	var img image.Image
+	switch contentType {
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, Thumbnail(img, thumbSize), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	return &ProcessedImage{
+		ContentType: contentType,
+		Extension:   ext,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Thumbnail:   thumb.Bytes(),
+	}, nil
+}
+
+// Thumbnail scales img down so that its longest edge is maxSize pixels,
+// averaging the source pixels covered by each destination pixel. Images that
+// already fit are copied unchanged. Transparent areas are flattened onto white
+// since thumbnails are encoded as JPEG.
+func Thumbnail(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if maxSize > 0 && (srcW > maxSize || srcH > maxSize) {
+		if srcW >= srcH {
+			dstW = maxSize
+			dstH = max(1, srcH*maxSize/srcW)
+		} else {
+			dstH = maxSize
+			dstW = max(1, srcW*maxSize/srcH)
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcH/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcW/dstW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+			// Composite the premultiplied average over a white background.
+			white := (0xffff*n - a)
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + white) / n >> 8),
+				G: uint8((g + white) / n >> 8),
+				B: uint8((b + white) / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -8,46 +9,83 @@ import (
 
 	"github.com/calvinnle/bjj-store/backend/models"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type JWTClaims struct {
 	AdminID uint             `json:"admin_id"`
 	Email   string           `json:"email"`
 	Role    models.AdminRole `json:"role"`
+	// Tokens with these set only work for changing the password or setting
+	// up two-factor authentication
+	PasswordChangeRequired bool `json:"pwd_change,omitempty"`
+	TwoFactorSetupRequired bool `json:"mfa_setup,omitempty"`
 	jwt.RegisteredClaims
 }
 
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// refreshReuseError carries the family to revoke out of the refresh
+// transaction, which is rolled back.
+type refreshReuseError struct {
+	familyID string
+}
+
+func (e *refreshReuseError) Error() string { return ErrRefreshTokenReused.Error() }
+
 type JWTService struct {
-	secretKey string
+	keys       *KeySet
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	maxAge     time.Duration
 }
 
 // Remove the config dependency from constructor
-func NewJWTService(secretKey string) *JWTService {
+func NewJWTService(keys *KeySet) *JWTService {
 	return &JWTService{
-		secretKey: secretKey,
+		keys:       keys,
+		accessTTL:  15 * time.Minute,
+		refreshTTL: 24 * time.Hour,
+	}
+}
+
+// WithSessionTTLs sets how long access tokens, refresh tokens and whole
+// sessions last.
+func (s *JWTService) WithSessionTTLs(access, refresh, maxAge time.Duration) *JWTService {
+	if access > 0 {
+		s.accessTTL = access
+	}
+	if refresh > 0 {
+		s.refreshTTL = refresh
 	}
+	s.maxAge = maxAge
+	return s
 }
 
 func (s *JWTService) GenerateToken(admin *models.AdminUser) (string, error) {
 	claims := JWTClaims{
-		AdminID: admin.ID,
-		Email:   admin.Email,
-		Role:    admin.Role,
+		AdminID:                admin.ID,
+		Email:                  admin.Email,
+		Role:                   admin.Role,
+		PasswordChangeRequired: admin.MustChangePassword,
+		TwoFactorSetupRequired: admin.NeedsTwoFactorSetup(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(2 * time.Hour)), // 2 hours
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.accessTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "bjj-store",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.secretKey))
+	return s.keys.sign(claims)
 }
 
 func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, s.keys.keyFunc,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
 	if err != nil {
 		return nil, err
 	}
@@ -64,33 +102,173 @@ func (s *JWTService) HashToken(token string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-func (s *JWTService) StoreSession(adminID uint, token string) error {
-	tokenHash := s.HashToken(token)
+// TokenPair is what an admin holds for one session: a short-lived access
+// token for API calls and a refresh token to get the next pair.
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	ExpiresAt        time.Time
+	RefreshExpiresAt time.Time
+}
+
+// SessionClient identifies the device a session is used from.
+type SessionClient struct {
+	IPAddress string
+	UserAgent string
+}
+
+// StartSession signs an admin in, starting a new session family.
+func (s *JWTService) StartSession(admin *models.AdminUser, client SessionClient) (*TokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issuePair(models.DB, admin, familyID, time.Now(), client)
+}
+
+// issuePair creates a token pair for admin and stores it as a session in
+// familyID.
+func (s *JWTService) issuePair(tx *gorm.DB, admin *models.AdminUser, familyID string, authenticatedAt time.Time, client SessionClient) (*TokenPair, error) {
+	access, err := s.GenerateToken(admin)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pair := &TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		ExpiresAt:        now.Add(s.accessTTL),
+		RefreshExpiresAt: now.Add(s.refreshTTL),
+	}
+	// A session never outlives the maximum age, however often it is refreshed
+	if s.maxAge > 0 && pair.RefreshExpiresAt.After(authenticatedAt.Add(s.maxAge)) {
+		pair.RefreshExpiresAt = authenticatedAt.Add(s.maxAge)
+	}
 
 	session := models.AdminSession{
-		AdminID:   adminID,
-		TokenHash: tokenHash,
-		ExpiresAt: time.Now().Add(2 * time.Hour),
-		IsRevoked: false,
+		AdminID:          admin.ID,
+		FamilyID:         familyID,
+		TokenHash:        s.HashToken(access),
+		ExpiresAt:        pair.ExpiresAt,
+		RefreshTokenHash: s.HashToken(refresh),
+		RefreshExpiresAt: pair.RefreshExpiresAt,
+		AuthenticatedAt:  authenticatedAt,
+		IPAddress:        client.IPAddress,
+		UserAgent:        truncate(client.UserAgent, 512),
+		LastSeenAt:       &now,
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return nil, err
 	}
+	return pair, nil
+}
+
+// RefreshSession exchanges a refresh token for a new token pair. Each
+// refresh token works once: presenting one that was already exchanged means
+// it was stolen or replayed, so the whole session family is revoked.
+func (s *JWTService) RefreshSession(refreshToken string, client SessionClient) (*TokenPair, *models.AdminUser, error) {
+	hash := s.HashToken(refreshToken)
+	now := time.Now()
+
+	var pair *TokenPair
+	var admin models.AdminUser
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var session models.AdminSession
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+			return ErrRefreshTokenInvalid
+		}
+		if session.RotatedAt != nil {
+			return &refreshReuseError{familyID: session.FamilyID}
+		}
+		if session.IsRevoked || !session.RefreshExpiresAt.After(now) {
+			return ErrRefreshTokenInvalid
+		}
+		if err := tx.Where("is_active = ?", true).First(&admin, session.AdminID).Error; err != nil {
+			return ErrRefreshTokenInvalid
+		}
+
+		if err := tx.Model(&session).Updates(map[string]interface{}{
+			"rotated_at": now,
+			"is_revoked": true,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		pair, err = s.issuePair(tx, &admin, session.FamilyID, session.AuthenticatedAt, client)
+		return err
+	})
 
-	return models.DB.Create(&session).Error
+	var reuse *refreshReuseError
+	if errors.As(err, &reuse) {
+		if reuse.familyID != "" {
+			if err := models.RevokeSessionFamily(models.DB, reuse.familyID); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, &admin, nil
 }
 
 func (s *JWTService) IsTokenRevoked(token string) bool {
+	_, err := s.ActiveSession(token)
+	return err != nil // If not found, consider it revoked
+}
+
+// lastSeenResolution limits how often a session's last-seen time is written.
+const lastSeenResolution = time.Minute
+
+// ActiveSession returns the live session an access token belongs to and
+// records that it was just used.
+func (s *JWTService) ActiveSession(token string) (*models.AdminSession, error) {
 	tokenHash := s.HashToken(token)
+	now := time.Now()
 
 	var session models.AdminSession
 	err := models.DB.Where("token_hash = ? AND is_revoked = false AND expires_at > ?",
-		tokenHash, time.Now()).First(&session).Error
+		tokenHash, now).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
 
-	return err != nil // If not found, consider it revoked
+	if session.LastSeenAt == nil || now.Sub(*session.LastSeenAt) >= lastSeenResolution {
+		models.DB.Model(&session).UpdateColumn("last_seen_at", now)
+	}
+	return &session, nil
 }
 
+// RevokeToken signs out the session the access token belongs to, including
+// its refresh token.
 func (s *JWTService) RevokeToken(token string) error {
 	tokenHash := s.HashToken(token)
 
-	return models.DB.Model(&models.AdminSession{}).
-		Where("token_hash = ?", tokenHash).
-		Update("is_revoked", true).Error
+	var session models.AdminSession
+	if err := models.DB.Where("token_hash = ?", tokenHash).First(&session).Error; err != nil {
+		return nil // nothing to revoke
+	}
+	return models.RevokeSessionFamily(models.DB, session.FamilyID)
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
 }
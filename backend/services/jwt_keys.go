@@ -0,0 +1,275 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySettings selects how admin tokens are signed. HS256 uses the shared
+// secret; RS256 and EdDSA use a private key file, and tokens carry the key's
+// ID in their kid header.
+type KeySettings struct {
+	Algorithm            string // "HS256", "RS256" or "EdDSA"
+	Secret               string
+	SigningKeyFile       string
+	VerificationKeyFiles []string // public keys of retired signing keys still accepted
+}
+
+// verificationKey is a public key tokens may be signed with.
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens are
+// accepted from.
+type KeySet struct {
+	method     jwt.SigningMethod
+	signingKey interface{}
+	signingKID string
+	verify     map[string]verificationKey
+}
+
+var jwtKeys *KeySet
+
+// LoadJWTKeys loads the signing and verification keys for admin tokens. It is
+// called once at startup.
+func LoadJWTKeys(settings KeySettings) error {
+	keys, err := NewKeySet(settings)
+	if err != nil {
+		return err
+	}
+	jwtKeys = keys
+	return nil
+}
+
+// JWTKeys returns the keys loaded at startup.
+func JWTKeys() *KeySet {
+	return jwtKeys
+}
+
+// NewKeySet builds a key set from settings.
+func NewKeySet(settings KeySettings) (*KeySet, error) {
+	algorithm := strings.ToUpper(settings.Algorithm)
+	if algorithm == "" || algorithm == "HS256" {
+		if settings.Secret == "" {
+			return nil, errors.New("jwt.secret is required for HS256")
+		}
+		return &KeySet{method: jwt.SigningMethodHS256, signingKey: []byte(settings.Secret)}, nil
+	}
+
+	if settings.SigningKeyFile == "" {
+		return nil, fmt.Errorf("jwt.signing_key_file is required for %s", settings.Algorithm)
+	}
+	private, err := readPrivateKey(settings.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &KeySet{signingKey: private, verify: make(map[string]verificationKey)}
+	var public crypto.PublicKey
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != "RS256" {
+			return nil, fmt.Errorf("%s is an RSA key but jwt.algorithm is %s", settings.SigningKeyFile, settings.Algorithm)
+		}
+		keys.method, public = jwt.SigningMethodRS256, &k.PublicKey
+	case ed25519.PrivateKey:
+		if algorithm != "EDDSA" {
+			return nil, fmt.Errorf("%s is an Ed25519 key but jwt.algorithm is %s", settings.SigningKeyFile, settings.Algorithm)
+		}
+		keys.method, public = jwt.SigningMethodEdDSA, k.Public()
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T", settings.SigningKeyFile, private)
+	}
+	if keys.signingKID, err = keys.add(public); err != nil {
+		return nil, err
+	}
+
+	for _, file := range settings.VerificationKeyFiles {
+		if file = strings.TrimSpace(file); file == "" {
+			continue
+		}
+		public, err := readPublicKey(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := keys.add(public); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return keys, nil
+}
+
+// add accepts tokens signed with the private half of public, returning its
+// key ID.
+func (k *KeySet) add(public crypto.PublicKey) (string, error) {
+	var method jwt.SigningMethod
+	switch public.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return "", fmt.Errorf("unsupported key type %T", public)
+	}
+
+	jwk := newJWK(public, method)
+	k.verify[jwk.KeyID] = verificationKey{method: method, key: public}
+	return jwk.KeyID, nil
+}
+
+// sign signs token with the current signing key.
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.signingKID != "" {
+		token.Header["kid"] = k.signingKID
+	}
+	return token.SignedString(k.signingKey)
+}
+
+// keyFunc finds the key a token was signed with, refusing tokens whose
+// algorithm does not match the key so a public key is never used as an
+// HMAC secret.
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if k.verify == nil {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return k.signingKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.verify[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.key, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+func newJWK(public crypto.PublicKey, method jwt.SigningMethod) JWK {
+	jwk := JWK{Use: "sig", Algorithm: method.Alg()}
+	var thumbprint []byte
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		// RFC 7638 thumbprint: required members in lexicographic order
+		thumbprint, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N})
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		thumbprint, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X})
+	}
+	sum := sha256.Sum256(thumbprint)
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(sum[:])
+	return jwk
+}
+
+// JWKS lists the public keys tokens are accepted from, for other services
+// to verify admin tokens. It is empty for HS256.
+func (k *KeySet) JWKS() []JWK {
+	keys := make([]JWK, 0, len(k.verify))
+	if k.signingKID != "" {
+		v := k.verify[k.signingKID]
+		keys = append(keys, newJWK(v.key, v.method))
+	}
+	for kid, v := range k.verify {
+		if kid != k.signingKID {
+			keys = append(keys, newJWK(v.key, v.method))
+		}
+	}
+	return keys
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", file)
+	}
+	return block, nil
+}
+
+func readPrivateKey(file string) (crypto.PrivateKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return key, nil
+}
+
+// readPublicKey reads a public key, or the public half of a private key so
+// a retired signing key file can be kept as is.
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	private, err := readPrivateKey(file)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", file, private)
+	}
+	return signer.Public(), nil
+}
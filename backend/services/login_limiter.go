@@ -0,0 +1,344 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptStore keeps failed login counts per key.
+type LoginAttemptStore interface {
+	Get(key string) (models.LoginThrottle, error)
+	// AddFailure counts a failure at now, starting over if the previous one
+	// was before windowStart.
+	AddFailure(key string, now, windowStart time.Time) (models.LoginThrottle, error)
+	// Attempt counts a failure at now like AddFailure, but only if allow
+	// accepts the current counts. Concurrent attempts on one key are decided
+	// one at a time.
+	Attempt(key string, now, windowStart time.Time, allow func(models.LoginThrottle) bool) (models.LoginThrottle, bool, error)
+	// Release takes back one failure counted by Attempt.
+	Release(key string) error
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+}
+
+// LoginPolicy decides how failures slow down and lock out logins.
+type LoginPolicy struct {
+	BackoffAfter    int           // failures before each attempt has to wait
+	BackoffBase     time.Duration // first wait, doubled for every further failure
+	BackoffMax      time.Duration
+	LockoutAfter    int // failures on one account before it is locked
+	LockoutDuration time.Duration
+	IPLockoutAfter  int           // failures from one IP before it is locked
+	FailureWindow   time.Duration // failures older than this are forgotten
+}
+
+// LoginLimiter tracks failed admin logins per account and per IP address.
+type LoginLimiter struct {
+	store  LoginAttemptStore
+	policy LoginPolicy
+}
+
+func NewLoginLimiter(store LoginAttemptStore, policy LoginPolicy) *LoginLimiter {
+	return &LoginLimiter{store: store, policy: policy}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Attempt reserves an attempt to sign in to the account from ip, or returns
+// how long the caller has to wait if they cannot try now. A reserved attempt
+// counts as a failure on the account straight away, so parallel guesses
+// cannot all get past the backoff before any of them has failed; Succeed or
+// Release takes it back. Accounts back off after a few failures; IP
+// addresses, which may be shared by a whole gym, are only ever locked.
+func (l *LoginLimiter) Attempt(email, ip string) (time.Duration, error) {
+	now := time.Now()
+	address, err := l.store.Get(ipKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	if locked := lockedFor(address, now); locked > 0 {
+		return locked, nil
+	}
+
+	var wait time.Duration
+	_, _, err = l.store.Attempt(accountKey(email), now, now.Add(-l.policy.FailureWindow), func(account models.LoginThrottle) bool {
+		wait = l.waitFor(account, now)
+		return wait <= 0
+	})
+	if err != nil {
+		return 0, err
+	}
+	return wait, nil
+}
+
+// Release takes back an attempt reserved by Attempt that turned out not to
+// be a failure, such as a correct password with a two-factor code to come.
+func (l *LoginLimiter) Release(email string) error {
+	return l.store.Release(accountKey(email))
+}
+
+func lockedFor(throttle models.LoginThrottle, now time.Time) time.Duration {
+	if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+		return throttle.LockedUntil.Sub(now)
+	}
+	return 0
+}
+
+func (l *LoginLimiter) waitFor(throttle models.LoginThrottle, now time.Time) time.Duration {
+	if locked := lockedFor(throttle, now); locked > 0 {
+		return locked
+	}
+	if throttle.LastFailureAt.Before(now.Add(-l.policy.FailureWindow)) {
+		return 0
+	}
+	if l.policy.BackoffAfter <= 0 || throttle.Failures < l.policy.BackoffAfter {
+		return 0
+	}
+
+	delay := l.policy.BackoffBase
+	for i := l.policy.BackoffAfter; i < throttle.Failures && delay < l.policy.BackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, l.policy.BackoffMax)
+	if ready := throttle.LastFailureAt.Add(delay); ready.After(now) {
+		return ready.Sub(now)
+	}
+	return 0
+}
+
+// Fail records a failed login for the account and ip, after Attempt has
+// already counted it against the account. It reports whether the failure
+// locked either of them.
+func (l *LoginLimiter) Fail(email, ip string) (bool, error) {
+	now := time.Now()
+
+	account, err := l.store.Get(accountKey(email))
+	if err != nil {
+		return false, err
+	}
+	address, err := l.store.AddFailure(ipKey(ip), now, now.Add(-l.policy.FailureWindow))
+	if err != nil {
+		return false, err
+	}
+
+	locked := false
+	for _, limit := range []struct {
+		throttle  models.LoginThrottle
+		key       string
+		threshold int
+	}{
+		{account, accountKey(email), l.policy.LockoutAfter},
+		{address, ipKey(ip), l.policy.IPLockoutAfter},
+	} {
+		if limit.threshold > 0 && limit.throttle.Failures >= limit.threshold {
+			if err := l.store.Lock(limit.key, now.Add(l.policy.LockoutDuration)); err != nil {
+				return locked, err
+			}
+			locked = true
+		}
+	}
+	return locked, nil
+}
+
+// Succeed clears the account's failures after a successful login. The IP
+// count is left alone so one valid account does not hide guessing at others.
+func (l *LoginLimiter) Succeed(email string) error {
+	return l.store.Reset(accountKey(email))
+}
+
+// UnlockAccount clears an account's failures and lockout.
+func (l *LoginLimiter) UnlockAccount(email string) error {
+	return l.store.Reset(accountKey(email))
+}
+
+// UnlockIP clears an IP address's failures and lockout.
+func (l *LoginLimiter) UnlockIP(ip string) error {
+	return l.store.Reset(ipKey(ip))
+}
+
+// AccountStatus returns the account's failure count and how long it has to
+// wait before the next attempt.
+func (l *LoginLimiter) AccountStatus(email string) (models.LoginThrottle, time.Duration, error) {
+	throttle, err := l.store.Get(accountKey(email))
+	if err != nil {
+		return throttle, 0, err
+	}
+	return throttle, l.waitFor(throttle, time.Now()), nil
+}
+
+// MemoryLoginAttemptStore keeps failures in memory. Counts are lost on
+// restart and not shared between instances, so it is meant for tests and
+// single-instance development.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	throttle map[string]models.LoginThrottle
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{throttle: make(map[string]models.LoginThrottle)}
+}
+
+func (s *MemoryLoginAttemptStore) Get(key string) (models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.throttle[key], nil
+}
+
+func (s *MemoryLoginAttemptStore) AddFailure(key string, now, windowStart time.Time) (models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle := s.throttle[key]
+	throttle.ThrottleKey = key
+	if throttle.LastFailureAt.Before(windowStart) {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	throttle.UpdatedAt = now
+	s.throttle[key] = throttle
+	return throttle, nil
+}
+
+func (s *MemoryLoginAttemptStore) Attempt(key string, now, windowStart time.Time, allow func(models.LoginThrottle) bool) (models.LoginThrottle, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle := s.throttle[key]
+	throttle.ThrottleKey = key
+	if !allow(throttle) {
+		return throttle, false, nil
+	}
+	if throttle.LastFailureAt.Before(windowStart) {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	throttle.UpdatedAt = now
+	s.throttle[key] = throttle
+	return throttle, true, nil
+}
+
+func (s *MemoryLoginAttemptStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.throttle[key]
+	if ok && throttle.Failures > 0 {
+		throttle.Failures--
+		s.throttle[key] = throttle
+	}
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle := s.throttle[key]
+	throttle.ThrottleKey = key
+	throttle.LockedUntil = &until
+	s.throttle[key] = throttle
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.throttle, key)
+	return nil
+}
+
+// DBLoginAttemptStore keeps failures in the login_throttles table so they
+// are shared by every instance and survive restarts.
+type DBLoginAttemptStore struct{}
+
+func NewDBLoginAttemptStore() *DBLoginAttemptStore {
+	return &DBLoginAttemptStore{}
+}
+
+func (s *DBLoginAttemptStore) Get(key string) (models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	if err := models.DB.Where("throttle_key = ?", key).Limit(1).Find(&throttles).Error; err != nil {
+		return models.LoginThrottle{}, err
+	}
+	if len(throttles) == 0 {
+		return models.LoginThrottle{ThrottleKey: key}, nil
+	}
+	return throttles[0], nil
+}
+
+func (s *DBLoginAttemptStore) AddFailure(key string, now, windowStart time.Time) (models.LoginThrottle, error) {
+	// One statement, so concurrent failures are all counted
+	var throttle models.LoginThrottle
+	err := models.DB.Raw(`INSERT INTO login_throttles (throttle_key, failures, last_failure_at, updated_at)
+		VALUES (?, 1, ?, ?)
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at,
+			updated_at = EXCLUDED.updated_at
+		RETURNING *`, key, now, now, windowStart).Scan(&throttle).Error
+	return throttle, err
+}
+
+func (s *DBLoginAttemptStore) Attempt(key string, now, windowStart time.Time, allow func(models.LoginThrottle) bool) (models.LoginThrottle, bool, error) {
+	var throttle models.LoginThrottle
+	allowed := false
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists, then lock it so attempts on the key wait
+		// for each other
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginThrottle{ThrottleKey: key, UpdatedAt: now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("throttle_key = ?", key).First(&throttle).Error; err != nil {
+			return err
+		}
+		if !allow(throttle) {
+			return nil
+		}
+
+		allowed = true
+		if throttle.LastFailureAt.Before(windowStart) {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		throttle.UpdatedAt = now
+		return tx.Model(&models.LoginThrottle{}).Where("throttle_key = ?", key).
+			Updates(map[string]interface{}{
+				"failures":        throttle.Failures,
+				"last_failure_at": now,
+				"updated_at":      now,
+			}).Error
+	})
+	return throttle, allowed, err
+}
+
+func (s *DBLoginAttemptStore) Release(key string) error {
+	return models.DB.Model(&models.LoginThrottle{}).
+		Where("throttle_key = ? AND failures > 0", key).
+		Updates(map[string]interface{}{"failures": gorm.Expr("failures - 1"), "updated_at": time.Now()}).Error
+}
+
+func (s *DBLoginAttemptStore) Lock(key string, until time.Time) error {
+	return models.DB.Model(&models.LoginThrottle{}).
+		Where("throttle_key = ?", key).
+		Updates(map[string]interface{}{"locked_until": until, "updated_at": time.Now()}).Error
+}
+
+func (s *DBLoginAttemptStore) Reset(key string) error {
+	return models.DB.Where("throttle_key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testLoginPolicy = LoginPolicy{
+	BackoffAfter:    3,
+	BackoffBase:     time.Second,
+	BackoffMax:      10 * time.Second,
+	LockoutAfter:    6,
+	LockoutDuration: 15 * time.Minute,
+	IPLockoutAfter:  10,
+	FailureWindow:   time.Hour,
+}
+
+func newTestLoginLimiter() (*LoginLimiter, *MemoryLoginAttemptStore) {
+	store := NewMemoryLoginAttemptStore()
+	return NewLoginLimiter(store, testLoginPolicy), store
+}
+
+// failLogin counts a failed login the way Attempt and Fail do, without
+// waiting out the backoff in between.
+func failLogin(l *LoginLimiter, store *MemoryLoginAttemptStore, email, ip string) (bool, error) {
+	now := time.Now()
+	store.AddFailure(accountKey(email), now, now.Add(-testLoginPolicy.FailureWindow))
+	return l.Fail(email, ip)
+}
+
+func TestLoginBackoffSchedule(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{7, 10 * time.Second},
+		{12, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		limiter, store := newTestLoginLimiter()
+		now := time.Now()
+		for i := 0; i < tt.failures; i++ {
+			store.AddFailure(accountKey("coach@example.com"), now, now.Add(-time.Hour))
+		}
+
+		throttle, _ := store.Get(accountKey("coach@example.com"))
+		if got := limiter.waitFor(throttle, now); got != tt.want {
+			t.Errorf("%d failures: wait %v, want %v", tt.failures, got, tt.want)
+		}
+		if got := limiter.waitFor(throttle, now.Add(tt.want)); got != 0 {
+			t.Errorf("%d failures: still waiting %v once the backoff has passed", tt.failures, got)
+		}
+	}
+}
+
+func TestLoginBackoffForgetsOldFailures(t *testing.T) {
+	limiter, store := newTestLoginLimiter()
+	old := time.Now().Add(-2 * time.Hour)
+	for i := 0; i < 5; i++ {
+		store.AddFailure(accountKey("coach@example.com"), old, old.Add(-time.Hour))
+	}
+
+	throttle, _ := store.Get(accountKey("coach@example.com"))
+	if got := limiter.waitFor(throttle, time.Now()); got != 0 {
+		t.Errorf("wait %v for failures outside the window, want 0", got)
+	}
+
+	now := time.Now()
+	throttle, _ = store.AddFailure(accountKey("coach@example.com"), now, now.Add(-time.Hour))
+	if throttle.Failures != 1 {
+		t.Errorf("failures = %d after the window passed, want the count to start over at 1", throttle.Failures)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		wantLocked bool
+	}{
+		{"below threshold", 5, false},
+		{"at threshold", 6, true},
+		{"past threshold", 8, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, store := newTestLoginLimiter()
+			locked := false
+			for i := 0; i < tt.failures; i++ {
+				// A fresh IP each time so only the account counts
+				l, err := failLogin(limiter, store, "coach@example.com", fmt.Sprintf("203.0.113.%d", i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				locked = locked || l
+			}
+			if locked != tt.wantLocked {
+				t.Fatalf("locked = %v, want %v", locked, tt.wantLocked)
+			}
+
+			throttle, _ := store.Get(accountKey("coach@example.com"))
+			if !tt.wantLocked {
+				if throttle.LockedUntil != nil {
+					t.Errorf("account locked until %v below the threshold", throttle.LockedUntil)
+				}
+				return
+			}
+
+			now := time.Now()
+			wait := limiter.waitFor(throttle, now)
+			if wait <= testLoginPolicy.BackoffMax || wait > testLoginPolicy.LockoutDuration {
+				t.Errorf("wait %v while locked, want the lockout of up to %v", wait, testLoginPolicy.LockoutDuration)
+			}
+			if got := limiter.waitFor(throttle, throttle.LockedUntil.Add(time.Second)); got != 0 {
+				t.Errorf("wait %v after the lockout expired, want 0", got)
+			}
+		})
+	}
+}
+
+func TestLoginKeying(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures func(l *LoginLimiter, store *MemoryLoginAttemptStore)
+		email    string
+		ip       string
+		blocked  bool
+	}{
+		{
+			name: "account lock follows the account to another IP",
+			failures: func(l *LoginLimiter, store *MemoryLoginAttemptStore) {
+				for i := 0; i < 6; i++ {
+					failLogin(l, store, "coach@example.com", "198.51.100.1")
+				}
+			},
+			email:   "coach@example.com",
+			ip:      "198.51.100.2",
+			blocked: true,
+		},
+		{
+			name: "account email is matched ignoring case and spaces",
+			failures: func(l *LoginLimiter, store *MemoryLoginAttemptStore) {
+				for i := 0; i < 6; i++ {
+					failLogin(l, store, " Coach@Example.com ", "198.51.100.1")
+				}
+			},
+			email:   "coach@example.com",
+			ip:      "198.51.100.2",
+			blocked: true,
+		},
+		{
+			name: "account failures do not block other accounts on the IP",
+			failures: func(l *LoginLimiter, store *MemoryLoginAttemptStore) {
+				for i := 0; i < 6; i++ {
+					failLogin(l, store, "coach@example.com", "198.51.100.1")
+				}
+			},
+			email:   "student@example.com",
+			ip:      "198.51.100.1",
+			blocked: false,
+		},
+		{
+			name: "IP lock blocks every account from that IP",
+			failures: func(l *LoginLimiter, store *MemoryLoginAttemptStore) {
+				for i := 0; i < 10; i++ {
+					failLogin(l, store, fmt.Sprintf("user%d@example.com", i), "198.51.100.1")
+				}
+			},
+			email:   "coach@example.com",
+			ip:      "198.51.100.1",
+			blocked: true,
+		},
+		{
+			name: "IP lock does not block the accounts elsewhere",
+			failures: func(l *LoginLimiter, store *MemoryLoginAttemptStore) {
+				for i := 0; i < 10; i++ {
+					failLogin(l, store, fmt.Sprintf("user%d@example.com", i), "198.51.100.1")
+				}
+			},
+			email:   "user0@example.com",
+			ip:      "198.51.100.2",
+			blocked: false,
+		},
+		{
+			name: "success clears the account",
+			failures: func(l *LoginLimiter, store *MemoryLoginAttemptStore) {
+				for i := 0; i < 10; i++ {
+					failLogin(l, store, "coach@example.com", "198.51.100.1")
+				}
+				l.Succeed("coach@example.com")
+			},
+			email:   "coach@example.com",
+			ip:      "198.51.100.2",
+			blocked: false,
+		},
+		{
+			name: "success leaves the IP locked",
+			failures: func(l *LoginLimiter, store *MemoryLoginAttemptStore) {
+				for i := 0; i < 10; i++ {
+					failLogin(l, store, "coach@example.com", "198.51.100.1")
+				}
+				l.Succeed("coach@example.com")
+			},
+			email:   "coach@example.com",
+			ip:      "198.51.100.1",
+			blocked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, store := newTestLoginLimiter()
+			tt.failures(limiter, store)
+			wait, err := limiter.Attempt(tt.email, tt.ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if blocked := wait > 0; blocked != tt.blocked {
+				t.Errorf("blocked = %v (wait %v), want %v", blocked, wait, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestLoginAttemptParallelGuesses(t *testing.T) {
+	limiter, _ := newTestLoginLimiter()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := limiter.Attempt("coach@example.com", "198.51.100.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != testLoginPolicy.BackoffAfter {
+		t.Errorf("%d parallel attempts got through, want %d before the backoff applies", allowed, testLoginPolicy.BackoffAfter)
+	}
+}
+
+func TestLoginAttemptRelease(t *testing.T) {
+	tests := []struct {
+		name   string
+		finish func(l *LoginLimiter)
+		want   int
+	}{
+		{"failure stays counted", func(l *LoginLimiter) { l.Fail("coach@example.com", "198.51.100.1") }, 2},
+		{"released attempt is taken back", func(l *LoginLimiter) { l.Release("coach@example.com") }, 1},
+		{"success clears every failure", func(l *LoginLimiter) { l.Succeed("coach@example.com") }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, store := newTestLoginLimiter()
+			failLogin(limiter, store, "coach@example.com", "198.51.100.1")
+			if wait, err := limiter.Attempt("coach@example.com", "198.51.100.1"); err != nil || wait != 0 {
+				t.Fatalf("Attempt = %v, %v, want to go ahead", wait, err)
+			}
+			tt.finish(limiter)
+
+			throttle, _ := store.Get(accountKey("coach@example.com"))
+			if throttle.Failures != tt.want {
+				t.Errorf("failures = %d, want %d", throttle.Failures, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+)
+
+// LowStockMonitor flags products whose stock falls to or below their reorder
+// threshold and notifies staff once per crossing.
+type LowStockMonitor struct {
+	notifier Notifier
+	queue    chan uint
+}
+
+var lowStockMonitor *LowStockMonitor
+
+// StartLowStockMonitor starts the background checker. Products queued with
+// QueueLowStockCheck are checked as soon as possible, and every product is
+// swept every interval to catch changes made elsewhere.
+func StartLowStockMonitor(notifier Notifier, interval time.Duration) {
+	m := &LowStockMonitor{
+		notifier: notifier,
+		queue:    make(chan uint, 256),
+	}
+	lowStockMonitor = m
+
+	go func() {
+		var sweep <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			sweep = ticker.C
+		}
+
+		m.sweep()
+		for {
+			select {
+			case id := <-m.queue:
+				if err := m.check(id); err != nil {
+					log.Printf("Low stock check failed for product %d: %v", id, err)
+				}
+			case <-sweep:
+				m.sweep()
+			}
+		}
+	}()
+}
+
+// QueueLowStockCheck asks the monitor to re-check the given products. It never
+// blocks; if the queue is full the periodic sweep picks the products up.
+func QueueLowStockCheck(productIDs ...uint) {
+	m := lowStockMonitor
+	if m == nil {
+		return
+	}
+	for _, id := range productIDs {
+		select {
+		case m.queue <- id:
+		default:
+		}
+	}
+}
+
+func (m *LowStockMonitor) sweep() {
+	var ids []uint
+	// Products that are low but unflagged, or flagged but no longer low
+	err := models.DB.Model(&models.Product{}).
+		Where("is_bundle = ?", false).
+		Where("(stock <= reorder_threshold AND low_stock_since IS NULL) OR (stock > reorder_threshold AND low_stock_since IS NOT NULL)").
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Printf("Low stock sweep failed: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := m.check(id); err != nil {
+			log.Printf("Low stock check failed for product %d: %v", id, err)
+		}
+	}
+}
+
+func (m *LowStockMonitor) check(productID uint) error {
+	var product models.Product
+	if err := models.DB.First(&product, productID).Error; err != nil {
+		return err
+	}
+	if product.IsBundle {
+		// Alerts are raised for the components instead
+		return nil
+	}
+
+	if !product.IsLowStock() {
+		if product.LowStockSince != nil {
+			// Restocked; re-arm the alert for the next crossing
+			return models.DB.Model(&models.Product{}).
+				Where("id = ?", product.ID).
+				UpdateColumn("low_stock_since", nil).Error
+		}
+		return nil
+	}
+
+	// Only the request that sets the flag sends the alert
+	// Rounded as the database stores it, so the flag can be matched again
+	flaggedAt := time.Now().Truncate(time.Microsecond)
+	result := models.DB.Model(&models.Product{}).
+		Where("id = ? AND low_stock_since IS NULL", product.ID).
+		UpdateColumn("low_stock_since", flaggedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	subject := "Low stock"
+	if product.Stock <= 0 {
+		subject = "Out of stock"
+	}
+	err := m.notifier.Notify(context.Background(), Notification{
+		Subject: subject,
+		Message: fmt.Sprintf("%s has %d left (reorder threshold %d)", product.Name, product.Stock, product.ReorderThreshold),
+		Fields: map[string]interface{}{
+			"product_id":        product.ID,
+			"stock":             product.Stock,
+			"reorder_threshold": product.ReorderThreshold,
+			"reorder_quantity":  product.ReorderQuantity,
+		},
+	})
+	if err != nil {
+		// Unflag so the next sweep tries the alert again
+		if clearErr := models.DB.Model(&models.Product{}).
+			Where("id = ? AND low_stock_since = ?", product.ID, flaggedAt).
+			UpdateColumn("low_stock_since", nil).Error; clearErr != nil {
+			log.Printf("Failed to clear low stock flag for product %d: %v", product.ID, clearErr)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Email is a plain-text message to a customer or admin.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email.
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// MailSettings selects and configures the mail driver.
+type MailSettings struct {
+	Driver   string // "log" or "smtp"
+	From     string
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// NewMailer returns the mailer for settings.Driver, falling back to logging
+// messages when no delivery channel is configured.
+func NewMailer(settings MailSettings) Mailer {
+	if settings.Driver == "smtp" && settings.Host != "" {
+		return &SMTPMailer{settings: settings}
+	}
+	return NewLogMailer()
+}
+
+// LogMailer writes emails to the server log instead of sending them.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (LogMailer) Send(ctx context.Context, email Email) error {
+	log.Printf("[mail] to=%s subject=%q\n%s", email.To, email.Subject, email.Body)
+	return nil
+}
+
+// SMTPMailer sends email through an SMTP relay.
+type SMTPMailer struct {
+	settings MailSettings
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, email Email) error {
+	if strings.ContainsAny(email.To+email.Subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	addr := net.JoinHostPort(m.settings.Host, strconv.Itoa(m.settings.Port))
+	var auth smtp.Auth
+	if m.settings.Username != "" {
+		auth = smtp.PlainAuth("", m.settings.Username, m.settings.Password, m.settings.Host)
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + m.settings.From + "\r\n")
+	msg.WriteString("To: " + email.To + "\r\n")
+	msg.WriteString("Subject: " + email.Subject + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(email.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(addr, auth, m.settings.From, []string{email.To}, []byte(msg.String()))
+}
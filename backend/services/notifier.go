@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"log"
+)
+
+// Notification is an operational alert for store staff.
+type Notification struct {
+	Subject string
+	Message string
+	Fields  map[string]interface{}
+}
+
+// Notifier delivers notifications to staff (email, Slack, ...).
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes notifications to the server log. It stands in until a
+// real delivery channel is configured.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Printf("[notify] %s: %s %v", n.Subject, n.Message, n.Fields)
+	return nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+	"gorm.io/gorm"
+)
+
+// maxRecommendations is how many recommendations of each kind are kept per product
+const maxRecommendations = 12
+
+type coPurchase struct {
+	ProductID        uint
+	RelatedProductID uint
+	Orders           int64
+}
+
+// StartRecommendationJob rebuilds the recommendations table now and then
+// every interval in the background.
+func StartRecommendationJob(interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("Recommendation job disabled")
+		return
+	}
+
+	go func() {
+		for {
+			start := time.Now()
+			if err := RecomputeRecommendations(); err != nil {
+				log.Printf("Failed to recompute recommendations: %v", err)
+			} else {
+				log.Printf("Recommendations recomputed in %s", time.Since(start).Round(time.Millisecond))
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// RecomputeRecommendations replaces all rows in product_recommendations with
+// freshly computed "similar" and "bought together" rankings.
+func RecomputeRecommendations() error {
+	var products []models.Product
+	if err := models.DB.Select("id", "category", "brand", "stock", "created_at").Find(&products).Error; err != nil {
+		return err
+	}
+
+	var pairs []coPurchase
+	err := models.DB.Table("order_items a").
+		Select("a.product_id, b.product_id AS related_product_id, COUNT(DISTINCT a.order_id) AS orders").
+		Joins("JOIN order_items b ON b.order_id = a.order_id AND b.product_id <> a.product_id").
+		Joins("JOIN orders o ON o.id = a.order_id AND o.deleted_at IS NULL").
+		Where("o.status IN ?", []models.OrderStatus{models.OrderStatusPaid, models.OrderStatusShipped, models.OrderStatusDelivered}).
+		Group("a.product_id, b.product_id").
+		Scan(&pairs).Error
+	if err != nil {
+		return err
+	}
+
+	rows := similarProducts(products)
+	rows = append(rows, boughtTogether(products, pairs)...)
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.ProductRecommendation{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 500).Error
+	})
+}
+
+// similarProducts ranks products sharing a category and/or brand. Sharing both
+// scores highest, and in-stock and newer products win ties.
+func similarProducts(products []models.Product) []models.ProductRecommendation {
+	var rows []models.ProductRecommendation
+	for _, p := range products {
+		type candidate struct {
+			product models.Product
+			score   float64
+		}
+		var candidates []candidate
+		for _, other := range products {
+			if other.ID == p.ID {
+				continue
+			}
+			score := 0.0
+			if p.Category != "" && other.Category == p.Category {
+				score++
+			}
+			if p.Brand != "" && other.Brand == p.Brand {
+				score++
+			}
+			if score > 0 {
+				candidates = append(candidates, candidate{other, score})
+			}
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if a.score != b.score {
+				return a.score > b.score
+			}
+			if a.product.IsAvailable() != b.product.IsAvailable() {
+				return a.product.IsAvailable()
+			}
+			return a.product.CreatedAt.After(b.product.CreatedAt)
+		})
+
+		for i, cand := range candidates {
+			if i == maxRecommendations {
+				break
+			}
+			rows = append(rows, models.ProductRecommendation{
+				ProductID:        p.ID,
+				Kind:             models.RecommendationSimilar,
+				RelatedProductID: cand.product.ID,
+				Score:            cand.score,
+				Rank:             i + 1,
+			})
+		}
+	}
+	return rows
+}
+
+// boughtTogether ranks products by how many paid orders contained both.
+func boughtTogether(products []models.Product, pairs []coPurchase) []models.ProductRecommendation {
+	active := make(map[uint]bool, len(products))
+	for _, p := range products {
+		active[p.ID] = true
+	}
+
+	byProduct := make(map[uint][]coPurchase)
+	for _, pair := range pairs {
+		if active[pair.ProductID] && active[pair.RelatedProductID] {
+			byProduct[pair.ProductID] = append(byProduct[pair.ProductID], pair)
+		}
+	}
+
+	var rows []models.ProductRecommendation
+	for productID, related := range byProduct {
+		sort.Slice(related, func(i, j int) bool {
+			if related[i].Orders != related[j].Orders {
+				return related[i].Orders > related[j].Orders
+			}
+			return related[i].RelatedProductID < related[j].RelatedProductID
+		})
+		for i, pair := range related {
+			if i == maxRecommendations {
+				break
+			}
+			rows = append(rows, models.ProductRecommendation{
+				ProductID:        productID,
+				Kind:             models.RecommendationBoughtTogether,
+				RelatedProductID: pair.RelatedProductID,
+				Score:            float64(pair.Orders),
+				Rank:             i + 1,
+			})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/calvinnle/bjj-store/backend/models"
+)
+
+// StartSessionPurgeJob deletes expired admin sessions now and then every
+// interval in the background.
+func StartSessionPurgeJob(interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("Session purge job disabled")
+		return
+	}
+
+	go func() {
+		for {
+			if purged, err := models.PurgeExpiredSessions(models.DB); err != nil {
+				log.Printf("Failed to purge expired sessions: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired admin sessions", purged)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -20,6 +20,12 @@ export const productService = {
     return response.data
   },
 
+  // GET /api/products/by-slug/:slug - Get single product by its URL slug
+  async getProductBySlug(slug: string): Promise<Product> {
+    const response = await api.get(`/api/products/by-slug/${encodeURIComponent(slug)}`)
+    return response.data
+  },
+
   // Admin API calls (JWT protected endpoints)
 
   // POST /api/admin/products - Create new product
@@ -82,6 +82,21 @@ export const useProductStore = defineStore('products', {
       }
     },
 
+    // Fetch single product by its URL slug
+    async fetchProductBySlug(slug: string) {
+      this.loading = true
+      this.error = null
+
+      try {
+        this.currentProduct = await productService.getProductBySlug(slug)
+      } catch (error: any) {
+        this.error = error.response?.data?.error || 'Product not found'
+        console.error('Error fetching product:', error)
+      } finally {
+        this.loading = false
+      }
+    },
+
     // Search products
     setSearchQuery(query: string) {
       this.searchQuery = query